@@ -0,0 +1,156 @@
+package nfdump
+
+import (
+	"net"
+	"net/netip"
+)
+
+// NFAddrRecord NFRecord with netip.Addr addresses. All fields are values, so records are comparable,
+// usable as map keys and never share memory with the reader or the NFRecord they were created from.
+// Addresses missing in the record are the zero netip.Addr.
+type NFAddrRecord struct {
+	Flags         uint16
+	MsecFirst     uint16
+	MsecLast      uint16
+	First         uint32
+	Last          uint32
+	FwdStatus     uint8
+	TCPFlags      uint8
+	Proto         uint8
+	Tos           uint8
+	SrcPort       uint16
+	DstPort       uint16
+	ExporterSysID uint16
+	Reserved      uint16
+	ICMPType      uint8
+	ICMPCode      uint8
+
+	SrcIP       netip.Addr
+	DstIP       netip.Addr
+	PacketCount uint64
+	ByteCount   uint64
+	Input       uint32
+	Output      uint32
+	SrcAS       uint32
+	DstAS       uint32
+	DstTos      uint8
+	Dir         uint8
+	SrcMask     uint8
+	DstMask     uint8
+	NextHopIP   netip.Addr
+	BGPNextIP   netip.Addr
+	SrcVlan     uint16
+	DstVLan     uint16
+	OutPkts     uint64
+	OutBytes    uint64
+	AggeFlows   uint64
+	RouterIP    netip.Addr
+	Received    uint64
+
+	SamplingInterval uint32
+}
+
+// AddrRecord return record with netip.Addr addresses
+func (r *NFRecord) AddrRecord() NFAddrRecord {
+	return NFAddrRecord{
+		Flags:            r.Flags,
+		MsecFirst:        r.MsecFirst,
+		MsecLast:         r.MsecLast,
+		First:            r.First,
+		Last:             r.Last,
+		FwdStatus:        r.FwdStatus,
+		TCPFlags:         r.TCPFlags,
+		Proto:            r.Proto,
+		Tos:              r.Tos,
+		SrcPort:          r.SrcPort,
+		DstPort:          r.DstPort,
+		ExporterSysID:    r.ExporterSysID,
+		Reserved:         r.Reserved,
+		ICMPType:         r.ICMPType,
+		ICMPCode:         r.ICMPCode,
+		SrcIP:            ipAddr(r.SrcIP),
+		DstIP:            ipAddr(r.DstIP),
+		PacketCount:      r.PacketCount,
+		ByteCount:        r.ByteCount,
+		Input:            r.Input,
+		Output:           r.Output,
+		SrcAS:            r.SrcAS,
+		DstAS:            r.DstAS,
+		DstTos:           r.DstTos,
+		Dir:              r.Dir,
+		SrcMask:          r.SrcMask,
+		DstMask:          r.DstMask,
+		NextHopIP:        ipAddr(r.NextHopIP),
+		BGPNextIP:        ipAddr(r.BGPNextIP),
+		SrcVlan:          r.SrcVlan,
+		DstVLan:          r.DstVLan,
+		OutPkts:          r.OutPkts,
+		OutBytes:         r.OutBytes,
+		AggeFlows:        r.AggeFlows,
+		RouterIP:         ipAddr(r.RouterIP),
+		Received:         r.Received,
+		SamplingInterval: r.SamplingInterval,
+	}
+}
+
+// Record return record as NFRecord, e.g. to use Filter or Formatter. IPv4 addresses are 4 byte
+// net.IP like decoded records.
+func (r NFAddrRecord) Record() NFRecord {
+	return NFRecord{
+		Flags:            r.Flags,
+		MsecFirst:        r.MsecFirst,
+		MsecLast:         r.MsecLast,
+		First:            r.First,
+		Last:             r.Last,
+		FwdStatus:        r.FwdStatus,
+		TCPFlags:         r.TCPFlags,
+		Proto:            r.Proto,
+		Tos:              r.Tos,
+		SrcPort:          r.SrcPort,
+		DstPort:          r.DstPort,
+		ExporterSysID:    r.ExporterSysID,
+		Reserved:         r.Reserved,
+		ICMPType:         r.ICMPType,
+		ICMPCode:         r.ICMPCode,
+		SrcIP:            addrIP(r.SrcIP),
+		DstIP:            addrIP(r.DstIP),
+		PacketCount:      r.PacketCount,
+		ByteCount:        r.ByteCount,
+		Input:            r.Input,
+		Output:           r.Output,
+		SrcAS:            r.SrcAS,
+		DstAS:            r.DstAS,
+		DstTos:           r.DstTos,
+		Dir:              r.Dir,
+		SrcMask:          r.SrcMask,
+		DstMask:          r.DstMask,
+		NextHopIP:        addrIP(r.NextHopIP),
+		BGPNextIP:        addrIP(r.BGPNextIP),
+		SrcVlan:          r.SrcVlan,
+		DstVLan:          r.DstVLan,
+		OutPkts:          r.OutPkts,
+		OutBytes:         r.OutBytes,
+		AggeFlows:        r.AggeFlows,
+		RouterIP:         addrIP(r.RouterIP),
+		Received:         r.Received,
+		SamplingInterval: r.SamplingInterval,
+	}
+}
+
+// ipAddr convert ip to netip.Addr, IPv4 addresses in 16 byte form become IPv4 addresses like
+// net.IP.Equal treats them. nil becomes the zero Addr.
+func ipAddr(ip net.IP) netip.Addr {
+	var addr, ok = netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// addrIP convert addr to net.IP, nil for the zero Addr
+func addrIP(addr netip.Addr) net.IP {
+	if !addr.IsValid() {
+		return nil
+	}
+	return net.IP(addr.AsSlice())
+}
@@ -0,0 +1,118 @@
+package nfdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/netip"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAddrRecord(t *testing.T) {
+	var f, err = os.Open("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(f); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []NFRecord
+	var addrRecords []NFAddrRecord
+	var counts = make(map[NFAddrRecord]int)
+	for {
+		var record NFRecord
+		if record, err = nfs.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		var addrRecord = record.AddrRecord()
+		records = append(records, record)
+		addrRecords = append(addrRecords, addrRecord)
+		counts[addrRecord]++
+
+		if !addrRecord.SrcIP.IsValid() || !net.IP(addrRecord.SrcIP.AsSlice()).Equal(record.SrcIP) || !net.IP(addrRecord.DstIP.AsSlice()).Equal(record.DstIP) {
+			t.Errorf("Unexpected addresses src:%s dst:%s expected %s %s", addrRecord.SrcIP, addrRecord.DstIP, record.SrcIP, record.DstIP)
+		}
+	}
+	if len(records) != 10 || len(counts) != 10 {
+		t.Fatalf("Unexpected records:%d distinct:%d", len(records), len(counts))
+	}
+
+	for x := range records {
+		if !reflect.DeepEqual(addrRecords[x].Record(), records[x]) {
+			t.Errorf("Unexpected record %d:%+v expected %+v", x, addrRecords[x].Record(), records[x])
+		}
+
+		// Values are unaffected by changes of the NFRecord they were created from
+		var srcIP = addrRecords[x].SrcIP
+		records[x].SrcIP[0]++
+		if addrRecords[x].SrcIP != srcIP || addrRecords[x] == records[x].AddrRecord() {
+			t.Errorf("Record %d changed with its NFRecord:%+v", x, addrRecords[x])
+		}
+	}
+}
+
+func TestAddrRecordCompare(t *testing.T) {
+	// Stream and parsed records are equal in all fields
+	var small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"small": small, "split": splitTestFile(t)} {
+		var nff *NFFile
+		if nff, err = ParseReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		var nfs *NFStream
+		if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		var x int
+		for ; ; x++ {
+			var record NFRecord
+			if record, err = nfs.Row(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: Row error:%v", name, err)
+			}
+			if x >= len(nff.Records) || record.AddrRecord() != nff.Records[x].AddrRecord() {
+				t.Errorf("%s: unexpected record %d:%+v", name, x, record)
+			}
+		}
+		if x != len(nff.Records) {
+			t.Errorf("%s: unexpected records:%d expected %d", name, x, len(nff.Records))
+		}
+	}
+}
+
+func TestIPAddr(t *testing.T) {
+	var tests = []struct {
+		ip       net.IP
+		expected netip.Addr
+	}{
+		{ip: nil, expected: netip.Addr{}},
+		{ip: net.IP{}, expected: netip.Addr{}},
+		{ip: net.IP{10, 0, 0, 1}, expected: netip.MustParseAddr("10.0.0.1")},
+		{ip: net.ParseIP("10.0.0.1"), expected: netip.MustParseAddr("10.0.0.1")},
+		{ip: net.ParseIP("2001:db8::1"), expected: netip.MustParseAddr("2001:db8::1")},
+	}
+
+	for _, tc := range tests {
+		if addr := ipAddr(tc.ip); addr != tc.expected {
+			t.Errorf("Unexpected addr of %v:%v expected %v", tc.ip, addr, tc.expected)
+		}
+		if ip := addrIP(tc.expected); !ip.Equal(tc.ip) && len(tc.ip) > 0 {
+			t.Errorf("Unexpected ip of %v:%v expected %v", tc.expected, ip, tc.ip)
+		}
+	}
+}
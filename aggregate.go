@@ -0,0 +1,305 @@
+package nfdump
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DefaultAggregation nfdump -a aggregation keys, used when NewAggregator is given an empty spec
+const DefaultAggregation = "srcip,dstip,srcport,dstport,proto"
+
+// aggregateKey hash key of all possible aggregation fields, fields not selected stay zero
+type aggregateKey struct {
+	srcIP   [16]byte
+	dstIP   [16]byte
+	nextHop [16]byte
+	bgpNext [16]byte
+	router  [16]byte
+	srcAS   uint32
+	dstAS   uint32
+	input   uint32
+	output  uint32
+	srcPort uint16
+	dstPort uint16
+	srcVlan uint16
+	dstVlan uint16
+	proto   uint8
+	tos     uint8
+	srcMask uint8
+	dstMask uint8
+}
+
+// aggregateField single aggregation key, key sets the hash key field and copy sets the output record field
+type aggregateField struct {
+	key  func(k *aggregateKey, r *NFRecord)
+	copy func(dst *NFRecord, src *NFRecord)
+}
+
+// Aggregator combines records with equal keys into a single record like nfdump -a / -A
+type Aggregator struct {
+	fields  []aggregateField
+	flows   map[aggregateKey]int
+	records []NFRecord
+}
+
+// NewAggregator create Aggregator for a comma separated list of keys as accepted by nfdump -A.
+//
+// Supported keys are srcip, dstip, srcnet, dstnet, srcport, dstport, proto, tos, srcas, dstas,
+// input (inif), output (outif), srcvlan, dstvlan, nexthop, bgpnexthop and router. Address keys
+// accept a prefix length for one address family, for example srcip4/24 or dstip6/64.
+// An empty spec uses DefaultAggregation.
+func NewAggregator(spec string) (a *Aggregator, err error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = DefaultAggregation
+	}
+
+	a = &Aggregator{
+		flows: make(map[aggregateKey]int),
+	}
+
+	for _, name := range strings.Split(spec, ",") {
+		var field aggregateField
+		if field, err = parseAggregateField(strings.ToLower(strings.TrimSpace(name))); err != nil {
+			return nil, err
+		}
+		a.fields = append(a.fields, field)
+	}
+
+	return a, nil
+}
+
+// parseAggregateField return key and copy functions for a single aggregation key
+func parseAggregateField(name string) (field aggregateField, err error) {
+	switch name {
+	case "srcport":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.srcPort = r.SrcPort }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.SrcPort = src.SrcPort }
+	case "dstport":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.dstPort = r.DstPort }
+		field.copy = func(dst *NFRecord, src *NFRecord) {
+			dst.DstPort = src.DstPort
+			dst.ICMPType = src.ICMPType
+			dst.ICMPCode = src.ICMPCode
+		}
+	case "proto":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.proto = r.Proto }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.Proto = src.Proto }
+	case "tos":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.tos = r.Tos }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.Tos = src.Tos }
+	case "srcas":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.srcAS = r.SrcAS }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.SrcAS = src.SrcAS }
+	case "dstas":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.dstAS = r.DstAS }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.DstAS = src.DstAS }
+	case "input", "inif":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.input = r.Input }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.Input = src.Input }
+	case "output", "outif":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.output = r.Output }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.Output = src.Output }
+	case "srcvlan":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.srcVlan = r.SrcVlan }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.SrcVlan = src.SrcVlan }
+	case "dstvlan":
+		field.key = func(k *aggregateKey, r *NFRecord) { k.dstVlan = r.DstVLan }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.DstVLan = src.DstVLan }
+	case "nexthop":
+		field.key = func(k *aggregateKey, r *NFRecord) { copy(k.nextHop[:], r.NextHopIP.To16()) }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.NextHopIP = maskIP(src.NextHopIP, -1, -1) }
+	case "bgpnexthop":
+		field.key = func(k *aggregateKey, r *NFRecord) { copy(k.bgpNext[:], r.BGPNextIP.To16()) }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.BGPNextIP = maskIP(src.BGPNextIP, -1, -1) }
+	case "router":
+		field.key = func(k *aggregateKey, r *NFRecord) { copy(k.router[:], r.RouterIP.To16()) }
+		field.copy = func(dst *NFRecord, src *NFRecord) { dst.RouterIP = maskIP(src.RouterIP, -1, -1) }
+	case "srcnet":
+		field.key = func(k *aggregateKey, r *NFRecord) {
+			copy(k.srcIP[:], maskIP(r.SrcIP, int(r.SrcMask), int(r.SrcMask)).To16())
+			k.srcMask = r.SrcMask
+		}
+		field.copy = func(dst *NFRecord, src *NFRecord) {
+			dst.SrcIP = maskIP(src.SrcIP, int(src.SrcMask), int(src.SrcMask))
+			dst.SrcMask = src.SrcMask
+		}
+	case "dstnet":
+		field.key = func(k *aggregateKey, r *NFRecord) {
+			copy(k.dstIP[:], maskIP(r.DstIP, int(r.DstMask), int(r.DstMask)).To16())
+			k.dstMask = r.DstMask
+		}
+		field.copy = func(dst *NFRecord, src *NFRecord) {
+			dst.DstIP = maskIP(src.DstIP, int(src.DstMask), int(src.DstMask))
+			dst.DstMask = src.DstMask
+		}
+	default:
+		var v4Bits, v6Bits int
+		var src bool
+		if v4Bits, v6Bits, src, err = parseAggregateIP(name); err != nil {
+			return field, err
+		}
+		if src {
+			field.key = func(k *aggregateKey, r *NFRecord) { copy(k.srcIP[:], maskIP(r.SrcIP, v4Bits, v6Bits).To16()) }
+			field.copy = func(dst *NFRecord, src *NFRecord) { dst.SrcIP = maskIP(src.SrcIP, v4Bits, v6Bits) }
+		} else {
+			field.key = func(k *aggregateKey, r *NFRecord) { copy(k.dstIP[:], maskIP(r.DstIP, v4Bits, v6Bits).To16()) }
+			field.copy = func(dst *NFRecord, src *NFRecord) { dst.DstIP = maskIP(src.DstIP, v4Bits, v6Bits) }
+		}
+	}
+
+	return field, nil
+}
+
+// parseAggregateIP parse srcip, dstip, srcip4/<bits> and dstip6/<bits> style keys.
+// A prefix length of -1 means the address family is not masked.
+func parseAggregateIP(name string) (v4Bits int, v6Bits int, src bool, err error) {
+	v4Bits, v6Bits = -1, -1
+
+	var rest string
+	if strings.HasPrefix(name, "srcip") {
+		src = true
+		rest = name[len("srcip"):]
+	} else if strings.HasPrefix(name, "dstip") {
+		rest = name[len("dstip"):]
+	} else {
+		return v4Bits, v6Bits, src, fmt.Errorf("Unsupported aggregation key:%s", name)
+	}
+
+	if rest == "" {
+		return v4Bits, v6Bits, src, nil
+	}
+
+	var bits int
+	if strings.HasPrefix(rest, "4/") {
+		if bits, err = strconv.Atoi(rest[2:]); err != nil || bits < 0 || bits > 32 {
+			return v4Bits, v6Bits, src, fmt.Errorf("Invalid aggregation prefix length:%s", name)
+		}
+		v4Bits = bits
+	} else if strings.HasPrefix(rest, "6/") {
+		if bits, err = strconv.Atoi(rest[2:]); err != nil || bits < 0 || bits > 128 {
+			return v4Bits, v6Bits, src, fmt.Errorf("Invalid aggregation prefix length:%s", name)
+		}
+		v6Bits = bits
+	} else {
+		return v4Bits, v6Bits, src, fmt.Errorf("Unsupported aggregation key:%s", name)
+	}
+
+	return v4Bits, v6Bits, src, nil
+}
+
+// maskIP return a copy of ip masked to v4Bits or v6Bits depending on address family, -1 leaves the address unmasked
+func maskIP(ip net.IP, v4Bits int, v6Bits int) net.IP {
+	if ip == nil {
+		return nil
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		if v4Bits < 0 {
+			return append(net.IP(nil), ip4...)
+		}
+		return ip4.Mask(net.CIDRMask(v4Bits, 32))
+	}
+
+	if v6Bits < 0 {
+		return append(net.IP(nil), ip...)
+	}
+	return ip.Mask(net.CIDRMask(v6Bits, 128))
+}
+
+// Add record to aggregation. Packets, bytes and flows are summed and First/Last widened to cover all records with the same key.
+func (a *Aggregator) Add(record NFRecord) {
+	var key aggregateKey
+	for _, field := range a.fields {
+		field.key(&key, &record)
+	}
+
+	var flows = record.AggeFlows
+	if flows == 0 {
+		flows = 1
+	}
+
+	var index, ok = a.flows[key]
+	if !ok {
+		var aggregated NFRecord
+		for _, field := range a.fields {
+			field.copy(&aggregated, &record)
+		}
+		aggregated.Flags = packetCount8Byte | bytesCount8Byte
+		if len(aggregated.SrcIP) == net.IPv6len || len(aggregated.DstIP) == net.IPv6len {
+			aggregated.Flags |= v6And
+		}
+		aggregated.First = record.First
+		aggregated.MsecFirst = record.MsecFirst
+		aggregated.Last = record.Last
+		aggregated.MsecLast = record.MsecLast
+		aggregated.TCPFlags = record.TCPFlags
+		aggregated.PacketCount = record.PacketCount
+		aggregated.ByteCount = record.ByteCount
+		aggregated.OutPkts = record.OutPkts
+		aggregated.OutBytes = record.OutBytes
+		aggregated.AggeFlows = flows
+		aggregated.Received = record.Received
+
+		a.flows[key] = len(a.records)
+		a.records = append(a.records, aggregated)
+		return
+	}
+
+	var aggregated = &a.records[index]
+	if record.StartTimeMS() < aggregated.StartTimeMS() {
+		aggregated.First = record.First
+		aggregated.MsecFirst = record.MsecFirst
+	}
+	if record.EndTimeMS() > aggregated.EndTimeMS() {
+		aggregated.Last = record.Last
+		aggregated.MsecLast = record.MsecLast
+	}
+	if record.Received > aggregated.Received {
+		aggregated.Received = record.Received
+	}
+	aggregated.TCPFlags |= record.TCPFlags
+	aggregated.PacketCount += record.PacketCount
+	aggregated.ByteCount += record.ByteCount
+	aggregated.OutPkts += record.OutPkts
+	aggregated.OutBytes += record.OutBytes
+	aggregated.AggeFlows += flows
+}
+
+// Len return number of distinct aggregation keys
+func (a *Aggregator) Len() int {
+	return len(a.records)
+}
+
+// Records return aggregated records in the order their key was first seen, AggeFlows holds the number of flows aggregated
+func (a *Aggregator) Records() []NFRecord {
+	return a.records
+}
+
+// Reset remove all aggregated records while keeping the aggregation keys
+func (a *Aggregator) Reset() {
+	a.flows = make(map[aggregateKey]int)
+	a.records = nil
+}
+
+// AggregateStream aggregate every remaining record in nfs using the keys in spec
+func AggregateStream(nfs *NFStream, spec string) (records []NFRecord, err error) {
+	var a *Aggregator
+	if a, err = NewAggregator(spec); err != nil {
+		return nil, err
+	}
+
+	var record NFRecord
+	for {
+		if record, err = nfs.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		a.Add(record)
+	}
+
+	return a.Records(), nil
+}
@@ -0,0 +1,95 @@
+package nfdump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestAggregateStream(t *testing.T) {
+	var tests = []struct {
+		spec    string
+		records int
+	}{
+		{spec: "", records: 10},
+		{spec: "proto", records: 2},
+		{spec: "dstport", records: 7},
+		{spec: "proto,dstport", records: 8},
+		{spec: "srcas", records: 8},
+		{spec: "router", records: 4},
+		{spec: "srcip4/8", records: 9},
+		{spec: "srcip4/0", records: 1},
+		{spec: "srcip6/64", records: 10},
+		{spec: "input, output", records: 8},
+	}
+
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.spec, func(t *testing.T) {
+			var nfs *NFStream
+			var records []NFRecord
+			var err error
+			if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+
+			if records, err = AggregateStream(nfs, tc.spec); err != nil {
+				t.Fatalf("AggregateStream error:%v", err)
+			}
+
+			if len(records) != tc.records {
+				t.Errorf("Unexpected record count:%d expected %d", len(records), tc.records)
+			}
+
+			var flows, packets, bytes uint64
+			for _, record := range records {
+				flows += record.AggeFlows
+				packets += record.PacketCount
+				bytes += record.ByteCount
+			}
+			if flows != nfs.StatRecord.NumFlows || packets != nfs.StatRecord.NumPackets || bytes != nfs.StatRecord.NumBytes {
+				t.Errorf("Unexpected totals flows:%d packets:%d bytes:%d", flows, packets, bytes)
+			}
+		})
+	}
+}
+
+func TestAggregatorRecord(t *testing.T) {
+	var a *Aggregator
+	var err error
+	if a, err = NewAggregator("proto,srcip4/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Add(NFRecord{First: 100, MsecFirst: 500, Last: 110, Proto: 6, TCPFlags: 0x02, SrcIP: []byte{10, 0, 0, 1}, DstIP: []byte{10, 0, 1, 1}, PacketCount: 1, ByteCount: 60})
+	a.Add(NFRecord{First: 90, Last: 105, Proto: 6, TCPFlags: 0x10, SrcIP: []byte{10, 0, 0, 2}, DstIP: []byte{10, 0, 1, 2}, PacketCount: 10, ByteCount: 1500, AggeFlows: 3})
+	a.Add(NFRecord{First: 95, Last: 120, Proto: 17, SrcIP: []byte{10, 0, 0, 3}, PacketCount: 1, ByteCount: 100})
+
+	if a.Len() != 2 {
+		t.Fatalf("Unexpected key count:%d expected 2", a.Len())
+	}
+
+	var record = a.Records()[0]
+	if record.SrcIP.String() != "10.0.0.0" || record.DstIP != nil {
+		t.Errorf("Unexpected addresses src:%s dst:%s", record.SrcIP, record.DstIP)
+	}
+	if record.First != 90 || record.MsecFirst != 0 || record.Last != 110 {
+		t.Errorf("Unexpected time range first:%d.%d last:%d", record.First, record.MsecFirst, record.Last)
+	}
+	if record.AggeFlows != 4 || record.PacketCount != 11 || record.ByteCount != 1560 || record.TCPFlags != 0x12 {
+		t.Errorf("Unexpected counters:%+v", record)
+	}
+
+	if _, err = NewAggregator("srcip4/33"); err == nil {
+		t.Errorf("Expected error for invalid prefix length")
+	}
+	if _, err = NewAggregator("foo"); err == nil {
+		t.Errorf("Expected error for unknown key")
+	}
+}
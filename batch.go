@@ -0,0 +1,190 @@
+package nfdump
+
+import (
+	"net/netip"
+)
+
+// Column set of RecordBatch columns
+type Column uint32
+
+const (
+	// ColumnTime Start End
+	ColumnTime Column = 1 << iota
+	// ColumnAddr SrcIP DstIP
+	ColumnAddr
+	// ColumnPort SrcPort DstPort
+	ColumnPort
+	// ColumnProto Proto TCPFlags Tos
+	ColumnProto
+	// ColumnCounter Packets Bytes OutPackets OutBytes
+	ColumnCounter
+	// ColumnAS SrcAS DstAS
+	ColumnAS
+	// ColumnInterface Input Output
+	ColumnInterface
+	// ColumnNextHop NextHopIP BGPNextIP RouterIP
+	ColumnNextHop
+	// ColumnExporter ExporterSysID SamplingInterval
+	ColumnExporter
+
+	// AllColumns all RecordBatch columns
+	AllColumns = ColumnTime | ColumnAddr | ColumnPort | ColumnProto | ColumnCounter | ColumnAS |
+		ColumnInterface | ColumnNextHop | ColumnExporter
+)
+
+// RecordBatch flow records of one block in columns, value x of every column belongs to record x.
+// Only the columns of Columns are filled, all other columns are empty.
+type RecordBatch struct {
+	Columns Column
+	// Block index of the block the records were read from, starting at 1
+	Block int
+
+	// Start End flow times in milliseconds since epoch
+	Start []int64
+	End   []int64
+
+	SrcIP []netip.Addr
+	DstIP []netip.Addr
+
+	SrcPort []uint16
+	DstPort []uint16
+
+	Proto    []uint8
+	TCPFlags []uint8
+	Tos      []uint8
+
+	Packets    []uint64
+	Bytes      []uint64
+	OutPackets []uint64
+	OutBytes   []uint64
+
+	SrcAS []uint32
+	DstAS []uint32
+
+	Input  []uint32
+	Output []uint32
+
+	NextHopIP []netip.Addr
+	BGPNextIP []netip.Addr
+	RouterIP  []netip.Addr
+
+	ExporterSysID    []uint16
+	SamplingInterval []uint32
+
+	len int
+}
+
+// Len number of records in the batch
+func (b *RecordBatch) Len() int {
+	return b.len
+}
+
+// reset empty all columns keeping their memory
+func (b *RecordBatch) reset(columns Column, block int) {
+	b.Columns = columns
+	b.Block = block
+	b.len = 0
+
+	b.Start, b.End = b.Start[:0], b.End[:0]
+	b.SrcIP, b.DstIP = b.SrcIP[:0], b.DstIP[:0]
+	b.SrcPort, b.DstPort = b.SrcPort[:0], b.DstPort[:0]
+	b.Proto, b.TCPFlags, b.Tos = b.Proto[:0], b.TCPFlags[:0], b.Tos[:0]
+	b.Packets, b.Bytes, b.OutPackets, b.OutBytes = b.Packets[:0], b.Bytes[:0], b.OutPackets[:0], b.OutBytes[:0]
+	b.SrcAS, b.DstAS = b.SrcAS[:0], b.DstAS[:0]
+	b.Input, b.Output = b.Input[:0], b.Output[:0]
+	b.NextHopIP, b.BGPNextIP, b.RouterIP = b.NextHopIP[:0], b.BGPNextIP[:0], b.RouterIP[:0]
+	b.ExporterSysID, b.SamplingInterval = b.ExporterSysID[:0], b.SamplingInterval[:0]
+}
+
+// append add record to the columns of the batch
+func (b *RecordBatch) append(record *NFRecord) {
+	b.len++
+
+	if b.Columns&ColumnTime != 0 {
+		b.Start = append(b.Start, record.StartTimeMS())
+		b.End = append(b.End, record.EndTimeMS())
+	}
+	if b.Columns&ColumnAddr != 0 {
+		b.SrcIP = append(b.SrcIP, ipAddr(record.SrcIP))
+		b.DstIP = append(b.DstIP, ipAddr(record.DstIP))
+	}
+	if b.Columns&ColumnPort != 0 {
+		b.SrcPort = append(b.SrcPort, record.SrcPort)
+		b.DstPort = append(b.DstPort, record.DstPort)
+	}
+	if b.Columns&ColumnProto != 0 {
+		b.Proto = append(b.Proto, record.Proto)
+		b.TCPFlags = append(b.TCPFlags, record.TCPFlags)
+		b.Tos = append(b.Tos, record.Tos)
+	}
+	if b.Columns&ColumnCounter != 0 {
+		b.Packets = append(b.Packets, record.PacketCount)
+		b.Bytes = append(b.Bytes, record.ByteCount)
+		b.OutPackets = append(b.OutPackets, record.OutPkts)
+		b.OutBytes = append(b.OutBytes, record.OutBytes)
+	}
+	if b.Columns&ColumnAS != 0 {
+		b.SrcAS = append(b.SrcAS, record.SrcAS)
+		b.DstAS = append(b.DstAS, record.DstAS)
+	}
+	if b.Columns&ColumnInterface != 0 {
+		b.Input = append(b.Input, record.Input)
+		b.Output = append(b.Output, record.Output)
+	}
+	if b.Columns&ColumnNextHop != 0 {
+		b.NextHopIP = append(b.NextHopIP, ipAddr(record.NextHopIP))
+		b.BGPNextIP = append(b.BGPNextIP, ipAddr(record.BGPNextIP))
+		b.RouterIP = append(b.RouterIP, ipAddr(record.RouterIP))
+	}
+	if b.Columns&ColumnExporter != 0 {
+		b.ExporterSysID = append(b.ExporterSysID, record.ExporterSysID)
+		b.SamplingInterval = append(b.SamplingInterval, record.SamplingInterval)
+	}
+}
+
+// NFBatchReader reads the records of an NFStream a block at a time into a RecordBatch
+type NFBatchReader struct {
+	nfs     *NFStream
+	columns Column
+
+	pending    NFRecord
+	pendingErr error
+	hasPending bool
+}
+
+// BatchReader create NFBatchReader reading the columns of the records of nfs. Only the fields of
+// columns are decoded, see NFStream.SetFields. Filter, time range and sampling scale of nfs apply,
+// blocks without matching records are skipped.
+func BatchReader(nfs *NFStream, columns Column) *NFBatchReader {
+	nfs.SetFields(columns.fields())
+	return &NFBatchReader{nfs: nfs, columns: columns}
+}
+
+// Next fill batch with the records of the next block, the memory of batch is reused. Returns io.EOF
+// at the end of the stream, batch is then empty.
+func (nfb *NFBatchReader) Next(batch *RecordBatch) (err error) {
+	var record NFRecord
+
+	if nfb.hasPending {
+		nfb.hasPending = false
+		record, err = nfb.pending, nfb.pendingErr
+	} else {
+		record, err = nfb.nfs.Row()
+	}
+	batch.reset(nfb.columns, nfb.nfs.blocks.index)
+	if err != nil {
+		return err
+	}
+
+	for {
+		batch.append(&record)
+
+		// Row only moves to the next block when the current one has no more records, the first
+		// record of the next block or an error are returned by the next call
+		record, err = nfb.nfs.Row()
+		if err != nil || nfb.nfs.blocks.index != batch.Block {
+			nfb.hasPending, nfb.pending, nfb.pendingErr = true, record, err
+			return nil
+		}
+	}
+}
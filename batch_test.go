@@ -0,0 +1,107 @@
+package nfdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBatchReader(t *testing.T) {
+	var small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name    string
+		data    []byte
+		columns Column
+		batches []int
+	}{
+		{name: "one block", data: small, columns: AllColumns, batches: []int{10}},
+		{name: "block per flow", data: splitTestFile(t), columns: AllColumns, batches: []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{name: "projection", data: small, columns: ColumnTime | ColumnAddr | ColumnCounter, batches: []int{10}},
+	}
+
+	for _, tc := range tests {
+		var expected *NFFile
+		if expected, err = ParseReader(bytes.NewReader(tc.data)); err != nil {
+			t.Fatal(err)
+		}
+		var nfs *NFStream
+		if nfs, err = StreamReader(bytes.NewReader(tc.data)); err != nil {
+			t.Fatal(err)
+		}
+
+		var nfb = BatchReader(nfs, tc.columns)
+		var batch RecordBatch
+		var batches []int
+		var x int
+		for {
+			if err = nfb.Next(&batch); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: Next error:%v", tc.name, err)
+			}
+			batches = append(batches, batch.Len())
+
+			for i := 0; i < batch.Len(); i, x = i+1, x+1 {
+				var record = expected.Records[x].AddrRecord()
+				if batch.Start[i] != expected.Records[x].StartTimeMS() || batch.End[i] != expected.Records[x].EndTimeMS() ||
+					batch.SrcIP[i] != record.SrcIP || batch.DstIP[i] != record.DstIP ||
+					batch.Packets[i] != record.PacketCount || batch.Bytes[i] != record.ByteCount {
+					t.Errorf("%s: unexpected record %d of block %d", tc.name, i, batch.Block)
+				}
+				if tc.columns != AllColumns {
+					continue
+				}
+				if batch.SrcPort[i] != record.SrcPort || batch.DstPort[i] != record.DstPort || batch.Proto[i] != record.Proto ||
+					batch.SrcAS[i] != record.SrcAS || batch.Input[i] != record.Input || batch.NextHopIP[i] != record.NextHopIP ||
+					batch.RouterIP[i] != record.RouterIP || batch.ExporterSysID[i] != record.ExporterSysID {
+					t.Errorf("%s: unexpected record %d of block %d", tc.name, i, batch.Block)
+				}
+			}
+			if tc.columns != AllColumns && (len(batch.SrcPort) != 0 || len(batch.Proto) != 0 || len(batch.NextHopIP) != 0) {
+				t.Errorf("%s: columns not requested filled", tc.name)
+			}
+		}
+
+		if len(batches) != len(tc.batches) || x != len(expected.Records) {
+			t.Errorf("%s: unexpected batches:%v records:%d expected %v", tc.name, batches, x, tc.batches)
+		}
+		for i := range batches {
+			if i < len(tc.batches) && batches[i] != tc.batches[i] {
+				t.Errorf("%s: unexpected batches:%v expected %v", tc.name, batches, tc.batches)
+				break
+			}
+		}
+		if batch.Len() != 0 || len(batch.Start) != 0 {
+			t.Errorf("%s: batch not empty at io.EOF:%d", tc.name, batch.Len())
+		}
+		if err = nfb.Next(&batch); err != io.EOF {
+			t.Errorf("%s: expected io.EOF got:%v", tc.name, err)
+		}
+	}
+}
+
+func TestBatchReaderReuse(t *testing.T) {
+	var nfs, err = StreamReader(bytes.NewReader(splitTestFile(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nfb = BatchReader(nfs, AllColumns)
+
+	// Block 1 only has meta records
+	var batch RecordBatch
+	if err = nfb.Next(&batch); err != nil {
+		t.Fatal(err)
+	}
+	var start = &batch.Start[0]
+	if err = nfb.Next(&batch); err != nil {
+		t.Fatal(err)
+	}
+	if &batch.Start[0] != start || batch.Block != 3 {
+		t.Errorf("Batch memory not reused, block:%d", batch.Block)
+	}
+}
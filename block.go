@@ -0,0 +1,287 @@
+package nfdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/rasky/go-lzo"
+)
+
+// dataBlockID only block type 2 contains records
+const dataBlockID = 2
+
+// readFileHeader read and validate file header and stat record
+func readFileHeader(r io.Reader) (header NFHeader, stat NFStatRecord, err error) {
+	if err = binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return header, stat, ErrFailedReadFileHeader
+	}
+
+	if header.Magic != magic {
+		return header, stat, ErrBadMagic
+	}
+
+	if header.Version != layoutVersion {
+		return header, stat, ErrUnsupportedFileVersion
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &stat); err != nil {
+		return header, stat, ErrFailedReadStatRecord
+	}
+
+	return header, stat, nil
+}
+
+// decompressBlock return uncompressed block data according to the file header compression flags
+func decompressBlock(flags uint32, blockData []byte) (data []byte, err error) {
+	if (flags & compressionMask) == 0 {
+		return blockData, nil
+	} else if (flags & lzoCompressed) > 0 {
+		if data, err = lzo.Decompress1X(bytes.NewReader(blockData), 0, 0); err != nil {
+			return nil, fmt.Errorf("lzo.Decompress1X() failed error:%w", err)
+		}
+		return data, nil
+	} else if (flags & lz4Compressed) > 0 {
+		return nil, fmt.Errorf("LZ4 compression not supported")
+	} else if (flags & bz2Compressed) > 0 {
+		return nil, fmt.Errorf("BZ2 compression not supported")
+	}
+	return nil, fmt.Errorf("Unsupported File Flag Compression:%d", flags)
+}
+
+// blockReader read the blocks following the file header one at a time from r, or from in memory
+// file data without copy. Block data is only valid until the next block is read.
+type blockReader struct {
+	r io.Reader
+	// flags file header flags, select the compression of data blocks
+	flags uint32
+	// mem file data of OpenFile, blocks are read from mem at memOffset instead of r
+	mem       []byte
+	memOffset int
+
+	// header header of the current block
+	header NFBlockHeader
+	// index 1 based index of the current block
+	index int
+	// raw data of the current block as stored in the file
+	raw []byte
+	// buf reused for raw block data read from r
+	buf []byte
+}
+
+// next read header and data of the next block, io.EOF at end of file
+func (br *blockReader) next() (err error) {
+	if err = br.readHeader(); err == io.EOF {
+		return err
+	} else if err != nil {
+		return ErrFailedReadBlockHeader
+	}
+	if _, err = br.readData(); err != nil {
+		return fmt.Errorf("Read Block Failed blockIndex:%d error:%w", br.index, err)
+	}
+	return nil
+}
+
+// readHeader read the header of the next block, io.EOF at end of file
+func (br *blockReader) readHeader() (err error) {
+	if br.mem == nil {
+		if err = binary.Read(br.r, binary.LittleEndian, &br.header); err != nil {
+			return err
+		}
+		br.index++
+		return nil
+	}
+
+	if br.memOffset == len(br.mem) {
+		return io.EOF
+	}
+	if br.memOffset+int(blockHeaderSize) > len(br.mem) {
+		return io.ErrUnexpectedEOF
+	}
+	var data = br.mem[br.memOffset:]
+	br.header = NFBlockHeader{
+		NumRecords: binary.LittleEndian.Uint32(data[0:4]),
+		Size:       binary.LittleEndian.Uint32(data[4:8]),
+		ID:         binary.LittleEndian.Uint16(data[8:10]),
+		Flags:      binary.LittleEndian.Uint16(data[10:12]),
+	}
+	br.memOffset += int(blockHeaderSize)
+	br.index++
+	return nil
+}
+
+// readData read the data of the current block and return the number of bytes read
+func (br *blockReader) readData() (n int, err error) {
+	var size = int(br.header.Size)
+	if br.mem == nil {
+		if len(br.buf) < size {
+			br.buf = make([]byte, size)
+		}
+		br.raw = br.buf[:size]
+		return io.ReadFull(br.r, br.raw)
+	}
+
+	if br.memOffset+size > len(br.mem) {
+		n = len(br.mem) - br.memOffset
+		br.memOffset = len(br.mem)
+		return n, io.ErrUnexpectedEOF
+	}
+	br.raw = br.mem[br.memOffset : br.memOffset+size : br.memOffset+size]
+	br.memOffset += size
+	return size, nil
+}
+
+// skipData skip the data of the current block
+func (br *blockReader) skipData() error {
+	if br.mem == nil {
+		return skipBytes(br.r, int64(br.header.Size))
+	}
+
+	if br.memOffset+int(br.header.Size) > len(br.mem) {
+		br.memOffset = len(br.mem)
+		return io.ErrUnexpectedEOF
+	}
+	br.memOffset += int(br.header.Size)
+	return nil
+}
+
+// data uncompressed data of the current block
+func (br *blockReader) data() ([]byte, error) {
+	return decompressBlock(br.flags, br.raw)
+}
+
+// recordIter iterate over the records of uncompressed block data
+type recordIter struct {
+	data []byte
+	// start size offset and size of the current record
+	start int
+	size  int
+	// recordType type of the current record
+	recordType uint16
+}
+
+// newRecordIter iterator over the records of data
+func newRecordIter(data []byte) recordIter {
+	return recordIter{data: data}
+}
+
+// next move to the next record, false at the end of data. A record size too small for the record
+// header or exceeding the data is an error, start and size are those of the bad record then.
+func (it *recordIter) next() (ok bool, err error) {
+	it.start += it.size
+	it.size = 0
+	if it.start+4 > len(it.data) {
+		return false, nil
+	}
+	it.recordType = binary.LittleEndian.Uint16(it.data[it.start:][0:2])
+	it.size = int(binary.LittleEndian.Uint16(it.data[it.start:][2:4]))
+	if it.size < 4 || it.start+it.size > len(it.data) {
+		return false, fmt.Errorf("Corrupt file, bad record size:%d", it.size)
+	}
+	return true, nil
+}
+
+// record data of the current record starting at the record header
+func (it *recordIter) record() []byte {
+	return it.data[it.start : it.start+it.size]
+}
+
+// trailing number of bytes after the last record too short for a record header
+func (it *recordIter) trailing() int {
+	return len(it.data) - it.start
+}
+
+// decodeExtensionMap decode extension map record, data is the complete record
+func decodeExtensionMap(data []byte) (mapID uint16, exts []uint16, err error) {
+	if len(data) < 8 {
+		return 0, nil, fmt.Errorf("Corrupt file, bad record size:%d", len(data))
+	}
+	mapID = binary.LittleEndian.Uint16(data[4:6])
+	var extSize = binary.LittleEndian.Uint16(data[6:8])
+
+	// extSize == 0 extension map v2
+	// extSize > 0 extension map v1
+	if extSize == 0 {
+		return mapID, nil, fmt.Errorf("Unsupported extension map v2 file")
+	}
+
+	for offset := 8; offset+2 <= len(data); offset += 2 {
+		var extID = binary.LittleEndian.Uint16(data[offset : offset+2])
+		if extID > 48 {
+			return mapID, nil, fmt.Errorf("Corrupt file, bad extMapID:%d mapID:%d", extID, mapID)
+		}
+		// v1 extension map aligns to 32bit so there could be a 0 extension ID at the end
+		if extID != 0 {
+			exts = append(exts, extID)
+		}
+	}
+
+	return mapID, exts, nil
+}
+
+// decodeExporterInfo decode exporter info record, data is the complete record
+func decodeExporterInfo(data []byte) (exporter NFExporterInfoRecord, err error) {
+	if len(data) < 32 {
+		return exporter, fmt.Errorf("Corrupt file, bad record size:%d", len(data))
+	}
+	exporter.Version = binary.LittleEndian.Uint32(data[4:8])
+	exporter.SAFamily = binary.LittleEndian.Uint16(data[24:26])
+	exporter.SysID = binary.LittleEndian.Uint16(data[26:28])
+	exporter.ID = binary.LittleEndian.Uint32(data[28:32])
+	exporter.IPAddr = decodeExporterIP(data[8:24], exporter.SAFamily)
+	return exporter, nil
+}
+
+// decodeSamplerInfo decode sampler info record, data is the complete record
+func decodeSamplerInfo(data []byte) (sampler NFSamplerInfoRecord, err error) {
+	if len(data) < 16 {
+		return sampler, fmt.Errorf("Corrupt file, bad record size:%d", len(data))
+	}
+	sampler.ID = binary.LittleEndian.Uint32(data[4:8])
+	sampler.Interval = binary.LittleEndian.Uint32(data[8:12])
+	sampler.Mode = binary.LittleEndian.Uint16(data[12:14])
+	sampler.ExporterSysID = binary.LittleEndian.Uint16(data[14:16])
+	return sampler, nil
+}
+
+// decodeExporterStats decode exporter stat record, data is the complete record
+func decodeExporterStats(data []byte) (stats []NFExporterStatRecord) {
+	if len(data) < 8 {
+		return nil
+	}
+	var statCount = binary.LittleEndian.Uint32(data[4:8])
+
+	// Never read past the record, each stat is 24 bytes after the 8 byte header and stat count
+	if max := uint32(len(data)-8) / 24; statCount > max {
+		statCount = max
+	}
+
+	for statPosition := uint32(0); statPosition < statCount; statPosition++ {
+		j := (statPosition * 24) + 8 // each stat record is 24 bytes + 8 for header/stat count
+
+		stats = append(stats, NFExporterStatRecord{
+			SysID:            binary.LittleEndian.Uint32(data[j : j+4]),
+			SequenceFailures: binary.LittleEndian.Uint32(data[j+4 : j+8]),
+			Packets:          binary.LittleEndian.Uint64(data[j+8 : j+16]),
+			Flows:            binary.LittleEndian.Uint64(data[j+16 : j+24]),
+		})
+	}
+
+	return stats
+}
+
+// add add the counters of other to s
+func (s *NFExporterStatRecord) add(other NFExporterStatRecord) {
+	s.SequenceFailures += other.SequenceFailures
+	s.Packets += other.Packets
+	s.Flows += other.Flows
+}
+
+// addExporterStat add stat to the stat of the same exporter in stats
+func addExporterStat(stats map[uint32]NFExporterStatRecord, stat NFExporterStatRecord) {
+	var sum = stats[stat.SysID]
+	sum.SysID = stat.SysID
+	sum.add(stat)
+	stats[stat.SysID] = sum
+}
@@ -0,0 +1,282 @@
+package nfdump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlockIndexSuffix file name suffix of block index sidecar files written by BlockIndexFile
+const BlockIndexSuffix = ".idx"
+
+// blockIndexVersion version of the block index sidecar format
+const blockIndexVersion = 1
+
+// fileHeaderSize size of NFHeader and NFStatRecord at the start of every file
+var fileHeaderSize = int64(binary.Size(NFHeader{}) + binary.Size(NFStatRecord{}))
+
+// blockHeaderSize size of NFBlockHeader in front of every block
+var blockHeaderSize = int64(binary.Size(NFBlockHeader{}))
+
+// BlockIndex per block meta data of an nfdump file, used to skip blocks without decompressing them
+type BlockIndex struct {
+	Version int `json:"version"`
+	// FileSize size of the indexed file, an index with a different size is stale
+	FileSize int64             `json:"file_size"`
+	Blocks   []BlockIndexEntry `json:"blocks"`
+}
+
+// BlockIndexEntry meta data of a single block
+type BlockIndexEntry struct {
+	// Offset file offset of the block header
+	Offset     int64  `json:"offset"`
+	NumRecords uint32 `json:"num_records"`
+	Size       uint32 `json:"size"`
+	ID         uint16 `json:"id"`
+	// Flows number of flow records in the block
+	Flows uint32 `json:"flows"`
+	// FirstMS LastMS lowest flow start and highest flow end time in milliseconds, 0 without flows
+	FirstMS int64 `json:"first_ms"`
+	LastMS  int64 `json:"last_ms"`
+	// Meta block contains extension map, exporter, sampler or exporter stat records and must
+	// always be read
+	Meta bool `json:"meta"`
+}
+
+// BuildBlockIndex read the whole file and return its block index, every block is decompressed once
+func BuildBlockIndex(r io.Reader) (index *BlockIndex, err error) {
+	var (
+		header NFHeader
+		data   []byte
+	)
+
+	if header, _, err = readFileHeader(r); err != nil {
+		return nil, err
+	}
+
+	index = &BlockIndex{
+		Version:  blockIndexVersion,
+		FileSize: fileHeaderSize,
+	}
+
+	var blocks = blockReader{r: r, flags: header.Flags}
+	for {
+		if err = blocks.next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		var entry = BlockIndexEntry{
+			Offset:     index.FileSize,
+			NumRecords: blocks.header.NumRecords,
+			Size:       blocks.header.Size,
+			ID:         blocks.header.ID,
+		}
+		index.FileSize += blockHeaderSize + int64(blocks.header.Size)
+
+		if blocks.header.ID == dataBlockID {
+			if data, err = blocks.data(); err != nil {
+				return nil, err
+			}
+			if err = entry.scan(data); err != nil {
+				return nil, fmt.Errorf("blockIndex:%d %w", blocks.index, err)
+			}
+		}
+
+		index.Blocks = append(index.Blocks, entry)
+	}
+
+	return index, nil
+}
+
+// scan collect flow count, time range and meta flag of decompressed block data
+func (entry *BlockIndexEntry) scan(data []byte) error {
+	var records = newRecordIter(data)
+	for {
+		if ok, err := records.next(); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+
+		switch records.recordType {
+		case 10:
+			var firstMS, lastMS, ok = flowTimeRange(records.record())
+			if !ok {
+				return fmt.Errorf("Corrupt file, bad flow record size:%d", records.size)
+			}
+			if entry.Flows == 0 || firstMS < entry.FirstMS {
+				entry.FirstMS = firstMS
+			}
+			if lastMS > entry.LastMS {
+				entry.LastMS = lastMS
+			}
+			entry.Flows++
+		case EmptyRecordHeadType:
+		default:
+			entry.Meta = true
+		}
+	}
+}
+
+// Write write index as JSON sidecar
+func (index *BlockIndex) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(index)
+}
+
+// ReadBlockIndex read index written by BlockIndex.Write
+func ReadBlockIndex(r io.Reader) (index *BlockIndex, err error) {
+	index = &BlockIndex{}
+	if err = json.NewDecoder(r).Decode(index); err != nil {
+		return nil, err
+	}
+	if index.Version != blockIndexVersion {
+		return nil, fmt.Errorf("Unsupported block index version:%d", index.Version)
+	}
+	return index, nil
+}
+
+// BlockIndexFile return block index of the nfdump file at path. The index is read from the
+// sidecar path+BlockIndexSuffix when it exists and matches the file size, otherwise it is built
+// from the file and the sidecar is written. Failing to write the sidecar is not an error, e.g. for
+// read only archives, the index is then built again next time.
+func BlockIndexFile(path string) (index *BlockIndex, err error) {
+	var stat os.FileInfo
+	if stat, err = os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	var sidecar = path + BlockIndexSuffix
+	if f, err := os.Open(sidecar); err == nil {
+		index, err = ReadBlockIndex(f)
+		f.Close()
+		if err == nil && index.FileSize == stat.Size() {
+			return index, nil
+		}
+	}
+
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if index, err = BuildBlockIndex(bufio.NewReader(f)); err != nil {
+		return nil, err
+	}
+
+	writeFileAtomic(sidecar, index.Write)
+	return index, nil
+}
+
+// writeFileAtomic write path with a temporary file and rename, so readers never see a partial file
+func writeFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)); err != nil {
+		return err
+	}
+	if err = write(tmp); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// flowTimeRange return start and end time in milliseconds of a flow record, data is the complete
+// record starting at the record header
+func flowTimeRange(data []byte) (firstMS int64, lastMS int64, ok bool) {
+	if len(data) < 20 {
+		return 0, 0, false
+	}
+	firstMS = int64(binary.LittleEndian.Uint32(data[12:16]))*1000 + int64(binary.LittleEndian.Uint16(data[8:10]))
+	lastMS = int64(binary.LittleEndian.Uint32(data[16:20]))*1000 + int64(binary.LittleEndian.Uint16(data[10:12]))
+	return firstMS, lastMS, true
+}
+
+// timePruner decides which files, blocks and records can be part of a time range
+type timePruner struct {
+	startMS int64
+	endMS   int64
+	index   *BlockIndex
+	skipped int
+}
+
+// newTimePruner create timePruner for records completely inside [start, end], a zero start or end
+// is unbounded. index is optional.
+func newTimePruner(start time.Time, end time.Time, index *BlockIndex) *timePruner {
+	var tp = &timePruner{
+		startMS: math.MinInt64,
+		endMS:   math.MaxInt64,
+		index:   index,
+	}
+	if !start.IsZero() {
+		tp.startMS = start.UnixNano() / int64(time.Millisecond)
+	}
+	if !end.IsZero() {
+		tp.endMS = end.UnixNano() / int64(time.Millisecond)
+	}
+	return tp
+}
+
+// outside true when no record between firstMS and lastMS can be inside the time range
+func (tp *timePruner) outside(firstMS int64, lastMS int64) bool {
+	return lastMS < tp.startMS || firstMS > tp.endMS
+}
+
+// skipFile true when the stat record time range of a file is outside the time range
+func (tp *timePruner) skipFile(stat NFStatRecord) bool {
+	// Stat record without time range, can not tell
+	if stat.FirstSeen == 0 && stat.LastSeen == 0 {
+		return false
+	}
+	return tp.outside(int64(stat.FirstSeen)*1000+int64(stat.MSecFirst), int64(stat.LastSeen)*1000+int64(stat.MSecLast))
+}
+
+// skipBlock true when the 1 based block can be skipped according to the block index. Blocks with
+// meta records are never skipped and an index not matching the block header is ignored.
+func (tp *timePruner) skipBlock(blockIndex int, header NFBlockHeader) bool {
+	if tp.index == nil || blockIndex < 1 || blockIndex > len(tp.index.Blocks) {
+		return false
+	}
+
+	var entry = tp.index.Blocks[blockIndex-1]
+	if entry.NumRecords != header.NumRecords || entry.Size != header.Size || entry.ID != header.ID || entry.Meta {
+		return false
+	}
+	if entry.Flows > 0 && !tp.outside(entry.FirstMS, entry.LastMS) {
+		return false
+	}
+
+	tp.skipped++
+	return true
+}
+
+// match true when record is completely inside the time range
+func (tp *timePruner) match(record *NFRecord) bool {
+	return record.StartTimeMS() >= tp.startMS && record.EndTimeMS() <= tp.endMS
+}
+
+// skipBytes skip n bytes of r, seeks when r is an io.Seeker
+func skipBytes(r io.Reader, n int64) (err error) {
+	if s, ok := r.(io.Seeker); ok {
+		_, err = s.Seek(n, io.SeekCurrent)
+		return err
+	}
+	_, err = io.CopyN(ioutil.Discard, r, n)
+	return err
+}
@@ -0,0 +1,251 @@
+package nfdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// splitTestFile rewrite the small test file uncompressed with all meta records in the first block
+// and every flow record in a block of its own
+func splitTestFile(t *testing.T) []byte {
+	var small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r = bytes.NewReader(small)
+	var header NFHeader
+	var stat NFStatRecord
+	if header, stat, err = readFileHeader(r); err != nil {
+		t.Fatal(err)
+	}
+
+	var blockHeader NFBlockHeader
+	if err = binary.Read(r, binary.LittleEndian, &blockHeader); err != nil {
+		t.Fatal(err)
+	}
+	var blockData = make([]byte, blockHeader.Size)
+	if _, err = io.ReadFull(r, blockData); err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	if data, err = decompressBlock(header.Flags, blockData); err != nil {
+		t.Fatal(err)
+	}
+
+	var meta []byte
+	var metaRecords uint32
+	var flows [][]byte
+	for start := 0; start < len(data); {
+		var size = int(binary.LittleEndian.Uint16(data[start+2:]))
+		if binary.LittleEndian.Uint16(data[start:]) == 10 {
+			flows = append(flows, data[start:start+size])
+		} else {
+			meta = append(meta, data[start:start+size]...)
+			metaRecords++
+		}
+		start += size
+	}
+
+	var buf bytes.Buffer
+	header.Flags = 0
+	header.NumBlocks = uint32(1 + len(flows))
+	binary.Write(&buf, binary.LittleEndian, header)
+	binary.Write(&buf, binary.LittleEndian, stat)
+	binary.Write(&buf, binary.LittleEndian, NFBlockHeader{NumRecords: metaRecords, Size: uint32(len(meta)), ID: dataBlockID})
+	buf.Write(meta)
+	for _, flow := range flows {
+		binary.Write(&buf, binary.LittleEndian, NFBlockHeader{NumRecords: 1, Size: uint32(len(flow)), ID: dataBlockID})
+		buf.Write(flow)
+	}
+	return buf.Bytes()
+}
+
+func TestBuildBlockIndex(t *testing.T) {
+	var data = splitTestFile(t)
+
+	var index, err = BuildBlockIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("BuildBlockIndex error:%v", err)
+	}
+
+	if index.FileSize != int64(len(data)) || len(index.Blocks) != 11 {
+		t.Fatalf("Unexpected index size:%d blocks:%d", index.FileSize, len(index.Blocks))
+	}
+	if first := index.Blocks[0]; !first.Meta || first.Flows != 0 || first.Offset != fileHeaderSize {
+		t.Errorf("Unexpected first block:%+v", first)
+	}
+	for x, entry := range index.Blocks[1:] {
+		var previous = index.Blocks[x]
+		if entry.Meta || entry.Flows != 1 || entry.FirstMS == 0 || entry.LastMS < entry.FirstMS {
+			t.Errorf("Unexpected block %d:%+v", x+2, entry)
+		}
+		if entry.Offset != previous.Offset+blockHeaderSize+int64(previous.Size) {
+			t.Errorf("Unexpected block %d offset:%d", x+2, entry.Offset)
+		}
+	}
+
+	var small []byte
+	if small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo"); err != nil {
+		t.Fatal(err)
+	}
+	if index, err = BuildBlockIndex(bytes.NewReader(small)); err != nil {
+		t.Fatalf("BuildBlockIndex error:%v", err)
+	}
+	var expected = BlockIndexEntry{Offset: 276, NumRecords: 7322, Size: 38635, ID: 2, Flows: 10, FirstMS: 1565633748049, LastMS: 1565635903101, Meta: true}
+	if len(index.Blocks) != 1 || index.Blocks[0] != expected {
+		t.Errorf("Unexpected index:%+v", index.Blocks)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	var data = splitTestFile(t)
+
+	var index, err = BuildBlockIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var small []byte
+	if small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo"); err != nil {
+		t.Fatal(err)
+	}
+	var stale *BlockIndex
+	if stale, err = BuildBlockIndex(bytes.NewReader(small)); err != nil {
+		t.Fatal(err)
+	}
+
+	var all *NFFile
+	if all, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var start = time.Date(2019, 8, 12, 18, 50, 48, 0, time.UTC)
+	var end = time.Date(2019, 8, 12, 18, 50, 48, 600*int(time.Millisecond), time.UTC)
+
+	var tests = []struct {
+		name    string
+		start   time.Time
+		end     time.Time
+		index   *BlockIndex
+		records int
+		skipped int
+	}{
+		{name: "index", start: start, end: end, index: index, records: 3, skipped: 3},
+		{name: "no index", start: start, end: end, records: 3},
+		{name: "stale index", start: start, end: end, index: stale, records: 3},
+		{name: "open start", end: end, index: index, records: 5, skipped: 1},
+		{name: "open end", start: end, index: index, records: 1, skipped: 5},
+		{name: "outside file", start: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), index: index},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var filter = TimeRangeFilter(tc.start, tc.end)
+			var expected []NFRecord
+			for _, record := range all.Records {
+				if filter.Match(&record) {
+					expected = append(expected, record)
+				}
+			}
+			if len(expected) != tc.records {
+				t.Fatalf("Unexpected filtered record count:%d expected %d", len(expected), tc.records)
+			}
+
+			var nfs *NFStream
+			if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			nfs.SetTimeRange(tc.start, tc.end, tc.index)
+
+			var records []NFRecord
+			var record NFRecord
+			for {
+				if record, err = nfs.Row(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Row error:%v", err)
+				}
+				records = append(records, record)
+			}
+			if !sameRecords(records, expected) {
+				t.Errorf("Unexpected stream records:%d expected %d", len(records), len(expected))
+			}
+			if nfs.SkippedBlocks() != tc.skipped {
+				t.Errorf("Unexpected skipped blocks:%d expected %d", nfs.SkippedBlocks(), tc.skipped)
+			}
+
+			var nff *NFFile
+			if nff, err = ParseReaderTimeRange(bytes.NewReader(data), tc.start, tc.end, tc.index); err != nil {
+				t.Fatalf("ParseReaderTimeRange error:%v", err)
+			}
+			if !sameRecords(nff.Records, expected) {
+				t.Errorf("Unexpected parsed records:%d expected %d", len(nff.Records), len(expected))
+			}
+		})
+	}
+}
+
+// sameRecords compare time, counters and ports of records
+func sameRecords(a []NFRecord, b []NFRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for x := range a {
+		if a[x].StartTimeMS() != b[x].StartTimeMS() || a[x].EndTimeMS() != b[x].EndTimeMS() ||
+			a[x].ByteCount != b[x].ByteCount || a[x].SrcPort != b[x].SrcPort || a[x].DstPort != b[x].DstPort {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBlockIndexFile(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "nfcapd.201908121850")
+	if err = ioutil.WriteFile(path, splitTestFile(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var index *BlockIndex
+	if index, err = BlockIndexFile(path); err != nil {
+		t.Fatalf("BlockIndexFile error:%v", err)
+	}
+
+	var f *os.File
+	if f, err = os.Open(path + BlockIndexSuffix); err != nil {
+		t.Fatalf("Sidecar not written:%v", err)
+	}
+	var sidecar *BlockIndex
+	sidecar, err = ReadBlockIndex(f)
+	f.Close()
+	if err != nil || !reflect.DeepEqual(sidecar, index) {
+		t.Errorf("Unexpected sidecar:%+v error:%v", sidecar, err)
+	}
+
+	// A sidecar not matching the file size is rebuilt
+	sidecar.FileSize = 1
+	sidecar.Blocks = nil
+	if f, err = os.Create(path + BlockIndexSuffix); err != nil {
+		t.Fatal(err)
+	}
+	sidecar.Write(f)
+	f.Close()
+
+	var rebuilt *BlockIndex
+	if rebuilt, err = BlockIndexFile(path); err != nil || !reflect.DeepEqual(rebuilt, index) {
+		t.Errorf("Unexpected rebuilt index:%+v error:%v", rebuilt, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chrispassas/nfdump"
+)
+
+// runHealth print sequence failures and traffic per exporter over time, from files given as
+// arguments or all files of -R in the -t time window
+func runHealth(args []string, stdout io.Writer) (err error) {
+	var asJSON bool
+	var opts options
+	var flags = flag.NewFlagSet("nfdump-go health", flag.ContinueOnError)
+	flags.BoolVar(&asJSON, "json", false, "print health report as JSON")
+	flags.StringVar(&opts.readDir, "R", "", "read all files in `directory` recursively")
+	flags.StringVar(&opts.timeWindow, "t", "", "only files of time `window` yyyy/MM/dd.hh:mm:ss[-yyyy/MM/dd.hh:mm:ss]")
+	flags.StringVar(&opts.timeZone, "z", "Local", "time zone `name` used to print times, e.g. UTC")
+
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	if (opts.readDir == "") == (flags.NArg() == 0) {
+		return fmt.Errorf("health requires either -R or files")
+	}
+
+	var location *time.Location
+	if location, err = time.LoadLocation(opts.timeZone); err != nil {
+		return err
+	}
+
+	var files []nfdump.CaptureFile
+	if opts.readDir != "" {
+		var start, end time.Time
+		if opts.timeWindow != "" {
+			if start, end, err = parseTimeWindow(opts.timeWindow, location); err != nil {
+				return err
+			}
+		}
+		if files, err = selectFiles(opts, start, end, location); err != nil {
+			return err
+		}
+	} else {
+		for _, file := range flags.Args() {
+			files = append(files, nfdump.CaptureFile{Path: file})
+		}
+	}
+
+	var report []nfdump.ExporterHealth
+	if report, err = nfdump.ExporterHealthReport(files); err != nil {
+		return err
+	}
+
+	var out = bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	if asJSON {
+		return json.NewEncoder(out).Encode(report)
+	}
+	return writeHealth(out, report, location)
+}
+
+// writeHealth print human readable health report, one line per exporter followed by its intervals
+func writeHealth(w io.Writer, report []nfdump.ExporterHealth, location *time.Location) error {
+	var timeFormat = "2006-01-02 15:04:05"
+
+	for _, health := range report {
+		var e = health.Exporter
+		fmt.Fprintf(w, "%s version %d id %d: sequence failures %d, flows %d, packets %d\n",
+			e.IPAddr, e.Version, e.ID, health.SequenceFailures, health.Flows, health.Packets)
+		for _, interval := range health.Intervals {
+			fmt.Fprintf(w, "  %s %s: sequence failures %d, flows %d, packets %d\n",
+				interval.Time.In(location).Format(timeFormat), interval.Path,
+				interval.SequenceFailures, interval.Flows, interval.Packets)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "Exporters: %d\n", len(report))
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/chrispassas/nfdump"
+)
+
+// runInfo print file header, stat record, exporters and extension maps of every file like nfdump -I
+func runInfo(args []string, stdout io.Writer) (err error) {
+	var asJSON bool
+	var timeZone string
+	var flags = flag.NewFlagSet("nfdump-go info", flag.ContinueOnError)
+	flags.BoolVar(&asJSON, "json", false, "print file info as JSON")
+	flags.StringVar(&timeZone, "z", "Local", "time zone `name` used to print times, e.g. UTC")
+
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("info requires at least one file")
+	}
+
+	var location *time.Location
+	if location, err = time.LoadLocation(timeZone); err != nil {
+		return err
+	}
+
+	var out = bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	var enc = json.NewEncoder(out)
+	for _, file := range flags.Args() {
+		var info *nfdump.FileInfo
+		if info, err = fileInfo(file); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		if asJSON {
+			err = enc.Encode(info)
+		} else {
+			err = writeInfo(out, file, info, location)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileInfo open file and collect its FileInfo
+func fileInfo(file string) (info *nfdump.FileInfo, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return nfdump.Info(bufio.NewReader(f))
+}
+
+// writeInfo print human readable file info
+func writeInfo(w io.Writer, file string, info *nfdump.FileInfo, location *time.Location) error {
+	var timeFormat = "2006-01-02 15:04:05.000"
+	var s = info.StatRecord
+
+	fmt.Fprintf(w, "File       : %s\n", file)
+	fmt.Fprintf(w, "Ident      : %s\n", info.Ident)
+	fmt.Fprintf(w, "Version    : %d\n", info.LayoutVersion)
+	fmt.Fprintf(w, "Compression: %s\n", info.Compression)
+	fmt.Fprintf(w, "Anonymized : %t\n", info.Anonymized)
+	fmt.Fprintf(w, "Catalog    : %t\n", info.Catalog)
+	fmt.Fprintf(w, "Blocks     : %d\n", info.NumBlocks)
+	fmt.Fprintf(w, "Records    : %d\n", info.RecordCount)
+	fmt.Fprintf(w, "First      : %s\n", info.FirstSeen.In(location).Format(timeFormat))
+	fmt.Fprintf(w, "Last       : %s\n", info.LastSeen.In(location).Format(timeFormat))
+	fmt.Fprintf(w, "Flows      : %d (tcp %d, udp %d, icmp %d, other %d)\n",
+		s.NumFlows, s.NumFlowsTCP, s.NumFlowsUDP, s.NumFlowsICMP, s.NumFlowsOther)
+	fmt.Fprintf(w, "Packets    : %d (tcp %d, udp %d, icmp %d, other %d)\n",
+		s.NumPackets, s.NumPacketsTCP, s.NumPacketsUDP, s.NumPacketsICMP, s.NumPacketsOther)
+	fmt.Fprintf(w, "Bytes      : %d (tcp %d, udp %d, icmp %d, other %d)\n",
+		s.NumBytes, s.NumBytesTCP, s.NumBytesUDP, s.NumBytesICMP, s.NumBytesOther)
+	fmt.Fprintf(w, "Seq errors : %d\n", s.SequenceFailure)
+
+	fmt.Fprintf(w, "Exporters  : %d\n", len(info.Exporters))
+	for _, e := range info.Exporters {
+		fmt.Fprintf(w, "  SysID %d: %s version %d id %d, flows %d, packets %d, sequence failures %d\n",
+			e.Exporter.SysID, e.Exporter.IPAddr, e.Exporter.Version, e.Exporter.ID,
+			e.Stats.Flows, e.Stats.Packets, e.Stats.SequenceFailures)
+		for _, sampler := range e.Samplers {
+			fmt.Fprintf(w, "    Sampler %d: mode %d interval %d\n", int32(sampler.ID), sampler.Mode, sampler.Interval)
+		}
+	}
+
+	var mapIDs []int
+	for mapID := range info.ExtensionMaps {
+		mapIDs = append(mapIDs, int(mapID))
+	}
+	sort.Ints(mapIDs)
+	fmt.Fprintf(w, "Ext maps   : %d\n", len(mapIDs))
+	for _, mapID := range mapIDs {
+		fmt.Fprintf(w, "  Map %d: %v\n", mapID, info.ExtensionMaps[uint16(mapID)])
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
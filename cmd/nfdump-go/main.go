@@ -0,0 +1,323 @@
+/*
+Command nfdump-go reads nfdump files and prints, aggregates or summarizes their records.
+
+It is a static Go replacement for the common nfdump CLI use cases:
+
+	nfdump-go -r nfcapd.201908121850 -o long 'proto tcp and dst port 443'
+	nfdump-go -R /data/nfcapd -t 2019/08/12.18:50-2019/08/12.19:00 -A srcip,dstport -o csv
+	nfdump-go -r nfcapd.201908121850 -s dstip/bytes -n 20
+
+Everything after the flags is used as nfdump filter expression.
+
+The info subcommand prints header, statistics, exporters and extension maps of files and the
+verify subcommand checks block counts and statistics against the actual file contents:
+
+	nfdump-go info [-json] nfcapd.201908121850 ...
+	nfdump-go verify [-json] nfcapd.201908121850 ...
+
+The health subcommand prints sequence failures and traffic of every exporter over time:
+
+	nfdump-go health [-json] [-z UTC] -R /data/nfcapd -t 2019/08/12
+	nfdump-go health nfcapd.201908121850 nfcapd.201908121855 ...
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chrispassas/nfdump"
+	"github.com/chrispassas/nfdump/filter"
+	"github.com/chrispassas/nfdump/stats"
+)
+
+// timeLayouts accepted -t time formats, same as nfdump
+var timeLayouts = []string{
+	"2006/01/02.15:04:05",
+	"2006/01/02.15:04",
+	"2006/01/02.15",
+	"2006/01/02",
+}
+
+// options command line options
+type options struct {
+	readFile   string
+	readDir    string
+	timeWindow string
+	aggregate  bool
+	aggKeys    string
+	stat       string
+	topN       int
+	format     string
+	limit      int
+	quiet      bool
+	noScale    bool
+	timeZone   string
+	filter     string
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "nfdump-go: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parse arguments and process files, output is written to stdout
+func run(args []string, stdout io.Writer) (err error) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "info":
+			return runInfo(args[1:], stdout)
+		case "verify":
+			return runVerify(args[1:], stdout)
+		case "health":
+			return runHealth(args[1:], stdout)
+		}
+	}
+
+	var opts options
+	var flags = flag.NewFlagSet("nfdump-go", flag.ContinueOnError)
+	flags.StringVar(&opts.readFile, "r", "", "read from `file`")
+	flags.StringVar(&opts.readDir, "R", "", "read all files in `directory` recursively")
+	flags.StringVar(&opts.timeWindow, "t", "", "only flows completely inside time `window` yyyy/MM/dd.hh:mm:ss[-yyyy/MM/dd.hh:mm:ss]")
+	flags.BoolVar(&opts.aggregate, "a", false, "aggregate flows by srcip,dstip,srcport,dstport,proto")
+	flags.StringVar(&opts.aggKeys, "A", "", "aggregate flows by comma separated `keys`, e.g. srcip4/24,dstport")
+	flags.StringVar(&opts.stat, "s", "", "print Top N statistic `element[/order]`, e.g. dstip/bytes")
+	flags.IntVar(&opts.topN, "n", 10, "number of entries printed by -s, 0 prints all")
+	flags.StringVar(&opts.format, "o", "line", "output `format`: line, long, extended, line6, long6, extended6, csv, json or fmt:<template>")
+	flags.IntVar(&opts.limit, "c", 0, "limit number of records printed, 0 prints all")
+	flags.BoolVar(&opts.quiet, "q", false, "do not print header and summary")
+	flags.BoolVar(&opts.noScale, "N", false, "print plain numbers instead of scaled M/G/T values")
+	flags.StringVar(&opts.timeZone, "z", "Local", "time zone `name` used to print times, e.g. UTC")
+
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	opts.filter = strings.Join(flags.Args(), " ")
+
+	if (opts.readFile == "") == (opts.readDir == "") {
+		return fmt.Errorf("exactly one of -r or -R is required")
+	}
+
+	return process(opts, stdout)
+}
+
+// selectFiles return files to read in capture time order, -R only selects files of the time window
+func selectFiles(opts options, start time.Time, end time.Time, location *time.Location) (files []nfdump.CaptureFile, err error) {
+	if opts.readFile != "" {
+		return []nfdump.CaptureFile{{Path: opts.readFile}}, nil
+	}
+
+	return nfdump.SelectFiles(nfdump.FileSelection{
+		Dir:      opts.readDir,
+		Start:    start,
+		End:      end,
+		Location: location,
+	})
+}
+
+// parseTimeWindow parse nfdump -t time window, a single time selects everything from that time on
+func parseTimeWindow(window string, location *time.Location) (start time.Time, end time.Time, err error) {
+	var parts = strings.SplitN(window, "-", 2)
+	if start, err = parseTime(parts[0], location); err != nil {
+		return start, end, err
+	}
+	if len(parts) == 1 {
+		return start, end, nil
+	}
+	if end, err = parseTime(parts[1], location); err != nil {
+		return start, end, err
+	}
+	if end.Before(start) {
+		return start, end, fmt.Errorf("time window end before start:%s", window)
+	}
+	return start, end, nil
+}
+
+func parseTime(value string, location *time.Location) (t time.Time, err error) {
+	for _, layout := range timeLayouts {
+		if t, err = time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("invalid time:%s", value)
+}
+
+// recordWriter common interface of text and JSON output
+type recordWriter interface {
+	Write(record *nfdump.NFRecord) error
+}
+
+// process read all files and print records, aggregates or statistics
+func process(opts options, stdout io.Writer) (err error) {
+	var location *time.Location
+	if location, err = time.LoadLocation(opts.timeZone); err != nil {
+		return err
+	}
+
+	var recordFilter *filter.Filter
+	if recordFilter, err = filter.Compile(opts.filter); err != nil {
+		return err
+	}
+
+	var start, end time.Time
+	if opts.timeWindow != "" {
+		if start, end, err = parseTimeWindow(opts.timeWindow, location); err != nil {
+			return err
+		}
+	}
+
+	var files []nfdump.CaptureFile
+	if files, err = selectFiles(opts, start, end, location); err != nil {
+		return err
+	}
+
+	var nfm = nfdump.OpenFiles(files)
+	defer nfm.Close()
+
+	nfm.SetFilter(recordFilter)
+	if opts.timeWindow != "" {
+		nfm.SetTimeRange(start, end)
+	}
+
+	var aggregator *nfdump.Aggregator
+	if opts.aggregate || opts.aggKeys != "" {
+		if aggregator, err = nfdump.NewAggregator(opts.aggKeys); err != nil {
+			return err
+		}
+	}
+
+	var stat *stats.Stat
+	if opts.stat != "" {
+		if stat, err = stats.New(opts.stat); err != nil {
+			return err
+		}
+	}
+
+	var out = bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	var writer recordWriter
+	if opts.format == "json" {
+		var ndjson = nfdump.NewNDJSONWriter(out)
+		ndjson.SetExporters(nfm.Exporters)
+		writer = ndjson
+	} else {
+		var formatter *nfdump.Formatter
+		if formatter, err = nfdump.NewFormatter(out, opts.format); err != nil {
+			return err
+		}
+		formatter.SetLocation(location)
+		formatter.SetScale(!opts.noScale)
+		if !opts.quiet && stat == nil {
+			if err = formatter.WriteHeader(); err != nil {
+				return err
+			}
+		}
+		writer = formatter
+	}
+
+	var printed int
+	var write = func(record *nfdump.NFRecord) error {
+		if opts.limit > 0 && printed >= opts.limit {
+			return nil
+		}
+		printed++
+		return writer.Write(record)
+	}
+
+	var summary nfdump.NFStatRecord
+	var record nfdump.NFRecord
+	for {
+		if record, err = nfm.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		addSummary(&summary, &record)
+		if aggregator != nil {
+			aggregator.Add(record)
+		} else if stat != nil {
+			stat.Add(&record)
+		} else if err = write(&record); err != nil {
+			return err
+		} else if opts.limit > 0 && printed >= opts.limit {
+			// Nothing else is printed, stop reading
+			break
+		}
+	}
+
+	if aggregator != nil {
+		for _, record := range aggregator.Records() {
+			if stat != nil {
+				stat.Add(&record)
+			} else if err = write(&record); err != nil {
+				return err
+			}
+		}
+	}
+
+	if stat != nil {
+		// Percentages relative to the file totals only make sense when every flow was counted
+		if opts.filter == "" && opts.timeWindow == "" {
+			stat.SetTotals(nfm.StatRecord)
+		}
+		return writeStat(out, stat.Top(opts.topN), location, opts.noScale)
+	}
+
+	if !opts.quiet && opts.format != "json" && opts.format != "csv" {
+		fmt.Fprintf(out, "Summary: total flows: %d, total bytes: %d, total packets: %d, files: %d\n",
+			summary.NumFlows, summary.NumBytes, summary.NumPackets, len(files))
+	}
+	return nil
+}
+
+// addSummary add record to the summary totals, an aggregated record counts its AggeFlows like nfdump
+func addSummary(summary *nfdump.NFStatRecord, record *nfdump.NFRecord) {
+	var flows = record.AggeFlows
+	if flows == 0 {
+		flows = 1
+	}
+
+	summary.NumFlows += flows
+	summary.NumPackets += record.PacketCount
+	summary.NumBytes += record.ByteCount
+}
+
+// writeStat print Top N table like nfdump -s
+func writeStat(w io.Writer, table *stats.Table, location *time.Location, noScale bool) (err error) {
+	var number = func(n uint64) string {
+		return nfdump.FormatNumber(n, !noScale)
+	}
+
+	fmt.Fprintf(w, "Top %d %s ordered by %s:\n", len(table.Entries), table.Element, table.Order)
+	fmt.Fprintf(w, "%-23s %9s %39s %14s %16s %16s %8s %8s %5s\n",
+		"Date first seen", "Duration", table.Element, "Flows(%)", "Packets(%)", "Bytes(%)", "pps", "bps", "bpp")
+
+	for _, entry := range table.Entries {
+		var first = time.Unix(0, entry.FirstMS*int64(time.Millisecond)).In(location)
+		if _, err = fmt.Fprintf(w, "%-23s %9.3f %39s %14s %16s %16s %8s %8s %5d\n",
+			first.Format("2006-01-02 15:04:05.000"),
+			float64(entry.DurationMilliseconds())/1000,
+			entry.Key,
+			fmt.Sprintf("%s(%4.1f)", number(entry.Flows), entry.FlowsPercent),
+			fmt.Sprintf("%s(%4.1f)", number(entry.Packets), entry.PacketsPercent),
+			fmt.Sprintf("%s(%4.1f)", number(entry.Bytes), entry.BytesPercent),
+			number(entry.PPS()),
+			number(entry.BPS()),
+			entry.BPP()); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "\nSummary: total flows: %d, total bytes: %d, total packets: %d, distinct %s: %d\n",
+		table.Totals.NumFlows, table.Totals.NumBytes, table.Totals.NumPackets, table.Element, table.Distinct)
+	return err
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrispassas/nfdump"
+	"github.com/chrispassas/nfdump/stats"
+)
+
+var testFile = "../../testdata/nfcapd-small-lzo"
+
+func TestRun(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var data []byte
+	if data, err = ioutil.ReadFile(testFile); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "nfcapd.201908121850"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name  string
+		args  []string
+		lines int
+		first string
+	}{
+		{name: "line", args: []string{"-r", testFile, "-z", "UTC"}, lines: 12, first: "Date first seen"},
+		{name: "filter", args: []string{"-r", testFile, "-q", "-z", "UTC", "proto", "tcp", "and", "dst", "port", "443"}, lines: 3, first: "2019-08-12 18:50:48.042"},
+		{name: "limit", args: []string{"-r", testFile, "-q", "-c", "2"}, lines: 2},
+		{name: "csv", args: []string{"-r", testFile, "-o", "csv", "-z", "UTC"}, lines: 11, first: "ts,te,td"},
+		{name: "json", args: []string{"-r", testFile, "-o", "json", "src as 33363"}, lines: 3, first: `{"first":"2019-08-12T18:15:48.049Z"`},
+		{name: "aggregate", args: []string{"-r", testFile, "-q", "-A", "proto", "-o", "fmt:%pr %fl"}, lines: 2, first: "TCP       6"},
+		{name: "stat", args: []string{"-r", testFile, "-s", "dstport/bytes", "-n", "3"}, lines: 7, first: "Top 3 dstport ordered by bytes:"},
+		{name: "window", args: []string{"-R", dir, "-q", "-z", "UTC", "-t", "2019/08/12.18:50:47-2019/08/12.18:50:49"}, lines: 6},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := run(tc.args, &buf); err != nil {
+				t.Fatalf("run error:%v", err)
+			}
+
+			var lines = strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+			if len(lines) != tc.lines {
+				t.Errorf("Unexpected line count:%d expected %d\n%s", len(lines), tc.lines, buf.String())
+			}
+			if !strings.HasPrefix(lines[0], tc.first) {
+				t.Errorf("Unexpected first line:%q expected prefix %q", lines[0], tc.first)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	var tests = [][]string{
+		{},
+		{"-r", testFile, "-R", "../../testdata"},
+		{"-r", testFile, "proto foo"},
+		{"-r", testFile, "-o", "foo"},
+		{"-r", testFile, "-t", "yesterday"},
+		{"-r", "does-not-exist"},
+	}
+
+	for _, args := range tests {
+		if err := run(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("run(%q) expected error", args)
+		}
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	var start, end time.Time
+	var err error
+	if start, end, err = parseTimeWindow("2019/08/12.18:50-2019/08/12.19", time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if start != time.Date(2019, 8, 12, 18, 50, 0, 0, time.UTC) || end != time.Date(2019, 8, 12, 19, 0, 0, 0, time.UTC) {
+		t.Errorf("Unexpected window start:%s end:%s", start, end)
+	}
+
+	if _, _, err = parseTimeWindow("2019/08/12.19:00-2019/08/12.18:00", time.UTC); err == nil {
+		t.Errorf("Expected error for end before start")
+	}
+}
+
+func TestAddSummary(t *testing.T) {
+	var summary nfdump.NFStatRecord
+	addSummary(&summary, &nfdump.NFRecord{PacketCount: 2, ByteCount: 100})
+	addSummary(&summary, &nfdump.NFRecord{AggeFlows: 5, PacketCount: 10, ByteCount: 1000})
+	if summary.NumFlows != 6 || summary.NumPackets != 12 || summary.NumBytes != 1100 {
+		t.Errorf("Unexpected summary flows:%d packets:%d bytes:%d", summary.NumFlows, summary.NumPackets, summary.NumBytes)
+	}
+}
+
+func TestRunLimit(t *testing.T) {
+	// Reading stops after the limit, the summary only counts the records read
+	var buf bytes.Buffer
+	if err := run([]string{"-r", testFile, "-c", "2"}, &buf); err != nil {
+		t.Fatalf("run error:%v", err)
+	}
+	if !strings.Contains(buf.String(), "Summary: total flows: 2,") {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestWriteStat(t *testing.T) {
+	var table = &stats.Table{
+		Element: "dstport",
+		Order:   "bytes",
+		Entries: []stats.Entry{{Key: "443", Flows: 1, Packets: 2 * 1000 * 1000, Bytes: 3 * 1000 * 1000 * 1000 * 1000}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeStat(&buf, table, time.UTC, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "2.0 M(") || !strings.Contains(buf.String(), "3.0 T(") {
+		t.Errorf("Unexpected scaled output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeStat(&buf, table, time.UTC, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "3000000000000(") {
+		t.Errorf("Unexpected unscaled output:\n%s", buf.String())
+	}
+}
+
+func TestRunInfo(t *testing.T) {
+	var buf bytes.Buffer
+	if err := run([]string{"info", "-z", "UTC", testFile}, &buf); err != nil {
+		t.Fatalf("run error:%v", err)
+	}
+	for _, expected := range []string{"Compression: lzo\n", "Records    : 10\n", "First      : 2019-08-12 18:"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Missing %q in output:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := run([]string{"info", "-json", testFile}, &buf); err != nil {
+		t.Fatalf("run error:%v", err)
+	}
+	if !strings.Contains(buf.String(), `"RecordCount":10`) {
+		t.Errorf("Unexpected JSON output:\n%s", buf.String())
+	}
+
+	if err := run([]string{"info"}, &buf); err == nil {
+		t.Errorf("Expected error without files")
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	var buf bytes.Buffer
+	if err := run([]string{"verify", testFile}, &buf); err != nil {
+		t.Fatalf("run error:%v", err)
+	}
+	if buf.String() != testFile+": OK\n" {
+		t.Errorf("Unexpected output:%q", buf.String())
+	}
+
+	buf.Reset()
+	var corrupt = "../../testdata/nfcapd-corrupt"
+	if err := run([]string{"verify", testFile, corrupt}, &buf); err == nil || err.Error() != "1 of 2 files failed verification" {
+		t.Errorf("Unexpected error:%v", err)
+	}
+	if !strings.Contains(buf.String(), corrupt+": FAILED\n  block 1: Data bad record size:0 at offset:0\n  block 1: NumRecords expected 39181 actual 0\n") {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := run([]string{"verify", "-json", testFile}, &buf); err != nil {
+		t.Fatalf("run error:%v", err)
+	}
+	if !strings.Contains(buf.String(), `"ok":true`) {
+		t.Errorf("Unexpected JSON output:\n%s", buf.String())
+	}
+}
+
+func TestRunHealth(t *testing.T) {
+	var buf bytes.Buffer
+	if err := run([]string{"health", "-z", "UTC", testFile}, &buf); err != nil {
+		t.Fatalf("run error:%v", err)
+	}
+	var expected = "  2019-08-12 18:15:48 " + testFile + ": sequence failures 0, flows 0, packets 0\n"
+	if !strings.Contains(buf.String(), expected) || !strings.Contains(buf.String(), "\nExporters: ") {
+		t.Errorf("Missing %q in output:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := run([]string{"health", "-json", testFile}, &buf); err != nil {
+		t.Fatalf("run error:%v", err)
+	}
+	if !strings.Contains(buf.String(), `"Intervals":[{"Path":"`+testFile+`"`) {
+		t.Errorf("Unexpected JSON output:\n%.200s", buf.String())
+	}
+
+	if err := run([]string{"health"}, &buf); err == nil {
+		t.Errorf("Expected error without files")
+	}
+	if err := run([]string{"health", "-R", "../../testdata", testFile}, &buf); err == nil {
+		t.Errorf("Expected error with -R and files")
+	}
+}
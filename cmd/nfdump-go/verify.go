@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chrispassas/nfdump"
+)
+
+// runVerify check header, block record counts and stat record of every file, returns an error when
+// any file has discrepancies so scripts can rely on the exit status
+func runVerify(args []string, stdout io.Writer) (err error) {
+	var asJSON bool
+	var flags = flag.NewFlagSet("nfdump-go verify", flag.ContinueOnError)
+	flags.BoolVar(&asJSON, "json", false, "print verify report as JSON")
+
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("verify requires at least one file")
+	}
+
+	var out = bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	var enc = json.NewEncoder(out)
+	var failed int
+	for _, file := range flags.Args() {
+		var report *nfdump.VerifyReport
+		if report, err = verifyFile(file); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if !report.OK() {
+			failed++
+		}
+
+		if asJSON {
+			if err = enc.Encode(struct {
+				File string `json:"file"`
+				OK   bool   `json:"ok"`
+				*nfdump.VerifyReport
+			}{File: file, OK: report.OK(), VerifyReport: report}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if report.OK() {
+			fmt.Fprintf(out, "%s: OK\n", file)
+			continue
+		}
+		fmt.Fprintf(out, "%s: FAILED\n", file)
+		for _, d := range report.Discrepancies {
+			fmt.Fprintf(out, "  %s\n", d)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, flags.NArg())
+	}
+	return nil
+}
+
+// verifyFile open and verify a single file
+func verifyFile(file string) (report *nfdump.VerifyReport, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return nfdump.Verify(bufio.NewReader(f))
+}
@@ -0,0 +1,51 @@
+package nfdump
+
+import (
+	"context"
+)
+
+// RowContext like Row, returns the error of ctx when ctx is done before the next block is read.
+// Records of a block already read are returned regardless of ctx.
+func (nfs *NFStream) RowContext(ctx context.Context) (record NFRecord, err error) {
+	nfs.ctx = ctx
+	defer func() { nfs.ctx = nil }()
+	return nfs.Row()
+}
+
+// RowContext like Row, returns the error of ctx when ctx is done before the next block or file is
+// read
+func (nfm *NFMultiStream) RowContext(ctx context.Context) (record NFRecord, err error) {
+	nfm.ctx = ctx
+	defer func() { nfm.ctx = nil }()
+	return nfm.Row()
+}
+
+// RowContext like Row, returns the error of ctx when ctx is done before the next block of any
+// stream is read. No record is lost, the next Row continues with the same record.
+func (nfm *NFMergeStream) RowContext(ctx context.Context) (record NFRecord, err error) {
+	nfm.ctx = ctx
+	defer func() { nfm.ctx = nil }()
+	return nfm.Row()
+}
+
+// RowContext like Row, returns the error of ctx when ctx is done while waiting for new data or
+// before the next block is read. Waiting only happens between blocks, the next Row continues with
+// the following record.
+func (nff *NFFollowStream) RowContext(ctx context.Context) (record NFRecord, err error) {
+	nff.ctx = ctx
+	defer func() { nff.ctx = nil }()
+	return nff.Row()
+}
+
+// streamRow Row of nfs checking ctx before every block, ctx may be nil
+func streamRow(nfs *NFStream, ctx context.Context) (NFRecord, error) {
+	if ctx == nil {
+		return nfs.Row()
+	}
+	return nfs.RowContext(ctx)
+}
+
+// canceled true when err is the error of ctx being done, ctx may be nil
+func canceled(ctx context.Context, err error) bool {
+	return ctx != nil && err != nil && err == ctx.Err()
+}
@@ -0,0 +1,110 @@
+package nfdump
+
+import (
+	"encoding/json"
+)
+
+// ExporterIdentity identifies an exporter independent of the SysID nfcapd assigned to it in a file,
+// usable as map key to group records by exporter across files and collectors
+type ExporterIdentity struct {
+	// IP exporter address as string, IPv4 exporters in dotted notation
+	IP string
+	// Version NetFlow or IPFIX version
+	Version uint32
+	// ID exporter ID, observation domain ID for IPFIX and source ID for NetFlow v9
+	ID uint32
+}
+
+// Identity return identity of the exporter
+func (e NFExporterInfoRecord) Identity() ExporterIdentity {
+	return ExporterIdentity{IP: ipString(e.IPAddr), Version: e.Version, ID: e.ID}
+}
+
+// sameIdentity true when e and other have the same Identity, without allocating it
+func (e NFExporterInfoRecord) sameIdentity(other NFExporterInfoRecord) bool {
+	return e.Version == other.Version && e.ID == other.ID && e.IPAddr.Equal(other.IPAddr)
+}
+
+// RecordExporter exporter of a record resolved from its file local ExporterSysID
+type RecordExporter struct {
+	// SysID ExporterSysID of the record
+	SysID uint16
+	// Known false when the exporter record of SysID has not been read, Exporter is then empty
+	Known    bool
+	Exporter NFExporterInfoRecord
+	// HasSampler Sampler the sampler applying to the exporter flows, see SamplerInfo
+	HasSampler bool
+	Sampler    NFSamplerInfoRecord
+	// HasStats Stats exporter statistics. nfcapd writes them at the end of a file, streams only have
+	// them after the last record.
+	HasStats bool
+	Stats    NFExporterStatRecord
+}
+
+// Identity return identity of the exporter, the zero ExporterIdentity when the exporter is not known
+func (re RecordExporter) Identity() ExporterIdentity {
+	if !re.Known {
+		return ExporterIdentity{}
+	}
+	return re.Exporter.Identity()
+}
+
+// ExporterResolver resolves the exporter of records, implemented by NFFile and all streams
+type ExporterResolver interface {
+	Exporter(record *NFRecord) RecordExporter
+}
+
+// EnrichedRecord record with its resolved exporter
+type EnrichedRecord struct {
+	NFRecord
+	Exporter RecordExporter
+}
+
+// Enrich return record with its exporter resolved by resolver
+func Enrich(resolver ExporterResolver, record NFRecord) EnrichedRecord {
+	return EnrichedRecord{NFRecord: record, Exporter: resolver.Exporter(&record)}
+}
+
+// MarshalJSON encode record as RecordJSON with the exporter IP
+func (er EnrichedRecord) MarshalJSON() ([]byte, error) {
+	var rj = NewRecordJSON(&er.NFRecord, nil)
+	if er.Exporter.Known {
+		rj.ExporterIP = ipString(er.Exporter.Exporter.IPAddr)
+	}
+	return json.Marshal(rj)
+}
+
+// resolveExporter look up exporter, sampler and stats of sysID
+func resolveExporter(sysID uint16, exporters map[uint16]NFExporterInfoRecord, samplerInfo map[uint16]NFSamplerInfoRecord, stats map[uint32]NFExporterStatRecord) (re RecordExporter) {
+	re.SysID = sysID
+	re.Exporter, re.Known = exporters[sysID]
+	re.Sampler, re.HasSampler = samplerInfo[sysID]
+	re.Stats, re.HasStats = stats[uint32(sysID)]
+	return re
+}
+
+// Exporter return the resolved exporter of record
+func (nff *NFFile) Exporter(record *NFRecord) RecordExporter {
+	return resolveExporter(record.ExporterSysID, nff.Exporters, nff.SamplerInfo, nff.ExporterStats)
+}
+
+// Exporter return the resolved exporter of record, exporters are known once the block defining them
+// has been read
+func (nfs *NFStream) Exporter(record *NFRecord) RecordExporter {
+	return resolveExporter(record.ExporterSysID, nfs.Exporters, nfs.SamplerInfo, nfs.ExporterStats)
+}
+
+// Exporter return the resolved exporter of a record returned by Row
+func (nfm *NFMergeStream) Exporter(record *NFRecord) RecordExporter {
+	return resolveExporter(record.ExporterSysID, nfm.Exporters, nfm.SamplerInfo, nfm.ExporterStats)
+}
+
+// Exporter return the resolved exporter of a record returned by Row
+func (nfm *NFMultiStream) Exporter(record *NFRecord) RecordExporter {
+	return resolveExporter(record.ExporterSysID, nfm.Exporters, nfm.SamplerInfo, nfm.ExporterStats)
+}
+
+// Exporter return the resolved exporter of a record returned by Row
+func (nff *NFFollowStream) Exporter(record *NFRecord) RecordExporter {
+	return resolveExporter(record.ExporterSysID, nff.Exporters, nff.SamplerInfo, nff.ExporterStats)
+}
@@ -0,0 +1,73 @@
+package nfdump
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRecordExporter(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nff *NFFile
+	if nff, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var identities = make(map[ExporterIdentity]int)
+	for x := range nff.Records {
+		var record = &nff.Records[x]
+		var exporter = nff.Exporter(record)
+		if !exporter.Known || exporter.SysID != record.ExporterSysID || !exporter.Exporter.IPAddr.Equal(nff.Exporters[record.ExporterSysID].IPAddr) {
+			t.Errorf("Unexpected exporter of record %d:%+v", x, exporter)
+		}
+		if !exporter.HasSampler || exporter.Sampler.Interval != 3000 {
+			t.Errorf("Unexpected sampler of record %d:%+v", x, exporter.Sampler)
+		}
+		var _, hasStats = nff.ExporterStats[uint32(record.ExporterSysID)]
+		if exporter.HasStats != hasStats {
+			t.Errorf("Unexpected stats of record %d:%+v", x, exporter.Stats)
+		}
+		identities[exporter.Identity()]++
+
+		var streamRecord NFRecord
+		if streamRecord, err = nfs.Row(); err != nil {
+			t.Fatal(err)
+		}
+		if streamExporter := nfs.Exporter(&streamRecord); streamExporter.Identity() != exporter.Identity() {
+			t.Errorf("Unexpected stream exporter of record %d:%+v expected %+v", x, streamExporter.Identity(), exporter.Identity())
+		}
+	}
+	if _, err = nfs.Row(); err != io.EOF {
+		t.Errorf("Expected io.EOF got:%v", err)
+	}
+	// SysIDs 1224, 390, 58 and 865
+	if len(identities) != 4 || identities[nff.Exporters[1224].Identity()] != 5 {
+		t.Errorf("Unexpected exporters:%+v", identities)
+	}
+
+	var unknown = nff.Exporter(&NFRecord{ExporterSysID: 65535})
+	if unknown.Known || unknown.HasSampler || unknown.Identity() != (ExporterIdentity{}) {
+		t.Errorf("Unexpected unknown exporter:%+v", unknown)
+	}
+
+	var enriched = Enrich(nff, nff.Records[0])
+	var encoded []byte
+	if encoded, err = json.Marshal(enriched); err != nil {
+		t.Fatal(err)
+	}
+	var expected = `"exporter_ip":"` + nff.Exporters[nff.Records[0].ExporterSysID].IPAddr.String() + `"`
+	if !strings.Contains(string(encoded), expected) {
+		t.Errorf("Unexpected enriched JSON:%s expected %s", encoded, expected)
+	}
+}
@@ -0,0 +1,107 @@
+package nfdump
+
+// Field set of NFRecord fields decoded by NFStream.Row, see NFStream.SetFields
+type Field uint32
+
+const (
+	// FieldTime First Last MsecFirst MsecLast
+	FieldTime Field = 1 << iota
+	// FieldProto Proto TCPFlags Tos FwdStatus
+	FieldProto
+	// FieldPort SrcPort DstPort ICMPType ICMPCode
+	FieldPort
+	// FieldExporter ExporterSysID
+	FieldExporter
+	// FieldSrcIP SrcIP
+	FieldSrcIP
+	// FieldDstIP DstIP
+	FieldDstIP
+	// FieldPackets PacketCount
+	FieldPackets
+	// FieldBytes ByteCount
+	FieldBytes
+	// FieldInterface Input Output
+	FieldInterface
+	// FieldAS SrcAS DstAS
+	FieldAS
+	// FieldMask DstTos Dir SrcMask DstMask
+	FieldMask
+	// FieldNextHopIP NextHopIP
+	FieldNextHopIP
+	// FieldBGPNextIP BGPNextIP
+	FieldBGPNextIP
+	// FieldVlan SrcVlan DstVLan
+	FieldVlan
+	// FieldOutPkts OutPkts
+	FieldOutPkts
+	// FieldOutBytes OutBytes
+	FieldOutBytes
+	// FieldAggeFlows AggeFlows
+	FieldAggeFlows
+	// FieldRouterIP RouterIP
+	FieldRouterIP
+	// FieldReceived Received
+	FieldReceived
+
+	// AllFields all NFRecord fields, the default of NFStream
+	AllFields Field = 1<<iota - 1
+
+	// ipFields fields decoded into the IP buffer of a record
+	ipFields = FieldSrcIP | FieldDstIP | FieldNextHopIP | FieldBGPNextIP | FieldRouterIP
+	// counterFields fields scaled by ScaleSampling
+	counterFields = FieldPackets | FieldBytes | FieldOutPkts | FieldOutBytes
+)
+
+// FieldFilter RecordFilter reading only some record fields. NFStream decodes the fields of a
+// FieldFilter even when they are not part of SetFields, for any other filter all fields are decoded.
+type FieldFilter interface {
+	RecordFilter
+	// Fields fields read by Match
+	Fields() Field
+}
+
+// filterFields fields needed by filter, AllFields when the filter does not tell
+func filterFields(filter RecordFilter) Field {
+	if filter == nil {
+		return 0
+	}
+	if f, ok := filter.(FieldFilter); ok {
+		return f.Fields()
+	}
+	return AllFields
+}
+
+// fieldFilterFunc RecordFilterFunc reading only fields
+type fieldFilterFunc struct {
+	RecordFilterFunc
+	fields Field
+}
+
+// Fields fields read by the filter function
+func (f fieldFilterFunc) Fields() Field {
+	return f.fields
+}
+
+// fields NFRecord fields needed to fill columns
+func (c Column) fields() (fields Field) {
+	var columnFields = []struct {
+		column Column
+		fields Field
+	}{
+		{ColumnTime, FieldTime},
+		{ColumnAddr, FieldSrcIP | FieldDstIP},
+		{ColumnPort, FieldPort},
+		{ColumnProto, FieldProto},
+		{ColumnCounter, counterFields},
+		{ColumnAS, FieldAS},
+		{ColumnInterface, FieldInterface},
+		{ColumnNextHop, FieldNextHopIP | FieldBGPNextIP | FieldRouterIP},
+		{ColumnExporter, FieldExporter},
+	}
+	for _, cf := range columnFields {
+		if c&cf.column != 0 {
+			fields |= cf.fields
+		}
+	}
+	return fields
+}
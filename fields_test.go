@@ -0,0 +1,194 @@
+package nfdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestSetFields(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all *NFFile
+	if all, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		fields   Field
+		expected func(record NFRecord) NFRecord
+	}{
+		{
+			name:   "all",
+			fields: AllFields,
+			expected: func(record NFRecord) NFRecord {
+				return record
+			},
+		},
+		{
+			name:   "time addresses bytes",
+			fields: FieldTime | FieldSrcIP | FieldDstIP | FieldBytes,
+			expected: func(record NFRecord) NFRecord {
+				return NFRecord{Flags: record.Flags, MsecFirst: record.MsecFirst, MsecLast: record.MsecLast, First: record.First,
+					Last: record.Last, SrcIP: record.SrcIP, DstIP: record.DstIP, ByteCount: record.ByteCount}
+			},
+		},
+		{
+			name:   "extensions",
+			fields: FieldPort | FieldAS | FieldNextHopIP | FieldRouterIP | FieldReceived,
+			expected: func(record NFRecord) NFRecord {
+				return NFRecord{Flags: record.Flags, SrcPort: record.SrcPort, DstPort: record.DstPort, SrcAS: record.SrcAS,
+					DstAS: record.DstAS, NextHopIP: record.NextHopIP, RouterIP: record.RouterIP, Received: record.Received}
+			},
+		},
+		{
+			name:   "none",
+			fields: 0,
+			expected: func(record NFRecord) NFRecord {
+				return NFRecord{Flags: record.Flags}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		var nfs *NFStream
+		if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		nfs.SetFields(tc.fields)
+
+		var x int
+		for ; ; x++ {
+			var record NFRecord
+			if record, err = nfs.Row(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: Row error:%v", tc.name, err)
+			}
+			if expected := tc.expected(all.Records[x]); record.AddrRecord() != expected.AddrRecord() {
+				t.Errorf("%s: unexpected record %d:%+v expected %+v", tc.name, x, record, expected)
+			}
+		}
+		if x != len(all.Records) {
+			t.Errorf("%s: unexpected records:%d", tc.name, x)
+		}
+	}
+}
+
+func TestSetFieldsRequired(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	nfs.SetFields(FieldBytes)
+	nfs.SetSamplingScale(true)
+
+	var record NFRecord
+	if record, err = nfs.Row(); err != nil {
+		t.Fatal(err)
+	}
+	if record.ExporterSysID == 0 || record.SamplingInterval != 3000 || record.ByteCount == 0 || record.SrcIP != nil {
+		t.Errorf("Unexpected record:%+v", record)
+	}
+
+	// Exporters of files are merged by ExporterSysID
+	var nfm = OpenFiles([]CaptureFile{{Path: "testdata/nfcapd-small-lzo"}})
+	defer nfm.Close()
+	nfm.SetFields(FieldBytes)
+	if record, err = nfm.Row(); err != nil {
+		t.Fatal(err)
+	}
+	if !nfm.Exporter(&record).Known || record.ByteCount == 0 || record.SrcIP != nil {
+		t.Errorf("Unexpected record:%+v", record)
+	}
+}
+
+func BenchmarkStreamFields(b *testing.B) {
+	var data, err = ioutil.ReadFile(testFiles[0].fileName)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var benchmarks = []struct {
+		name   string
+		fields Field
+	}{
+		{name: "all", fields: AllFields},
+		{name: "first addresses bytes", fields: FieldTime | FieldSrcIP | FieldDstIP | FieldBytes},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				var nfs *NFStream
+				if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+				nfs.SetFields(bm.fields)
+
+				var records int
+				for ; ; records++ {
+					if _, err = nfs.Row(); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+				if records != testFiles[0].expectedRecords {
+					b.Errorf("Unexpected record count:%d", records)
+				}
+			}
+		})
+	}
+}
+
+func TestSetFieldsFilter(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name   string
+		filter RecordFilter
+		fields Field
+	}{
+		// Filters without FieldFilter may read any field
+		{name: "func", filter: RecordFilterFunc(func(record *NFRecord) bool { return record.DstPort != 0 }), fields: AllFields},
+		{name: "field filter", filter: fieldFilterFunc{RecordFilterFunc: func(record *NFRecord) bool { return record.DstPort != 0 }, fields: FieldPort}, fields: FieldBytes | FieldPort},
+		{name: "time range", filter: TimeRangeFilter(time.Time{}, time.Time{}), fields: FieldBytes | FieldTime},
+	}
+
+	for _, tc := range tests {
+		var nfs *NFStream
+		if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		nfs.SetFields(FieldBytes)
+		nfs.SetFilter(tc.filter)
+		if fields := nfs.recordFields(); fields != tc.fields {
+			t.Errorf("%s: unexpected fields:%b expected %b", tc.name, fields, tc.fields)
+		}
+
+		var records int
+		for ; ; records++ {
+			if _, err = nfs.Row(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: Row error:%v", tc.name, err)
+			}
+		}
+		if records != 10 {
+			t.Errorf("%s: unexpected records:%d", tc.name, records)
+		}
+	}
+}
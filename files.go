@@ -0,0 +1,345 @@
+package nfdump
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultFilePrefix file name prefix of nfcapd capture files
+const DefaultFilePrefix = "nfcapd"
+
+// DefaultFileInterval nfcapd default file rotation interval
+const DefaultFileInterval = 5 * time.Minute
+
+// fileTimeLayouts time part of nfcapd file names, nfcapd.YYYYMMDDhhmm or nfcapd.YYYYMMDDhhmmss
+var fileTimeLayouts = map[int]string{
+	12: "200601021504",
+	14: "20060102150405",
+}
+
+// dirLayouts nfcapd -S sub directory layouts that can be used to skip whole directories
+var dirLayouts = []struct {
+	pattern *regexp.Regexp
+	layout  string
+	span    func(t time.Time) time.Time
+}{
+	{regexp.MustCompile(`^\d{4}$`), "2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{regexp.MustCompile(`^\d{4}/\d{2}$`), "2006/01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{regexp.MustCompile(`^\d{4}/\d{2}/\d{2}$`), "2006/01/02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{regexp.MustCompile(`^\d{4}/\d{2}/\d{2}/\d{2}$`), "2006/01/02/15", func(t time.Time) time.Time { return t.Add(time.Hour) }},
+	{regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`), "2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{regexp.MustCompile(`^\d{4}-\d{2}-\d{2}/\d{2}$`), "2006-01-02/15", func(t time.Time) time.Time { return t.Add(time.Hour) }},
+	{regexp.MustCompile(`^\d{4}/\d{3}$`), "2006/002", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{regexp.MustCompile(`^\d{4}/\d{3}/\d{2}$`), "2006/002/15", func(t time.Time) time.Time { return t.Add(time.Hour) }},
+}
+
+// ParseFileName return the capture time of an nfcapd.YYYYMMDDhhmm[ss] file name, ok is false for
+// any other name including nfcapd.current.<pid> and temporary files. An empty prefix uses
+// DefaultFilePrefix and a nil location time.Local.
+func ParseFileName(name string, prefix string, location *time.Location) (t time.Time, ok bool) {
+	if prefix == "" {
+		prefix = DefaultFilePrefix
+	}
+	if location == nil {
+		location = time.Local
+	}
+
+	if !strings.HasPrefix(name, prefix+".") {
+		return t, false
+	}
+	var stamp = name[len(prefix)+1:]
+
+	var layout string
+	if layout, ok = fileTimeLayouts[len(stamp)]; !ok {
+		return t, false
+	}
+
+	var err error
+	if t, err = time.ParseInLocation(layout, stamp, location); err != nil {
+		return t, false
+	}
+	return t, true
+}
+
+// FileSelection selects nfcapd files of a directory tree by capture time, like nfdump -R with -t
+type FileSelection struct {
+	// Dir base directory, flat or with any nfcapd -S sub directory layout
+	Dir string
+	// Prefix file name prefix, DefaultFilePrefix when empty
+	Prefix string
+	// Start End select files with a capture interval overlapping [Start, End], zero means unbounded
+	Start time.Time
+	End   time.Time
+	// Interval file rotation interval, DefaultFileInterval when zero
+	Interval time.Duration
+	// Location time zone of the file names, time.Local when nil
+	Location *time.Location
+	// BlockIndex use block index sidecar files to skip blocks outside of the time range, sidecars
+	// are created by BlockIndexFile when missing. Only worth it when files are read repeatedly.
+	BlockIndex bool
+}
+
+// CaptureFile nfcapd file found by SelectFiles
+type CaptureFile struct {
+	Path string
+	// Time capture interval start taken from the file name
+	Time time.Time
+}
+
+// SelectFiles return all files of sel.Dir matching the selection ordered by capture time.
+//
+// Files are selected by the capture interval in their name. Flows are written to the file of the
+// interval they are exported in, a long running flow can start before the interval of its file.
+func SelectFiles(sel FileSelection) (files []CaptureFile, err error) {
+	if sel.Interval == 0 {
+		sel.Interval = DefaultFileInterval
+	}
+	if sel.Location == nil {
+		sel.Location = time.Local
+	}
+
+	var overlaps = func(from time.Time, to time.Time) bool {
+		return (sel.Start.IsZero() || to.After(sel.Start)) && (sel.End.IsZero() || !from.After(sel.End))
+	}
+
+	err = filepath.Walk(sel.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if from, to, ok := dirTimeRange(sel.Dir, path, sel.Location); ok && !overlaps(from, to) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		var t, ok = ParseFileName(info.Name(), sel.Prefix, sel.Location)
+		if ok && overlaps(t, t.Add(sel.Interval)) {
+			files = append(files, CaptureFile{Path: path, Time: t})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Time.Before(files[j].Time)
+	})
+	return files, nil
+}
+
+// dirTimeRange return time range covered by a sub directory of base when its relative path matches
+// one of the nfcapd sub directory layouts
+func dirTimeRange(base string, path string, location *time.Location) (from time.Time, to time.Time, ok bool) {
+	var rel, err = filepath.Rel(base, path)
+	if err != nil || rel == "." {
+		return from, to, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, dl := range dirLayouts {
+		if !dl.pattern.MatchString(rel) {
+			continue
+		}
+		if from, err = time.ParseInLocation(dl.layout, rel, location); err != nil {
+			return from, to, false
+		}
+		return from, dl.span(from), true
+	}
+	return from, to, false
+}
+
+// TimeRangeFilter match records completely inside [start, end] like nfdump -t, a zero start or end is unbounded
+func TimeRangeFilter(start time.Time, end time.Time) RecordFilter {
+	return fieldFilterFunc{RecordFilterFunc: newTimePruner(start, end, nil).match, fields: FieldTime}
+}
+
+// NFMultiStream reads several nfcapd files one after another as a single stream.
+//
+// Only one file is open at a time. Exporters, samplers and exporter stats are merged like
+// NFMergeStream does, ExporterSysID of records is rewritten when files use the same SysID for
+// different exporters.
+type NFMultiStream struct {
+	Files []CaptureFile
+	// StatRecord sum of the stat records of all files opened so far
+	StatRecord    NFStatRecord
+	Exporters     map[uint16]NFExporterInfoRecord
+	ExporterStats map[uint32]NFExporterStatRecord
+	SamplerInfo   map[uint16]NFSamplerInfoRecord
+	Samplers      map[SamplerKey]NFSamplerInfoRecord
+
+	fileIndex  int
+	file       *os.File
+	source     *mergeSource
+	filter     RecordFilter
+	timeRange  bool
+	start      time.Time
+	end        time.Time
+	blockIndex bool
+	scale      bool
+	fields     Field
+	merger     *exporterMerger
+	// ctx context of RowContext, checked before every file and block
+	ctx context.Context
+}
+
+// OpenFiles create NFMultiStream reading files in the given order, files are opened by Row when needed
+func OpenFiles(files []CaptureFile) *NFMultiStream {
+	var merger = newExporterMerger()
+	return &NFMultiStream{
+		Files:         files,
+		Exporters:     merger.exporters,
+		ExporterStats: merger.exporterStats,
+		SamplerInfo:   merger.samplerInfo,
+		Samplers:      merger.samplers,
+		fields:        AllFields,
+		merger:        merger,
+	}
+}
+
+// SelectReader select files like SelectFiles and read them as one stream. When the selection has a
+// time range only records completely inside of it are returned, like nfdump -R with -t.
+func SelectReader(sel FileSelection) (nfm *NFMultiStream, err error) {
+	var files []CaptureFile
+	if files, err = SelectFiles(sel); err != nil {
+		return nil, err
+	}
+
+	nfm = OpenFiles(files)
+	nfm.blockIndex = sel.BlockIndex
+	if !sel.Start.IsZero() || !sel.End.IsZero() {
+		nfm.SetTimeRange(sel.Start, sel.End)
+	}
+	return nfm, nil
+}
+
+// SetTimeRange only return records completely inside [start, end] like nfdump -t, see
+// NFStream.SetTimeRange. Applies to files opened after the call.
+func (nfm *NFMultiStream) SetTimeRange(start time.Time, end time.Time) {
+	nfm.timeRange = true
+	nfm.start = start
+	nfm.end = end
+}
+
+// SetSamplingScale scale counters of sampled exporters to real units, see NFStream.SetSamplingScale.
+// Applies to files opened after the call.
+func (nfm *NFMultiStream) SetSamplingScale(scale bool) {
+	nfm.scale = scale
+}
+
+// SetFields only decode fields of records, see NFStream.SetFields. The ExporterSysID is always decoded
+// to merge exporters. Applies to files opened after the call.
+func (nfm *NFMultiStream) SetFields(fields Field) {
+	nfm.fields = fields
+}
+
+// SetFilter only return records matching filter from Row, the filter sees the merged ExporterSysID
+func (nfm *NFMultiStream) SetFilter(filter RecordFilter) {
+	nfm.filter = filter
+}
+
+// CurrentFile return path of the file the last record was read from, empty before the first Row
+func (nfm *NFMultiStream) CurrentFile() string {
+	if nfm.fileIndex == 0 || nfm.fileIndex > len(nfm.Files) {
+		return ""
+	}
+	return nfm.Files[nfm.fileIndex-1].Path
+}
+
+// Row each call will return the next NFRecord of the current file or an error. io.EOF error means
+// all files have been read. Errors of a file are returned with the file path.
+func (nfm *NFMultiStream) Row() (record NFRecord, err error) {
+	for {
+		if nfm.source == nil {
+			if nfm.fileIndex >= len(nfm.Files) {
+				return record, io.EOF
+			}
+			if nfm.ctx != nil {
+				if err = nfm.ctx.Err(); err != nil {
+					return record, err
+				}
+			}
+			if err = nfm.open(nfm.Files[nfm.fileIndex].Path); err != nil {
+				return record, err
+			}
+		}
+
+		if record, err = streamRow(nfm.source.nfs, nfm.ctx); err == io.EOF {
+			nfm.merger.finish(nfm.source)
+			if err = nfm.closeFile(); err != nil {
+				return record, err
+			}
+			continue
+		} else if canceled(nfm.ctx, err) {
+			return record, err
+		} else if err != nil {
+			return record, fmt.Errorf("%s: %w", nfm.CurrentFile(), err)
+		}
+
+		nfm.merger.record(nfm.source, &record)
+		if nfm.filter != nil && !nfm.filter.Match(&record) {
+			continue
+		}
+		return record, nil
+	}
+}
+
+// open open next file and read its header
+func (nfm *NFMultiStream) open(path string) (err error) {
+	nfm.fileIndex++
+	if nfm.file, err = os.Open(path); err != nil {
+		return err
+	}
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(bufio.NewReader(nfm.file)); err != nil {
+		nfm.closeFile()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	mergeStatRecord(&nfm.StatRecord, nfs.StatRecord)
+	nfs.SetSamplingScale(nfm.scale)
+	nfs.SetFields(nfm.fields | FieldExporter | filterFields(nfm.filter))
+
+	if nfm.timeRange {
+		var index *BlockIndex
+		if nfm.blockIndex {
+			if index, err = BlockIndexFile(path); err != nil {
+				nfm.closeFile()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		nfs.SetTimeRange(nfm.start, nfm.end, index)
+	}
+
+	nfm.source = newMergeSource(nfm.fileIndex-1, nfs)
+	return nil
+}
+
+// closeFile close current file
+func (nfm *NFMultiStream) closeFile() (err error) {
+	nfm.source = nil
+	if nfm.file != nil {
+		err = nfm.file.Close()
+		nfm.file = nil
+	}
+	return err
+}
+
+// Close close the current file, Row returns io.EOF afterwards
+func (nfm *NFMultiStream) Close() error {
+	nfm.fileIndex = len(nfm.Files)
+	return nfm.closeFile()
+}
@@ -0,0 +1,212 @@
+package nfdump
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCaptureFiles copy the small test file to every name below dir
+func writeCaptureFiles(t *testing.T, dir string, names ...string) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		var path = filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseFileName(t *testing.T) {
+	var tests = []struct {
+		name   string
+		prefix string
+		ok     bool
+		time   time.Time
+	}{
+		{name: "nfcapd.201908121850", ok: true, time: time.Date(2019, 8, 12, 18, 50, 0, 0, time.UTC)},
+		{name: "nfcapd.20190812185030", ok: true, time: time.Date(2019, 8, 12, 18, 50, 30, 0, time.UTC)},
+		{name: "sfcapd.201908121850", prefix: "sfcapd", ok: true, time: time.Date(2019, 8, 12, 18, 50, 0, 0, time.UTC)},
+		{name: "sfcapd.201908121850"},
+		{name: "nfcapd.current.4242"},
+		{name: "nfcapd.201908121850.tmp"},
+		{name: "nfcapd.201913121850"},
+		{name: "nfcapd"},
+	}
+
+	for _, tc := range tests {
+		var ts, ok = ParseFileName(tc.name, tc.prefix, time.UTC)
+		if ok != tc.ok || !ts.Equal(tc.time) {
+			t.Errorf("ParseFileName(%q) = %s %t expected %s %t", tc.name, ts, ok, tc.time, tc.ok)
+		}
+	}
+}
+
+func TestDirTimeRange(t *testing.T) {
+	var tests = []struct {
+		path string
+		ok   bool
+		from time.Time
+		to   time.Time
+	}{
+		{path: "2019", ok: true, from: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{path: "2019/08", ok: true, from: time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{path: "2019/08/12", ok: true, from: time.Date(2019, 8, 12, 0, 0, 0, 0, time.UTC), to: time.Date(2019, 8, 13, 0, 0, 0, 0, time.UTC)},
+		{path: "2019/08/12/18", ok: true, from: time.Date(2019, 8, 12, 18, 0, 0, 0, time.UTC), to: time.Date(2019, 8, 12, 19, 0, 0, 0, time.UTC)},
+		{path: "2019-08-12", ok: true, from: time.Date(2019, 8, 12, 0, 0, 0, 0, time.UTC), to: time.Date(2019, 8, 13, 0, 0, 0, 0, time.UTC)},
+		{path: "2019-08-12/18", ok: true, from: time.Date(2019, 8, 12, 18, 0, 0, 0, time.UTC), to: time.Date(2019, 8, 12, 19, 0, 0, 0, time.UTC)},
+		{path: "2019/224", ok: true, from: time.Date(2019, 8, 12, 0, 0, 0, 0, time.UTC), to: time.Date(2019, 8, 13, 0, 0, 0, 0, time.UTC)},
+		{path: "2019/224/18", ok: true, from: time.Date(2019, 8, 12, 18, 0, 0, 0, time.UTC), to: time.Date(2019, 8, 12, 19, 0, 0, 0, time.UTC)},
+		{path: "archive"},
+		{path: "2019/33/1"},
+	}
+
+	for _, tc := range tests {
+		var from, to, ok = dirTimeRange("/data", filepath.Join("/data", filepath.FromSlash(tc.path)), time.UTC)
+		if ok != tc.ok || !from.Equal(tc.from) || !to.Equal(tc.to) {
+			t.Errorf("dirTimeRange(%q) = %s %s %t expected %s %s %t", tc.path, from, to, ok, tc.from, tc.to, tc.ok)
+		}
+	}
+}
+
+func TestSelectFiles(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCaptureFiles(t, dir,
+		"2019/08/12/nfcapd.201908121850",
+		"2019/08/12/nfcapd.201908121845",
+		"2019/08/12/nfcapd.current.4242",
+		"2019/08/13/nfcapd.201908130000",
+		"2019/08/13/sfcapd.201908130005",
+		"flat/nfcapd.201908121855",
+	)
+
+	var tests = []struct {
+		name  string
+		sel   FileSelection
+		files []string
+	}{
+		{name: "all", sel: FileSelection{}, files: []string{
+			"2019/08/12/nfcapd.201908121845", "2019/08/12/nfcapd.201908121850", "flat/nfcapd.201908121855", "2019/08/13/nfcapd.201908130000",
+		}},
+		{name: "window", sel: FileSelection{
+			Start: time.Date(2019, 8, 12, 18, 50, 0, 0, time.UTC),
+			End:   time.Date(2019, 8, 12, 18, 55, 0, 0, time.UTC),
+		}, files: []string{"2019/08/12/nfcapd.201908121850", "flat/nfcapd.201908121855"}},
+		{name: "start", sel: FileSelection{Start: time.Date(2019, 8, 12, 23, 0, 0, 0, time.UTC)}, files: []string{"2019/08/13/nfcapd.201908130000"}},
+		{name: "prefix", sel: FileSelection{Prefix: "sfcapd"}, files: []string{"2019/08/13/sfcapd.201908130005"}},
+		{name: "interval", sel: FileSelection{
+			Start:    time.Date(2019, 8, 12, 18, 52, 0, 0, time.UTC),
+			End:      time.Date(2019, 8, 12, 18, 53, 0, 0, time.UTC),
+			Interval: time.Minute,
+		}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.sel.Dir = dir
+			tc.sel.Location = time.UTC
+
+			var files []CaptureFile
+			if files, err = SelectFiles(tc.sel); err != nil {
+				t.Fatalf("SelectFiles error:%v", err)
+			}
+			if len(files) != len(tc.files) {
+				t.Fatalf("Unexpected files:%v expected %v", files, tc.files)
+			}
+			for x, file := range files {
+				if file.Path != filepath.Join(dir, filepath.FromSlash(tc.files[x])) {
+					t.Errorf("Unexpected file:%s expected %s", file.Path, tc.files[x])
+				}
+			}
+		})
+	}
+
+	if _, err = SelectFiles(FileSelection{Dir: filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("Expected error for missing directory")
+	}
+}
+
+func TestSelectReader(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCaptureFiles(t, dir, "nfcapd.201908121845", "nfcapd.201908121850")
+
+	var tests = []struct {
+		name    string
+		sel     FileSelection
+		records int
+		flows   uint64
+	}{
+		{name: "all", sel: FileSelection{Dir: dir, Location: time.UTC}, records: 20, flows: 20},
+		{name: "window", sel: FileSelection{
+			Dir:      dir,
+			Location: time.UTC,
+			Start:    time.Date(2019, 8, 12, 18, 50, 47, 0, time.UTC),
+			End:      time.Date(2019, 8, 12, 18, 50, 49, 0, time.UTC),
+		}, records: 6, flows: 10},
+		{name: "block index", sel: FileSelection{
+			Dir:        dir,
+			Location:   time.UTC,
+			Start:      time.Date(2019, 8, 12, 18, 50, 47, 0, time.UTC),
+			End:        time.Date(2019, 8, 12, 18, 50, 49, 0, time.UTC),
+			BlockIndex: true,
+		}, records: 6, flows: 10},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var nfm *NFMultiStream
+			if nfm, err = SelectReader(tc.sel); err != nil {
+				t.Fatalf("SelectReader error:%v", err)
+			}
+			defer nfm.Close()
+
+			var count int
+			var record NFRecord
+			for {
+				if record, err = nfm.Row(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Row error:%v", err)
+				}
+				if _, ok := nfm.Exporters[record.ExporterSysID]; !ok {
+					t.Errorf("Unknown exporter SysID:%d", record.ExporterSysID)
+				}
+				count++
+			}
+
+			if count != tc.records {
+				t.Errorf("Unexpected record count:%d expected %d", count, tc.records)
+			}
+			if len(nfm.Exporters) != 2407 || nfm.StatRecord.NumFlows != tc.flows {
+				t.Errorf("Unexpected exporters:%d stat:%+v", len(nfm.Exporters), nfm.StatRecord)
+			}
+			if nfm.CurrentFile() != filepath.Join(dir, "nfcapd.201908121850") {
+				t.Errorf("Unexpected current file:%s", nfm.CurrentFile())
+			}
+			if _, err = os.Stat(nfm.CurrentFile() + BlockIndexSuffix); tc.sel.BlockIndex != (err == nil) {
+				t.Errorf("Unexpected block index sidecar error:%v", err)
+			}
+		})
+	}
+}
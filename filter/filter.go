@@ -0,0 +1,71 @@
+/*
+Package filter parses nfdump filter expressions and compiles them into a predicate over nfdump.NFRecord.
+
+The syntax follows the nfdump CLI filter language, for example:
+
+	proto tcp and dst port 443 and src net 10.0.0.0/8 and bytes > 1M
+	not (src as 64512 or dst as 64512) and flags S and not flags A
+	ip 192.168.1.1 or (inet6 and packets >= 100)
+
+Supported terms are any, inet/ipv4, inet6/ipv6, proto, ip/host, net, port, as, if, next ip,
+bgpnext ip, router ip, vlan, tos, icmp-type, icmp-code, flags, bytes, packets, flows, duration,
+bps, pps and bpp. Address, port, as and vlan terms accept a src, dst, "src or dst" or "src and dst"
+direction, if terms accept in or out. Terms are combined with and/&&, or/|| and not/! and
+grouped with parentheses. Numbers are compared with =, !=, <, <=, > or >= (eq, lt, le, gt, ge) and
+accept a 1000 based k, m or g suffix.
+*/
+package filter
+
+import (
+	"github.com/chrispassas/nfdump"
+)
+
+// matchFunc compiled filter term
+type matchFunc func(record *nfdump.NFRecord) bool
+
+// Filter compiled nfdump filter expression
+type Filter struct {
+	expr   string
+	match  matchFunc
+	fields nfdump.Field
+}
+
+// Compile parse nfdump filter expression and return a Filter, an empty expression matches every record
+func Compile(expr string) (f *Filter, err error) {
+	var p *parser
+	if p, err = newParser(expr); err != nil {
+		return nil, err
+	}
+
+	f = &Filter{expr: expr}
+	if f.match, err = p.parse(); err != nil {
+		return nil, err
+	}
+	f.fields = p.fields
+	return f, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be parsed
+func MustCompile(expr string) *Filter {
+	f, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Match return true if record matches the filter expression
+func (f *Filter) Match(record *nfdump.NFRecord) bool {
+	return f.match(record)
+}
+
+// Fields record fields read by the filter, implements nfdump.FieldFilter so streams decode them
+// regardless of SetFields
+func (f *Filter) Fields() nfdump.Field {
+	return f.fields
+}
+
+// String return filter expression the Filter was compiled from
+func (f *Filter) String() string {
+	return f.expr
+}
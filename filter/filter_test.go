@@ -0,0 +1,216 @@
+package filter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/chrispassas/nfdump"
+)
+
+var testFile = "../testdata/nfcapd-small-lzo"
+
+func readTestRecords(t *testing.T) []nfdump.NFRecord {
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile(testFile); err != nil {
+		t.Fatal(err)
+	}
+
+	var nff *nfdump.NFFile
+	if nff, err = nfdump.ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return nff.Records
+}
+
+func TestFilterMatch(t *testing.T) {
+	var records = readTestRecords(t)
+
+	var tests = []struct {
+		expr    string
+		matches int
+	}{
+		{expr: "", matches: 10},
+		{expr: "any", matches: 10},
+		{expr: "inet", matches: 10},
+		{expr: "inet6", matches: 0},
+		{expr: "proto tcp", matches: 6},
+		{expr: "proto 17", matches: 4},
+		{expr: "not proto tcp", matches: 4},
+		{expr: "port 443", matches: 6},
+		{expr: "dst port 443", matches: 4},
+		{expr: "src port 443", matches: 2},
+		{expr: "src and dst port 6672", matches: 1},
+		{expr: "src or dst port 6672", matches: 1},
+		{expr: "proto tcp and dst port 443", matches: 3},
+		{expr: "proto tcp && dst port 443", matches: 3},
+		{expr: "dst port in [53 4500]", matches: 2},
+		{expr: "dst port > 60000", matches: 2},
+		{expr: "dst port != 443", matches: 6},
+		{expr: "proto tcp and dst port != 443", matches: 3},
+		{expr: "ip 216.206.145.131", matches: 1},
+		{expr: "dst ip 216.206.145.131", matches: 0},
+		{expr: "host in [216.206.145.131 99.86.61.170]", matches: 2},
+		{expr: "src net 35.0.0.0/8", matches: 2},
+		{expr: "src net 35/8", matches: 2},
+		{expr: "src net 35.0.0.0 255.0.0.0", matches: 2},
+		{expr: "net 99.0.0.0/8", matches: 2},
+		{expr: "src as 33363", matches: 3},
+		{expr: "as 7018", matches: 2},
+		{expr: "in if 1170", matches: 5},
+		{expr: "out if 799", matches: 2},
+		{expr: "if 793", matches: 2},
+		{expr: "router ip 66.110.1.17", matches: 5},
+		{expr: "next ip 130.117.15.69", matches: 2},
+		{expr: "flags A", matches: 6},
+		{expr: "flags AP", matches: 1},
+		{expr: "proto tcp and not flags P", matches: 5},
+		{expr: "bytes > 1M", matches: 4},
+		{expr: "bytes >= 4500000", matches: 3},
+		{expr: "packets > 5k", matches: 4},
+		{expr: "duration > 1000", matches: 4},
+		{expr: "bpp < 100", matches: 4},
+		{expr: "tos 2", matches: 1},
+		{expr: "vlan 3", matches: 1},
+		{expr: "(proto udp or dst port 443) and not src as 33363", matches: 4},
+		{expr: "proto tcp and dst port 443 and src net 103.0.0.0/8 and bytes > 500k", matches: 1},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			var f *Filter
+			var err error
+			if f, err = Compile(tc.expr); err != nil {
+				t.Fatalf("Compile error:%v", err)
+			}
+
+			var matches int
+			for x := range records {
+				if f.Match(&records[x]) {
+					matches++
+				}
+			}
+			if matches != tc.matches {
+				t.Errorf("Unexpected match count:%d expected %d", matches, tc.matches)
+			}
+		})
+	}
+}
+
+func TestFilterSyntaxError(t *testing.T) {
+	var tests = []string{
+		"proto",
+		"proto foo",
+		"port abc",
+		"port 70000",
+		"ip 1.2.3",
+		"net 10.0.0.0/33",
+		"(proto tcp",
+		"proto tcp)",
+		"proto tcp and",
+		"src bytes > 10",
+		"in port 80",
+		"flags Z",
+		"dst port in []",
+		"a & b",
+		"bytes > 18446744073709551615k",
+		"packets > 18446744073709552g",
+		"bytes != in [1 2]",
+		"foo",
+	}
+
+	for _, expr := range tests {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q) expected error", expr)
+		}
+	}
+}
+
+func TestStreamFilter(t *testing.T) {
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile(testFile); err != nil {
+		t.Fatal(err)
+	}
+
+	var nfs *nfdump.NFStream
+	if nfs, err = nfdump.StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	nfs.SetFilter(MustCompile("proto udp and bytes > 1M"))
+
+	var records int
+	var record nfdump.NFRecord
+	for {
+		if record, err = nfs.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("nfs.Row() error:%v", err)
+		}
+		if record.Proto != 17 || record.ByteCount <= 1000000 {
+			t.Errorf("Record does not match filter:%+v", record)
+		}
+		records++
+	}
+
+	if records != 2 {
+		t.Errorf("Unexpected record count:%d expected 2", records)
+	}
+}
+
+func TestStreamFilterFields(t *testing.T) {
+	var records = readTestRecords(t)
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile(testFile); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		expr   string
+		fields nfdump.Field
+	}{
+		{expr: "dst port 443", fields: nfdump.FieldPort},
+		{expr: "not dst port 443", fields: nfdump.FieldPort},
+		{expr: "proto udp and bytes > 1M", fields: nfdump.FieldProto | nfdump.FieldBytes},
+		{expr: "src net 0.0.0.0/1 or bps > 1000", fields: nfdump.FieldSrcIP | nfdump.FieldDstIP | nfdump.FieldBytes | nfdump.FieldTime},
+		{expr: "inet", fields: 0},
+	}
+
+	for _, tc := range tests {
+		var f = MustCompile(tc.expr)
+		if f.Fields() != tc.fields {
+			t.Errorf("%s: unexpected fields:%b expected %b", tc.expr, f.Fields(), tc.fields)
+		}
+
+		var expected int
+		for x := range records {
+			if f.Match(&records[x]) {
+				expected++
+			}
+		}
+
+		// The filter reads fields not requested by SetFields
+		var nfs *nfdump.NFStream
+		if nfs, err = nfdump.StreamReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		nfs.SetFields(nfdump.FieldBytes)
+		nfs.SetFilter(f)
+
+		var matched int
+		for ; ; matched++ {
+			if _, err = nfs.Row(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: nfs.Row() error:%v", tc.expr, err)
+			}
+		}
+		if matched != expected {
+			t.Errorf("%s: unexpected record count:%d expected %d", tc.expr, matched, expected)
+		}
+	}
+}
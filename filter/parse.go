@@ -0,0 +1,645 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/chrispassas/nfdump"
+)
+
+// direction src/dst selector in front of a term
+type direction int
+
+const (
+	dirEither direction = iota
+	dirSrc
+	dirDst
+	dirBoth
+	dirIn
+	dirOut
+)
+
+// ipv6Flag NFRecord.Flags bit set when the record addresses are IPv6
+const ipv6Flag = 1
+
+// tcpFlagBits nfdump filter flag letters
+var tcpFlagBits = map[rune]uint8{
+	'F': 1,
+	'S': 2,
+	'R': 4,
+	'P': 8,
+	'A': 16,
+	'U': 32,
+	'X': 63,
+	'E': 64,
+	'C': 128,
+}
+
+// token single lexical token and its byte offset in the expression
+type token struct {
+	text string
+	pos  int
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	end    int
+	// fields record fields read by the parsed terms
+	fields nfdump.Field
+}
+
+// newParser split expression into tokens
+func newParser(expr string) (p *parser, err error) {
+	p = &parser{end: len(expr)}
+
+	var i = 0
+	for i < len(expr) {
+		var c = expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',':
+			p.tokens = append(p.tokens, token{text: expr[i : i+1], pos: i})
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(expr) || expr[i+1] != c {
+				return nil, fmt.Errorf("Filter syntax error, unexpected %q at position %d", c, i)
+			}
+			p.tokens = append(p.tokens, token{text: expr[i : i+2], pos: i})
+			i += 2
+		case c == '!' || c == '=' || c == '<' || c == '>':
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				p.tokens = append(p.tokens, token{text: expr[i : i+2], pos: i})
+				i += 2
+			} else {
+				p.tokens = append(p.tokens, token{text: expr[i : i+1], pos: i})
+				i++
+			}
+		default:
+			var start = i
+			for i < len(expr) && !strings.ContainsRune(" \t\n\r()[],&|!=<>", rune(expr[i])) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{text: expr[start:i], pos: start})
+		}
+	}
+
+	return p, nil
+}
+
+// peek return lower cased token n positions ahead without consuming it
+func (p *parser) peek(n int) string {
+	if p.pos+n >= len(p.tokens) {
+		return ""
+	}
+	return strings.ToLower(p.tokens[p.pos+n].text)
+}
+
+// next consume and return current token
+func (p *parser) next() (tok token, err error) {
+	if p.pos >= len(p.tokens) {
+		return tok, fmt.Errorf("Filter syntax error, unexpected end of expression at position %d", p.end)
+	}
+	tok = p.tokens[p.pos]
+	p.pos++
+	return tok, nil
+}
+
+// errorf syntax error at current token
+func (p *parser) errorf(format string, args ...interface{}) error {
+	var pos = p.end
+	if p.pos < len(p.tokens) {
+		pos = p.tokens[p.pos].pos
+	} else if p.pos > 0 && p.pos-1 < len(p.tokens) {
+		pos = p.tokens[p.pos-1].pos
+	}
+	return fmt.Errorf("Filter syntax error, %s at position %d", fmt.Sprintf(format, args...), pos)
+}
+
+// parse whole expression
+func (p *parser) parse() (match matchFunc, err error) {
+	if len(p.tokens) == 0 {
+		return func(*nfdump.NFRecord) bool { return true }, nil
+	}
+
+	if match, err = p.parseOr(); err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return match, nil
+}
+
+func (p *parser) parseOr() (match matchFunc, err error) {
+	if match, err = p.parseAnd(); err != nil {
+		return nil, err
+	}
+
+	for p.peek(0) == "or" || p.peek(0) == "||" {
+		p.pos++
+		var left = match
+		var right matchFunc
+		if right, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		match = func(r *nfdump.NFRecord) bool { return left(r) || right(r) }
+	}
+	return match, nil
+}
+
+func (p *parser) parseAnd() (match matchFunc, err error) {
+	if match, err = p.parseNot(); err != nil {
+		return nil, err
+	}
+
+	for p.peek(0) == "and" || p.peek(0) == "&&" {
+		p.pos++
+		var left = match
+		var right matchFunc
+		if right, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		match = func(r *nfdump.NFRecord) bool { return left(r) && right(r) }
+	}
+	return match, nil
+}
+
+func (p *parser) parseNot() (match matchFunc, err error) {
+	if p.peek(0) == "not" || p.peek(0) == "!" {
+		p.pos++
+		if match, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		var inner = match
+		return func(r *nfdump.NFRecord) bool { return !inner(r) }, nil
+	}
+
+	if p.peek(0) == "(" {
+		p.pos++
+		if match, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+		if p.peek(0) != ")" {
+			return nil, p.errorf("expected \")\"")
+		}
+		p.pos++
+		return match, nil
+	}
+
+	return p.parseTerm()
+}
+
+// parseDirection consume optional src/dst/in/out qualifier
+func (p *parser) parseDirection() direction {
+	switch p.peek(0) {
+	case "src", "dst":
+		var first = p.peek(0)
+		var other = "dst"
+		if first == "dst" {
+			other = "src"
+		}
+		if (p.peek(1) == "or" || p.peek(1) == "and") && p.peek(2) == other {
+			var joined = p.peek(1)
+			p.pos += 3
+			if joined == "or" {
+				return dirEither
+			}
+			return dirBoth
+		}
+		p.pos++
+		if first == "src" {
+			return dirSrc
+		}
+		return dirDst
+	case "in":
+		p.pos++
+		return dirIn
+	case "out":
+		p.pos++
+		return dirOut
+	}
+	return dirEither
+}
+
+// parseTerm single filter primitive
+func (p *parser) parseTerm() (match matchFunc, err error) {
+	var dirPos = p.pos
+	var dir = p.parseDirection()
+	var hasDir = p.pos != dirPos
+
+	var keyword = p.peek(0)
+	if keyword == "" {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	if dir == dirIn || dir == dirOut {
+		if keyword != "if" {
+			return nil, p.errorf("in/out only valid for if, got %q", keyword)
+		}
+	}
+
+	switch keyword {
+	case "ip", "host":
+		p.pos++
+		p.fields |= nfdump.FieldSrcIP | nfdump.FieldDstIP
+		return p.parseIPTerm(dir, func(r *nfdump.NFRecord) net.IP { return r.SrcIP }, func(r *nfdump.NFRecord) net.IP { return r.DstIP })
+	case "net":
+		p.pos++
+		p.fields |= nfdump.FieldSrcIP | nfdump.FieldDstIP
+		var ipNet *net.IPNet
+		if ipNet, err = p.parseNet(); err != nil {
+			return nil, err
+		}
+		return directional(dir,
+			func(r *nfdump.NFRecord) bool { return r.SrcIP != nil && ipNet.Contains(r.SrcIP) },
+			func(r *nfdump.NFRecord) bool { return r.DstIP != nil && ipNet.Contains(r.DstIP) },
+		), nil
+	case "port":
+		p.pos++
+		p.fields |= nfdump.FieldPort
+		return p.parseNumberTerm(dir,
+			func(r *nfdump.NFRecord) uint64 { return uint64(r.SrcPort) },
+			func(r *nfdump.NFRecord) uint64 { return uint64(r.DstPort) },
+			65535)
+	case "as":
+		p.pos++
+		p.fields |= nfdump.FieldAS
+		return p.parseNumberTerm(dir,
+			func(r *nfdump.NFRecord) uint64 { return uint64(r.SrcAS) },
+			func(r *nfdump.NFRecord) uint64 { return uint64(r.DstAS) },
+			4294967295)
+	case "vlan":
+		p.pos++
+		p.fields |= nfdump.FieldVlan
+		return p.parseNumberTerm(dir,
+			func(r *nfdump.NFRecord) uint64 { return uint64(r.SrcVlan) },
+			func(r *nfdump.NFRecord) uint64 { return uint64(r.DstVLan) },
+			65535)
+	case "if":
+		p.pos++
+		p.fields |= nfdump.FieldInterface
+		if dir == dirSrc || dir == dirDst || dir == dirBoth {
+			return nil, p.errorf("src/dst not valid for if, use in or out")
+		}
+		var value uint64
+		if value, err = p.parseNumber(4294967295); err != nil {
+			return nil, err
+		}
+		var in = func(r *nfdump.NFRecord) bool { return uint64(r.Input) == value }
+		var out = func(r *nfdump.NFRecord) bool { return uint64(r.Output) == value }
+		switch dir {
+		case dirIn:
+			return in, nil
+		case dirOut:
+			return out, nil
+		}
+		return func(r *nfdump.NFRecord) bool { return in(r) || out(r) }, nil
+	}
+
+	if hasDir {
+		return nil, p.errorf("src/dst not valid for %q", keyword)
+	}
+
+	p.pos++
+	switch keyword {
+	case "any":
+		return func(*nfdump.NFRecord) bool { return true }, nil
+	case "inet", "ipv4":
+		return func(r *nfdump.NFRecord) bool { return r.Flags&ipv6Flag == 0 }, nil
+	case "inet6", "ipv6":
+		return func(r *nfdump.NFRecord) bool { return r.Flags&ipv6Flag != 0 }, nil
+	case "proto":
+		p.fields |= nfdump.FieldProto
+		var tok token
+		if tok, err = p.next(); err != nil {
+			return nil, err
+		}
+		var proto uint8
+		var ok bool
+		if proto, ok = nfdump.ProtocolNumber(tok.text); !ok {
+			p.pos--
+			return nil, p.errorf("unknown protocol %q", tok.text)
+		}
+		return func(r *nfdump.NFRecord) bool { return r.Proto == proto }, nil
+	case "next", "bgpnext", "router":
+		if p.peek(0) != "ip" {
+			return nil, p.errorf("expected ip after %q", keyword)
+		}
+		p.pos++
+		var get = func(r *nfdump.NFRecord) net.IP { return r.NextHopIP }
+		var field = nfdump.FieldNextHopIP
+		if keyword == "bgpnext" {
+			get = func(r *nfdump.NFRecord) net.IP { return r.BGPNextIP }
+			field = nfdump.FieldBGPNextIP
+		} else if keyword == "router" {
+			get = func(r *nfdump.NFRecord) net.IP { return r.RouterIP }
+			field = nfdump.FieldRouterIP
+		}
+		p.fields |= field
+		return p.parseIPTerm(dirSrc, get, nil)
+	case "tos":
+		p.fields |= nfdump.FieldProto
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 { return uint64(r.Tos) }, nil, 255)
+	case "icmp-type":
+		p.fields |= nfdump.FieldPort
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 { return uint64(r.ICMPType) }, nil, 255)
+	case "icmp-code":
+		p.fields |= nfdump.FieldPort
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 { return uint64(r.ICMPCode) }, nil, 255)
+	case "flags":
+		p.fields |= nfdump.FieldProto
+		var tok token
+		if tok, err = p.next(); err != nil {
+			return nil, err
+		}
+		var mask uint8
+		for _, c := range tok.text {
+			var bit, ok = tcpFlagBits[unicode.ToUpper(c)]
+			if !ok {
+				p.pos--
+				return nil, p.errorf("unknown tcp flag %q", c)
+			}
+			mask |= bit
+		}
+		return func(r *nfdump.NFRecord) bool { return r.Proto == 6 && r.TCPFlags&mask == mask }, nil
+	case "bytes":
+		p.fields |= nfdump.FieldBytes
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 { return r.ByteCount }, nil, 0)
+	case "packets":
+		p.fields |= nfdump.FieldPackets
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 { return r.PacketCount }, nil, 0)
+	case "flows":
+		p.fields |= nfdump.FieldAggeFlows
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 {
+			if r.AggeFlows == 0 {
+				return 1
+			}
+			return r.AggeFlows
+		}, nil, 0)
+	case "duration":
+		p.fields |= nfdump.FieldTime
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 {
+			if d := r.DurationMilliseconds(); d > 0 {
+				return uint64(d)
+			}
+			return 0
+		}, nil, 0)
+	case "bps":
+		p.fields |= nfdump.FieldBytes | nfdump.FieldTime
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 {
+			if d := r.DurationMilliseconds(); d > 0 {
+				return r.ByteCount * 8000 / uint64(d)
+			}
+			return 0
+		}, nil, 0)
+	case "pps":
+		p.fields |= nfdump.FieldPackets | nfdump.FieldTime
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 {
+			if d := r.DurationMilliseconds(); d > 0 {
+				return r.PacketCount * 1000 / uint64(d)
+			}
+			return 0
+		}, nil, 0)
+	case "bpp":
+		p.fields |= nfdump.FieldBytes | nfdump.FieldPackets
+		return p.parseNumberTerm(dirSrc, func(r *nfdump.NFRecord) uint64 {
+			if r.PacketCount > 0 {
+				return r.ByteCount / r.PacketCount
+			}
+			return 0
+		}, nil, 0)
+	}
+
+	p.pos--
+	return nil, p.errorf("unknown filter term %q", p.tokens[p.pos].text)
+}
+
+// directional combine src and dst matchers according to direction
+func directional(dir direction, src, dst matchFunc) matchFunc {
+	switch dir {
+	case dirSrc:
+		return src
+	case dirDst:
+		return dst
+	case dirBoth:
+		return func(r *nfdump.NFRecord) bool { return src(r) && dst(r) }
+	}
+	return func(r *nfdump.NFRecord) bool { return src(r) || dst(r) }
+}
+
+// parseIPTerm address or address list, dst may be nil for terms without direction
+func (p *parser) parseIPTerm(dir direction, src, dst func(r *nfdump.NFRecord) net.IP) (match matchFunc, err error) {
+	var ips []net.IP
+	var values []string
+	if values, err = p.parseValues(); err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		var ip = net.ParseIP(value)
+		if ip == nil {
+			return nil, p.errorf("invalid ip address %q", value)
+		}
+		ips = append(ips, ip)
+	}
+
+	var contains = func(ip net.IP) bool {
+		for _, want := range ips {
+			if want.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var srcMatch = func(r *nfdump.NFRecord) bool { return contains(src(r)) }
+	if dst == nil {
+		return srcMatch, nil
+	}
+	return directional(dir, srcMatch, func(r *nfdump.NFRecord) bool { return contains(dst(r)) }), nil
+}
+
+// parseNet network in CIDR notation, abbreviated IPv4 CIDR (172.16/12) or address followed by a dotted netmask
+func (p *parser) parseNet() (ipNet *net.IPNet, err error) {
+	var tok token
+	if tok, err = p.next(); err != nil {
+		return nil, err
+	}
+
+	var value = tok.text
+	if !strings.Contains(value, "/") {
+		var ip = net.ParseIP(value).To4()
+		var mask = net.ParseIP(p.peek(0)).To4()
+		if ip == nil || mask == nil {
+			p.pos--
+			return nil, p.errorf("invalid network %q", value)
+		}
+		p.pos++
+		return &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}, nil
+	}
+
+	var parts = strings.SplitN(value, "/", 2)
+	if !strings.Contains(parts[0], ":") {
+		for strings.Count(parts[0], ".") < 3 {
+			parts[0] += ".0"
+		}
+	}
+
+	if _, ipNet, err = net.ParseCIDR(parts[0] + "/" + parts[1]); err != nil {
+		p.pos--
+		return nil, p.errorf("invalid network %q", value)
+	}
+	return ipNet, nil
+}
+
+// parseNumberTerm optional comparison operator followed by a number, or "in [list]"
+// max of 0 means no upper bound, dst may be nil for terms without direction
+func (p *parser) parseNumberTerm(dir direction, src, dst func(r *nfdump.NFRecord) uint64, max uint64) (match matchFunc, err error) {
+	var op = "="
+	switch p.peek(0) {
+	case "=", "==", "eq":
+		p.pos++
+	case ">", "gt":
+		op = ">"
+		p.pos++
+	case "<", "lt":
+		op = "<"
+		p.pos++
+	case ">=", "ge":
+		op = ">="
+		p.pos++
+	case "<=", "le":
+		op = "<="
+		p.pos++
+	case "!=":
+		op = "!="
+		p.pos++
+	}
+
+	var test func(v uint64) bool
+	if op == "=" && p.peek(0) == "in" {
+		var values []string
+		var list []uint64
+		if values, err = p.parseValues(); err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			var n uint64
+			if n, err = parseScaled(value); err != nil || (max > 0 && n > max) {
+				return nil, p.errorf("invalid number %q", value)
+			}
+			list = append(list, n)
+		}
+		test = func(v uint64) bool {
+			for _, n := range list {
+				if v == n {
+					return true
+				}
+			}
+			return false
+		}
+	} else {
+		var value uint64
+		if value, err = p.parseNumber(max); err != nil {
+			return nil, err
+		}
+		switch op {
+		case "=":
+			test = func(v uint64) bool { return v == value }
+		case ">":
+			test = func(v uint64) bool { return v > value }
+		case "<":
+			test = func(v uint64) bool { return v < value }
+		case ">=":
+			test = func(v uint64) bool { return v >= value }
+		case "<=":
+			test = func(v uint64) bool { return v <= value }
+		case "!=":
+			test = func(v uint64) bool { return v != value }
+		}
+	}
+
+	var srcMatch = func(r *nfdump.NFRecord) bool { return test(src(r)) }
+	if dst == nil {
+		return srcMatch, nil
+	}
+	return directional(dir, srcMatch, func(r *nfdump.NFRecord) bool { return test(dst(r)) }), nil
+}
+
+// parseNumber single number with optional k/m/g scale suffix
+func (p *parser) parseNumber(max uint64) (value uint64, err error) {
+	var tok token
+	if tok, err = p.next(); err != nil {
+		return 0, err
+	}
+	if value, err = parseScaled(tok.text); err != nil || (max > 0 && value > max) {
+		p.pos--
+		return 0, p.errorf("invalid number %q", tok.text)
+	}
+	return value, nil
+}
+
+// parseValues single value or "in [a b c]" list
+func (p *parser) parseValues() (values []string, err error) {
+	var tok token
+	if p.peek(0) != "in" {
+		if tok, err = p.next(); err != nil {
+			return nil, err
+		}
+		return []string{tok.text}, nil
+	}
+
+	p.pos++
+	if p.peek(0) != "[" {
+		return nil, p.errorf("expected \"[\"")
+	}
+	p.pos++
+
+	for p.peek(0) != "]" {
+		if tok, err = p.next(); err != nil {
+			return nil, err
+		}
+		if tok.text != "," {
+			values = append(values, tok.text)
+		}
+	}
+	p.pos++
+
+	if len(values) == 0 {
+		return nil, p.errorf("empty list")
+	}
+	return values, nil
+}
+
+// parseScaled parse unsigned number with nfdump k/m/g (1000 based) scale suffix
+func parseScaled(s string) (value uint64, err error) {
+	var scale uint64 = 1
+	if len(s) > 1 {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			scale = 1000
+		case 'm', 'M':
+			scale = 1000 * 1000
+		case 'g', 'G':
+			scale = 1000 * 1000 * 1000
+		}
+		if scale > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	if value, err = strconv.ParseUint(s, 10, 64); err != nil {
+		return 0, err
+	}
+	if value > math.MaxUint64/scale {
+		return 0, fmt.Errorf("Number out of range:%s", s)
+	}
+	return value * scale, nil
+}
@@ -0,0 +1,358 @@
+package nfdump
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval interval NFFollowStream checks for new data
+const DefaultPollInterval = time.Second
+
+// NFFollowStream reads the nfcapd.current.<pid> file of a collector directory while nfcapd is
+// writing it, like tail -f. Row waits for blocks to be flushed, a partially written block is
+// returned once it is complete. After rotation the remaining blocks of the rotated file are read and
+// the stream continues with the new current file.
+//
+// Exporters, samplers and exporter stats of all followed files are merged like NFMultiStream does.
+type NFFollowStream struct {
+	Dir           string
+	Exporters     map[uint16]NFExporterInfoRecord
+	ExporterStats map[uint32]NFExporterStatRecord
+	SamplerInfo   map[uint16]NFSamplerInfoRecord
+	Samplers      map[SamplerKey]NFSamplerInfoRecord
+
+	prefix       string
+	pollInterval time.Duration
+	file         *followFile
+	source       *mergeSource
+	filter       RecordFilter
+	merger       *exporterMerger
+	files        int
+	// ctx context of RowContext, ends waiting for new data
+	ctx context.Context
+
+	mu      sync.Mutex
+	reading bool
+	closed  bool
+	done    chan struct{}
+}
+
+// followFile io.Reader of a file that is still being written. Read only returns the file header and
+// complete blocks and waits for new data at a block boundary until the file has been rotated, so
+// waiting can end without losing a partially read block.
+type followFile struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	nff     *NFFollowStream
+	rotated bool
+	// pos offset of the next byte returned by Read, complete end of the last complete block
+	pos      int64
+	complete int64
+}
+
+// FollowReader create NFFollowStream for the current file of dir, an empty prefix uses
+// DefaultFilePrefix. The current file is read from its start, when there is none Row waits for it.
+func FollowReader(dir string, prefix string) *NFFollowStream {
+	if prefix == "" {
+		prefix = DefaultFilePrefix
+	}
+	var merger = newExporterMerger()
+	return &NFFollowStream{
+		Dir:           dir,
+		Exporters:     merger.exporters,
+		ExporterStats: merger.exporterStats,
+		SamplerInfo:   merger.samplerInfo,
+		Samplers:      merger.samplers,
+		prefix:        prefix,
+		pollInterval:  DefaultPollInterval,
+		merger:        merger,
+		done:          make(chan struct{}),
+	}
+}
+
+// SetPollInterval interval to check for new data and rotation, DefaultPollInterval by default
+func (nff *NFFollowStream) SetPollInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultPollInterval
+	}
+	nff.pollInterval = d
+}
+
+// SetFilter only return records matching filter from Row, the filter sees the merged ExporterSysID
+func (nff *NFFollowStream) SetFilter(filter RecordFilter) {
+	nff.filter = filter
+}
+
+// CurrentFile return path of the file being followed, empty before the first Row. After rotation
+// the path no longer exists until the stream switched to the new current file.
+func (nff *NFFollowStream) CurrentFile() string {
+	if nff.file == nil {
+		return ""
+	}
+	return nff.file.path
+}
+
+// Row each call will return the next NFRecord, waiting for nfcapd to write it. io.EOF error is
+// only returned after Close. Errors of a file, e.g. a file left truncated by a crashed nfcapd, are
+// returned with the file path and the next Row continues with the next current file.
+func (nff *NFFollowStream) Row() (record NFRecord, err error) {
+	nff.mu.Lock()
+	if nff.closed {
+		nff.mu.Unlock()
+		return record, io.EOF
+	}
+	nff.reading = true
+	nff.mu.Unlock()
+
+	defer func() {
+		nff.mu.Lock()
+		nff.reading = false
+		if nff.closed {
+			nff.closeFile()
+			if err != nil {
+				record, err = NFRecord{}, io.EOF
+			}
+		}
+		nff.mu.Unlock()
+	}()
+
+	for {
+		if nff.source == nil {
+			if err = nff.open(); err != nil {
+				return record, err
+			}
+		}
+
+		if record, err = streamRow(nff.source.nfs, nff.ctx); err == io.EOF {
+			nff.merger.finish(nff.source)
+			nff.closeFile()
+			continue
+		} else if canceled(nff.ctx, err) {
+			return record, err
+		} else if err != nil {
+			if nff.isClosed() {
+				return record, io.EOF
+			}
+			var path = nff.file.path
+			nff.closeFile()
+			return record, fmt.Errorf("%s: %w", path, err)
+		}
+
+		nff.merger.record(nff.source, &record)
+		if nff.filter != nil && !nff.filter.Match(&record) {
+			continue
+		}
+		return record, nil
+	}
+}
+
+// Close stop following, a Row waiting for data in another goroutine returns io.EOF
+func (nff *NFFollowStream) Close() error {
+	nff.mu.Lock()
+	defer nff.mu.Unlock()
+	if nff.closed {
+		return nil
+	}
+	nff.closed = true
+	close(nff.done)
+	if !nff.reading {
+		return nff.closeFile()
+	}
+	return nil
+}
+
+// isClosed true after Close
+func (nff *NFFollowStream) isClosed() bool {
+	select {
+	case <-nff.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait sleep for the poll interval, io.EOF when the stream was closed and the error of ctx when ctx
+// of RowContext is done
+func (nff *NFFollowStream) wait() error {
+	var timer = time.NewTimer(nff.pollInterval)
+	defer timer.Stop()
+
+	var ctxDone <-chan struct{}
+	if nff.ctx != nil {
+		ctxDone = nff.ctx.Done()
+	}
+	select {
+	case <-nff.done:
+		return io.EOF
+	case <-ctxDone:
+		return nff.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// open wait for the current file and read its header
+func (nff *NFFollowStream) open() (err error) {
+	var path string
+	for {
+		var info os.FileInfo
+		if path, info, err = nff.currentFile(); err != nil {
+			return err
+		}
+		// Skip the file just finished when nfcapd did not create the next one yet
+		if path != "" && (nff.file == nil || !os.SameFile(info, nff.file.info)) {
+			break
+		}
+		if err = nff.wait(); err != nil {
+			return err
+		}
+	}
+
+	var ff = &followFile{path: path, nff: nff}
+	if ff.file, err = os.Open(path); err != nil {
+		if os.IsNotExist(err) {
+			// Rotated in the meantime, try again with the next file
+			nff.file = nil
+			return nff.open()
+		}
+		return err
+	}
+	if ff.info, err = ff.file.Stat(); err != nil {
+		ff.file.Close()
+		return err
+	}
+	var previous = nff.file
+	nff.file = ff
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(ff); err != nil {
+		if nff.isClosed() {
+			return io.EOF
+		}
+		if nff.ctx != nil && nff.ctx.Err() != nil {
+			// Open the file again on the next call
+			nff.closeFile()
+			nff.file = previous
+			return nff.ctx.Err()
+		}
+		nff.closeFile()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	nff.files++
+	nff.source = newMergeSource(nff.files-1, nfs)
+	return nil
+}
+
+// currentFile return the most recently modified current file of the directory, empty path when
+// there is none
+func (nff *NFFollowStream) currentFile() (path string, info os.FileInfo, err error) {
+	var infos []os.FileInfo
+	if infos, err = ioutil.ReadDir(nff.Dir); err != nil {
+		return "", nil, err
+	}
+
+	for _, fi := range infos {
+		if !fi.Mode().IsRegular() || !strings.HasPrefix(fi.Name(), nff.prefix+".current.") {
+			continue
+		}
+		if info == nil || fi.ModTime().After(info.ModTime()) {
+			info = fi
+		}
+	}
+	if info == nil {
+		return "", nil, nil
+	}
+	return filepath.Join(nff.Dir, info.Name()), info, nil
+}
+
+// closeFile close the followed file, the file info is kept to recognize it after rotation
+func (nff *NFFollowStream) closeFile() (err error) {
+	nff.source = nil
+	if nff.file != nil && nff.file.file != nil {
+		err = nff.file.file.Close()
+		nff.file.file = nil
+	}
+	return err
+}
+
+// Read read from the file, at the end of the complete blocks wait for more data until the file has
+// been rotated. The data of a rotated file is final and read up to its end.
+func (ff *followFile) Read(p []byte) (n int, err error) {
+	for {
+		if ff.pos < ff.complete || ff.rotated {
+			if !ff.rotated && int64(len(p)) > ff.complete-ff.pos {
+				p = p[:ff.complete-ff.pos]
+			}
+			n, err = ff.file.Read(p)
+			ff.pos += int64(n)
+			return n, err
+		}
+		if err = ff.update(); err != nil {
+			return 0, err
+		}
+		if ff.pos < ff.complete {
+			continue
+		}
+		if ff.isRotated() {
+			// nfcapd renames the file after writing its last block, read the rest of it
+			ff.rotated = true
+			continue
+		}
+		if err = ff.nff.wait(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// update move complete past the file header and all blocks written completely
+func (ff *followFile) update() (err error) {
+	var info os.FileInfo
+	if info, err = ff.file.Stat(); err != nil {
+		return err
+	}
+	var size = info.Size()
+
+	if ff.complete == 0 {
+		if size < fileHeaderSize {
+			return nil
+		}
+		ff.complete = fileHeaderSize
+	}
+	var header = make([]byte, blockHeaderSize)
+	for ff.complete+blockHeaderSize <= size {
+		if _, err = ff.file.ReadAt(header, ff.complete); err != nil {
+			return err
+		}
+		var end = ff.complete + blockHeaderSize + int64(binary.LittleEndian.Uint32(header[4:8]))
+		if end > size {
+			break
+		}
+		ff.complete = end
+	}
+	return nil
+}
+
+// isRotated true when the file was renamed or replaced, or a newer current file exists because
+// nfcapd was restarted
+func (ff *followFile) isRotated() bool {
+	var info, err = os.Stat(ff.path)
+	if err != nil || !os.SameFile(info, ff.info) {
+		return true
+	}
+
+	var current os.FileInfo
+	if _, current, err = ff.nff.currentFile(); err != nil || current == nil {
+		return false
+	}
+	return !os.SameFile(current, info) && current.ModTime().After(info.ModTime())
+}
@@ -0,0 +1,118 @@
+package nfdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// followResult record or error returned by Row
+type followResult struct {
+	record NFRecord
+	err    error
+}
+
+func TestFollowReader(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var data = splitTestFile(t)
+	var expected *NFFile
+	if expected, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var nff = FollowReader(dir, "")
+	nff.SetPollInterval(5 * time.Millisecond)
+
+	var results = make(chan followResult)
+	go func() {
+		for {
+			var record, err = nff.Row()
+			results <- followResult{record: record, err: err}
+			if err == io.EOF {
+				return
+			}
+		}
+	}()
+
+	var next = func() followResult {
+		select {
+		case result := <-results:
+			return result
+		case <-time.After(5 * time.Second):
+			t.Fatal("Row did not return")
+		}
+		return followResult{}
+	}
+	var expectNone = func() {
+		select {
+		case result := <-results:
+			t.Fatalf("Unexpected Row result:%+v", result)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	var current = filepath.Join(dir, "nfcapd.current.1234")
+	var f *os.File
+	if f, err = os.Create(current); err != nil {
+		t.Fatal(err)
+	}
+
+	// Header, meta block and the first flow block split in the middle
+	var firstFlow = int(fileHeaderSize+blockHeaderSize) + int(binary.LittleEndian.Uint32(data[fileHeaderSize+4:]))
+	var split = firstFlow + 20
+	f.Write(data[:split])
+	expectNone()
+
+	f.Write(data[split:])
+	f.Sync()
+	for x := range expected.Records {
+		var result = next()
+		if result.err != nil {
+			t.Fatalf("Row error:%v", result.err)
+		}
+		if result.record.StartTimeMS() != expected.Records[x].StartTimeMS() || !result.record.SrcIP.Equal(expected.Records[x].SrcIP) {
+			t.Errorf("Unexpected record %d:%+v", x, result.record)
+		}
+	}
+	expectNone()
+
+	// Rotate and start a new current file with the same name
+	f.Close()
+	if err = os.Rename(current, filepath.Join(dir, "nfcapd.201908121850")); err != nil {
+		t.Fatal(err)
+	}
+	expectNone()
+	if err = ioutil.WriteFile(current, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for x := range expected.Records {
+		var result = next()
+		if result.err != nil {
+			t.Fatalf("Row error after rotation:%v", result.err)
+		}
+		if result.record.EndTimeMS() != expected.Records[x].EndTimeMS() {
+			t.Errorf("Unexpected record %d after rotation:%+v", x, result.record)
+		}
+	}
+	if nff.CurrentFile() != current {
+		t.Errorf("Unexpected current file:%s", nff.CurrentFile())
+	}
+	if len(nff.Exporters) != len(expected.Exporters) {
+		t.Errorf("Unexpected exporters:%d expected %d", len(nff.Exporters), len(expected.Exporters))
+	}
+
+	nff.Close()
+	if result := next(); result.err != io.EOF {
+		t.Errorf("Expected io.EOF after Close got:%+v", result)
+	}
+}
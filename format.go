@@ -0,0 +1,393 @@
+package nfdump
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// formatTimeLayout time layout used by nfdump for text output
+	formatTimeLayout = "2006-01-02 15:04:05.000"
+	// csvTimeLayout time layout used by nfdump for csv output
+	csvTimeLayout = "2006-01-02 15:04:05"
+)
+
+// PredefinedFormats nfdump -o output formats, the "6" variants print full length IPv6 addresses
+var PredefinedFormats = map[string]string{
+	"line":      "%ts %td %pr %sap -> %dap %pkt %byt %fl",
+	"long":      "%ts %td %pr %sap -> %dap %flg %tos %pkt %byt %fl",
+	"extended":  "%ts %td %pr %sap -> %dap %flg %tos %pkt %byt %pps %bps %bpp %fl",
+	"line6":     "%ts %td %pr %sap -> %dap %pkt %byt %fl",
+	"long6":     "%ts %td %pr %sap -> %dap %flg %tos %pkt %byt %fl",
+	"extended6": "%ts %td %pr %sap -> %dap %flg %tos %pkt %byt %pps %bps %bpp %fl",
+}
+
+// csvFields columns written by the csv format, names are the nfdump csv header names
+var csvFields = []string{
+	"ts", "te", "td", "sa", "da", "sp", "dp", "pr", "flg", "fwd", "stos", "ipkt", "ibyt", "opkt", "obyt",
+	"in", "out", "sas", "das", "smk", "dmk", "dtos", "dir", "nh", "nhb", "svln", "dvln", "ra", "exid", "tr",
+}
+
+// formatElement single %xx element of a format template
+type formatElement struct {
+	header string
+	// width column width, negative values are left aligned, 0 is not padded
+	width int
+	// ipPort address:port column, header is the address part only
+	ipPort bool
+	value  func(f *Formatter, r *NFRecord) string
+}
+
+// formatSegment literal text or element of a parsed template
+type formatSegment struct {
+	literal string
+	name    string
+	element *formatElement
+}
+
+// Formatter writes records as text in nfdump output formats
+type Formatter struct {
+	w        io.Writer
+	segments []formatSegment
+	csv      bool
+	long6    bool
+	scale    bool
+	location *time.Location
+	buf      []byte
+}
+
+// NewFormatter create Formatter writing to w. format is one of line, long, extended, line6, long6,
+// extended6, csv or a user defined template prefixed with "fmt:", e.g. "fmt:%ts %td %pr %sap -> %dap %pkt %byt".
+// By default times are printed in the local time zone and packet/byte counters are scaled.
+func NewFormatter(w io.Writer, format string) (f *Formatter, err error) {
+	f = &Formatter{
+		w:        w,
+		scale:    true,
+		location: time.Local,
+	}
+
+	var template string
+	if format == "csv" {
+		f.csv = true
+		f.scale = false
+		for x, name := range csvFields {
+			if x > 0 {
+				f.segments = append(f.segments, formatSegment{literal: ","})
+			}
+			var element = formatElements[name]
+			f.segments = append(f.segments, formatSegment{name: name, element: &element})
+		}
+		return f, nil
+	} else if strings.HasPrefix(format, "fmt:") {
+		template = format[len("fmt:"):]
+	} else {
+		var ok bool
+		if template, ok = PredefinedFormats[format]; !ok {
+			return nil, fmt.Errorf("Unsupported output format:%s", format)
+		}
+		f.long6 = strings.HasSuffix(format, "6")
+	}
+
+	if f.segments, err = parseFormat(template); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetLocation set time zone used to print times
+func (f *Formatter) SetLocation(location *time.Location) {
+	f.location = location
+}
+
+// SetScale enable or disable scaling of packet, byte and rate values to M/G/T units (nfdump -N disables scaling)
+func (f *Formatter) SetScale(scale bool) {
+	f.scale = scale
+}
+
+// parseFormat split template into literals and elements, the longest matching element name is used
+func parseFormat(template string) (segments []formatSegment, err error) {
+	var names = make([]string, 0, len(formatElements))
+	for name := range formatElements {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	var literal strings.Builder
+	for i := 0; i < len(template); {
+		if template[i] != '%' {
+			literal.WriteByte(template[i])
+			i++
+			continue
+		}
+
+		var found = false
+		for _, name := range names {
+			if strings.HasPrefix(template[i+1:], name) {
+				if literal.Len() > 0 {
+					segments = append(segments, formatSegment{literal: literal.String()})
+					literal.Reset()
+				}
+				var element = formatElements[name]
+				segments = append(segments, formatSegment{name: name, element: &element})
+				i += len(name) + 1
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unsupported format element at position %d:%s", i, template[i:])
+		}
+	}
+
+	if literal.Len() > 0 {
+		segments = append(segments, formatSegment{literal: literal.String()})
+	}
+	return segments, nil
+}
+
+// WriteHeader write column header line
+func (f *Formatter) WriteHeader() (err error) {
+	f.buf = f.buf[:0]
+	for _, segment := range f.segments {
+		if segment.element == nil {
+			// nfdump prints the direction arrows of the format as blanks in the header
+			f.buf = append(f.buf, strings.Replace(segment.literal, "->", "  ", -1)...)
+		} else if f.csv {
+			f.buf = append(f.buf, segment.name...)
+		} else if segment.element.ipPort {
+			f.buf = appendPadded(f.buf, segment.element.header, f.ipWidth())
+			f.buf = append(f.buf, ":Port "...)
+		} else {
+			f.buf = appendPadded(f.buf, segment.element.header, f.width(segment.element))
+		}
+	}
+	f.buf = append(f.buf, '\n')
+	_, err = f.w.Write(f.buf)
+	return err
+}
+
+// Write write record as a single line
+func (f *Formatter) Write(record *NFRecord) (err error) {
+	f.buf = f.buf[:0]
+	for _, segment := range f.segments {
+		if segment.element == nil {
+			f.buf = append(f.buf, segment.literal...)
+		} else if f.csv {
+			f.buf = append(f.buf, segment.element.value(f, record)...)
+		} else {
+			f.buf = appendPadded(f.buf, segment.element.value(f, record), f.width(segment.element))
+		}
+	}
+	f.buf = append(f.buf, '\n')
+	_, err = f.w.Write(f.buf)
+	return err
+}
+
+// WriteStream write every remaining record of nfs
+func (f *Formatter) WriteStream(nfs *NFStream) (err error) {
+	var record NFRecord
+	for {
+		if record, err = nfs.Row(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = f.Write(&record); err != nil {
+			return err
+		}
+	}
+}
+
+// width column width of element, address columns are wider in the "6" formats
+func (f *Formatter) width(element *formatElement) int {
+	if element.width == ipWidth {
+		return f.ipWidth()
+	}
+	return element.width
+}
+
+// ipWidth address column width
+func (f *Formatter) ipWidth() int {
+	if f.long6 {
+		return ipWidth6
+	}
+	return ipWidth
+}
+
+func appendPadded(buf []byte, value string, width int) []byte {
+	if width > 0 {
+		for x := len(value); x < width; x++ {
+			buf = append(buf, ' ')
+		}
+		return append(buf, value...)
+	}
+
+	buf = append(buf, value...)
+	for x := len(value); x < -width; x++ {
+		buf = append(buf, ' ')
+	}
+	return buf
+}
+
+// TCPFlagString return nfdump style TCP flag string, unset flags are printed as '.', e.g. "...A..S."
+func TCPFlagString(flags uint8) string {
+	var s = []byte("CEUAPRSF")
+	for x := 0; x < 8; x++ {
+		if flags&(128>>uint(x)) == 0 {
+			s[x] = '.'
+		}
+	}
+	return string(s)
+}
+
+// FormatNumber print number scaled to M/G/T units (1000 based) like nfdump, or unscaled when scale is false
+func FormatNumber(n uint64, scale bool) string {
+	if !scale {
+		return strconv.FormatUint(n, 10)
+	}
+
+	switch {
+	case n >= 1000*1000*1000*1000:
+		return fmt.Sprintf("%.1f T", float64(n)/(1000*1000*1000*1000))
+	case n >= 1000*1000*1000:
+		return fmt.Sprintf("%.1f G", float64(n)/(1000*1000*1000))
+	case n >= 1000*1000:
+		return fmt.Sprintf("%.1f M", float64(n)/(1000*1000))
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// formatIP print address, long IPv6 addresses are condensed unless a "6" format is used
+func (f *Formatter) formatIP(ip net.IP) string {
+	if ip == nil {
+		if f.csv {
+			return ""
+		}
+		return "0.0.0.0"
+	}
+
+	var s = ip.String()
+	if !f.csv && !f.long6 && len(s) > 16 {
+		s = s[:7] + ".." + s[len(s)-7:]
+	}
+	return s
+}
+
+// formatTime print milliseconds since epoch
+func (f *Formatter) formatTime(ms int64) string {
+	var t = time.Unix(0, ms*int64(time.Millisecond)).In(f.location)
+	if f.csv {
+		return t.Format(csvTimeLayout)
+	}
+	return t.Format(formatTimeLayout)
+}
+
+// formatPort print port, ICMP destination port is printed as type.code
+func formatPort(r *NFRecord, dst bool) string {
+	if !dst {
+		return strconv.Itoa(int(r.SrcPort))
+	}
+	if r.Proto == 1 || r.Proto == 58 {
+		return strconv.Itoa(int(r.ICMPType)) + "." + strconv.Itoa(int(r.ICMPCode))
+	}
+	return strconv.Itoa(int(r.DstPort))
+}
+
+// formatIPPort print address and port column
+func (f *Formatter) formatIPPort(ip net.IP, port string) string {
+	var sep = ":"
+	if len(ip) == net.IPv6len && ip.To4() == nil {
+		sep = "."
+	}
+	return string(appendPadded(nil, f.formatIP(ip), f.ipWidth())) + sep + string(appendPadded(nil, port, -5))
+}
+
+// recordFlows number of flows a record represents
+func recordFlows(r *NFRecord) uint64 {
+	if r.AggeFlows == 0 {
+		return 1
+	}
+	return r.AggeFlows
+}
+
+// recordRate value per second over the record duration
+func recordRate(r *NFRecord, value uint64) uint64 {
+	if d := r.DurationMilliseconds(); d > 0 {
+		return value * 1000 / uint64(d)
+	}
+	return 0
+}
+
+const (
+	ipWidth  = 16
+	ipWidth6 = 39
+)
+
+// formatElements all supported %xx format elements
+var formatElements = map[string]formatElement{
+	"ts": {header: "Date first seen", width: -23, value: func(f *Formatter, r *NFRecord) string { return f.formatTime(r.StartTimeMS()) }},
+	"te": {header: "Date last seen", width: -23, value: func(f *Formatter, r *NFRecord) string { return f.formatTime(r.EndTimeMS()) }},
+	"tr": {header: "Date flow received", width: -23, value: func(f *Formatter, r *NFRecord) string { return f.formatTime(int64(r.Received)) }},
+	"td": {header: "Duration", width: 9, value: func(f *Formatter, r *NFRecord) string {
+		return strconv.FormatFloat(float64(r.DurationMilliseconds())/1000, 'f', 3, 64)
+	}},
+	"pr": {header: "Proto", width: -5, value: func(f *Formatter, r *NFRecord) string { return ProtocolName(r.Proto) }},
+	"sa": {header: "Src IP Addr", width: ipWidth, value: func(f *Formatter, r *NFRecord) string { return f.formatIP(r.SrcIP) }},
+	"da": {header: "Dst IP Addr", width: ipWidth, value: func(f *Formatter, r *NFRecord) string { return f.formatIP(r.DstIP) }},
+	"sap": {header: "Src IP Addr", ipPort: true, value: func(f *Formatter, r *NFRecord) string {
+		return f.formatIPPort(r.SrcIP, formatPort(r, false))
+	}},
+	"dap": {header: "Dst IP Addr", ipPort: true, value: func(f *Formatter, r *NFRecord) string {
+		return f.formatIPPort(r.DstIP, formatPort(r, true))
+	}},
+	"sp": {header: "Src Pt", width: 6, value: func(f *Formatter, r *NFRecord) string { return formatPort(r, false) }},
+	"dp": {header: "Dst Pt", width: 6, value: func(f *Formatter, r *NFRecord) string { return formatPort(r, true) }},
+	"sn": {header: "Src Network", width: ipWidth, value: func(f *Formatter, r *NFRecord) string {
+		return f.formatIP(maskIP(r.SrcIP, int(r.SrcMask), int(r.SrcMask))) + "/" + strconv.Itoa(int(r.SrcMask))
+	}},
+	"dn": {header: "Dst Network", width: ipWidth, value: func(f *Formatter, r *NFRecord) string {
+		return f.formatIP(maskIP(r.DstIP, int(r.DstMask), int(r.DstMask))) + "/" + strconv.Itoa(int(r.DstMask))
+	}},
+	"nh":   {header: "Next-hop IP", width: ipWidth, value: func(f *Formatter, r *NFRecord) string { return f.formatIP(r.NextHopIP) }},
+	"nhb":  {header: "BGP next-hop IP", width: ipWidth, value: func(f *Formatter, r *NFRecord) string { return f.formatIP(r.BGPNextIP) }},
+	"ra":   {header: "Router IP", width: ipWidth, value: func(f *Formatter, r *NFRecord) string { return f.formatIP(r.RouterIP) }},
+	"sas":  {header: "Src AS", width: 6, value: func(f *Formatter, r *NFRecord) string { return strconv.FormatUint(uint64(r.SrcAS), 10) }},
+	"das":  {header: "Dst AS", width: 6, value: func(f *Formatter, r *NFRecord) string { return strconv.FormatUint(uint64(r.DstAS), 10) }},
+	"in":   {header: "Input", width: 5, value: func(f *Formatter, r *NFRecord) string { return strconv.FormatUint(uint64(r.Input), 10) }},
+	"out":  {header: "Output", width: 6, value: func(f *Formatter, r *NFRecord) string { return strconv.FormatUint(uint64(r.Output), 10) }},
+	"pkt":  {header: "Packets", width: 8, value: func(f *Formatter, r *NFRecord) string { return FormatNumber(r.PacketCount, f.scale) }},
+	"byt":  {header: "Bytes", width: 8, value: func(f *Formatter, r *NFRecord) string { return FormatNumber(r.ByteCount, f.scale) }},
+	"ipkt": {header: "In Pkt", width: 8, value: func(f *Formatter, r *NFRecord) string { return FormatNumber(r.PacketCount, f.scale) }},
+	"ibyt": {header: "In Byte", width: 8, value: func(f *Formatter, r *NFRecord) string { return FormatNumber(r.ByteCount, f.scale) }},
+	"opkt": {header: "Out Pkt", width: 8, value: func(f *Formatter, r *NFRecord) string { return FormatNumber(r.OutPkts, f.scale) }},
+	"obyt": {header: "Out Byte", width: 8, value: func(f *Formatter, r *NFRecord) string { return FormatNumber(r.OutBytes, f.scale) }},
+	"fl":   {header: "Flows", width: 5, value: func(f *Formatter, r *NFRecord) string { return strconv.FormatUint(recordFlows(r), 10) }},
+	"flg":  {header: "Flags", width: 8, value: func(f *Formatter, r *NFRecord) string { return TCPFlagString(r.TCPFlags) }},
+	"tos":  {header: "Tos", width: 3, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.Tos)) }},
+	"stos": {header: "STos", width: 4, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.Tos)) }},
+	"dtos": {header: "DTos", width: 4, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.DstTos)) }},
+	"smk":  {header: "SMask", width: 5, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.SrcMask)) }},
+	"dmk":  {header: "DMask", width: 5, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.DstMask)) }},
+	"fwd":  {header: "Fwd", width: 3, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.FwdStatus)) }},
+	"dir":  {header: "Dir", width: 3, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.Dir)) }},
+	"svln": {header: "SVlan", width: 5, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.SrcVlan)) }},
+	"dvln": {header: "DVlan", width: 5, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.DstVLan)) }},
+	"exid": {header: "Exp ID", width: 6, value: func(f *Formatter, r *NFRecord) string { return strconv.Itoa(int(r.ExporterSysID)) }},
+	"pps": {header: "pps", width: 8, value: func(f *Formatter, r *NFRecord) string {
+		return FormatNumber(recordRate(r, r.PacketCount), f.scale)
+	}},
+	"bps": {header: "bps", width: 8, value: func(f *Formatter, r *NFRecord) string {
+		return FormatNumber(recordRate(r, r.ByteCount*8), f.scale)
+	}},
+	"bpp": {header: "Bpp", width: 6, value: func(f *Formatter, r *NFRecord) string {
+		if r.PacketCount == 0 {
+			return "0"
+		}
+		return strconv.FormatUint(r.ByteCount/r.PacketCount, 10)
+	}},
+}
@@ -0,0 +1,132 @@
+package nfdump
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFormatter(t *testing.T) {
+	var tests = []struct {
+		format string
+		header string
+		line   string
+	}{
+		{
+			format: "line",
+			header: "Date first seen          Duration Proto      Src IP Addr:Port          Dst IP Addr:Port   Packets    Bytes Flows\n",
+			line:   "2019-08-12 18:50:47.958     0.000 TCP    216.206.145.131:443   ->   209.148.205.55:41322     3000    4.5 M     1\n",
+		},
+		{
+			format: "long",
+			header: "Date first seen          Duration Proto      Src IP Addr:Port          Dst IP Addr:Port     Flags Tos  Packets    Bytes Flows\n",
+			line:   "2019-08-12 18:50:47.958     0.000 TCP    216.206.145.131:443   ->   209.148.205.55:41322 ...A....   0     3000    4.5 M     1\n",
+		},
+		{
+			format: "fmt:%ts %pr %sa:%sp -> %da:%dp %flg %sas %das %ra",
+			header: "Date first seen         Proto      Src IP Addr:Src Pt         Dst IP Addr:Dst Pt    Flags Src AS Dst AS        Router IP\n",
+			line:   "2019-08-12 18:50:47.958 TCP    216.206.145.131:   443 ->   209.148.205.55: 41322 ...A....    209    812      66.110.1.17\n",
+		},
+		{
+			format: "csv",
+			header: "ts,te,td,sa,da,sp,dp,pr,flg,fwd,stos,ipkt,ibyt,opkt,obyt,in,out,sas,das,smk,dmk,dtos,dir,nh,nhb,svln,dvln,ra,exid,tr\n",
+			line:   "2019-08-12 18:50:47,2019-08-12 18:50:47,0.000,216.206.145.131,209.148.205.55,443,41322,TCP,...A....,0,0,3000,4500000,0,0,1170,1264,209,812,15,20,0,0,64.86.79.127,,2,0,66.110.1.17,1224,2019-08-12 18:51:57\n",
+		},
+	}
+
+	var record = testData[0]
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			var f *Formatter
+			var err error
+			if f, err = NewFormatter(&buf, tc.format); err != nil {
+				t.Fatal(err)
+			}
+			f.SetLocation(time.UTC)
+
+			if err = f.WriteHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.header {
+				t.Errorf("Unexpected header\n%q\n%q", buf.String(), tc.header)
+			}
+
+			buf.Reset()
+			if err = f.Write(&record); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.line {
+				t.Errorf("Unexpected line\n%q\n%q", buf.String(), tc.line)
+			}
+		})
+	}
+}
+
+func TestFormatterIPv6(t *testing.T) {
+	var record = NFRecord{
+		Flags:       v6And,
+		Proto:       58,
+		ICMPType:    128,
+		SrcIP:       net.ParseIP("2001:db8:1000:cafe:20e:35ff:fec0:fed5"),
+		DstIP:       net.ParseIP("2001:db8::1"),
+		PacketCount: 1,
+		ByteCount:   64,
+	}
+
+	var tests = []struct {
+		format string
+		line   string
+	}{
+		{format: "fmt:%sap -> %dap", line: "2001:db..c0:fed5.0     ->      2001:db8::1.128.0\n"},
+		{format: "line6", line: "1970-01-01 00:00:00.000     0.000 ICMP6   2001:db8:1000:cafe:20e:35ff:fec0:fed5.0     ->                             2001:db8::1.128.0        1       64     1\n"},
+	}
+
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		var f *Formatter
+		var err error
+		if f, err = NewFormatter(&buf, tc.format); err != nil {
+			t.Fatal(err)
+		}
+		f.SetLocation(time.UTC)
+		if err = f.Write(&record); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.line {
+			t.Errorf("Unexpected line\n%q\n%q", buf.String(), tc.line)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	var tests = []struct {
+		n      uint64
+		scale  bool
+		result string
+	}{
+		{n: 999999, scale: true, result: "999999"},
+		{n: 4500000, scale: true, result: "4.5 M"},
+		{n: 1500000000, scale: true, result: "1.5 G"},
+		{n: 2000000000000, scale: true, result: "2.0 T"},
+		{n: 4500000, scale: false, result: "4500000"},
+	}
+	for _, tc := range tests {
+		if result := FormatNumber(tc.n, tc.scale); result != tc.result {
+			t.Errorf("FormatNumber(%d) = %s expected %s", tc.n, result, tc.result)
+		}
+	}
+
+	if TCPFlagString(0x1b) != "...AP.SF" {
+		t.Errorf("Unexpected flag string:%s", TCPFlagString(0x1b))
+	}
+
+	if _, err := NewFormatter(nil, "fmt:%ts %foo"); err == nil {
+		t.Errorf("Expected error for unknown format element")
+	}
+	if _, err := NewFormatter(nil, "foo"); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/chrispassas/nfdump
 
-go 1.14
+go 1.18
 
 require (
 	github.com/rasky/go-lzo v0.0.0-20200203143853-96a758eda86e
@@ -0,0 +1,95 @@
+package nfdump
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ExporterHealth sequence failures and traffic of one exporter over time. nfcapd writes the stats
+// of every exporter at the end of each file, so every file is one interval.
+type ExporterHealth struct {
+	// Exporter exporter as defined in the last file, SysID is local to that file
+	Exporter NFExporterInfoRecord
+	// SequenceFailures Packets Flows totals of all intervals
+	SequenceFailures uint64
+	Packets          uint64
+	Flows            uint64
+	Intervals        []ExporterInterval
+}
+
+// ExporterInterval exporter stats of one file
+type ExporterInterval struct {
+	Path string
+	// Time capture time of the file, the stat record first seen time when the name has no time
+	Time             time.Time
+	SequenceFailures uint32
+	Packets          uint64
+	Flows            uint64
+}
+
+// ExporterHealthReport read the exporter stats of files and return the health of every exporter,
+// exporters are identified by ExporterIdentity across files. Exporters with most sequence failures
+// come first, intervals are in file order. Only file meta data is read, flow records are not
+// decoded.
+func ExporterHealthReport(files []CaptureFile) (report []ExporterHealth, err error) {
+	var index = make(map[ExporterIdentity]int)
+
+	for _, file := range files {
+		var info *FileInfo
+		if info, err = fileInfo(file.Path); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Path, err)
+		}
+
+		var t = file.Time
+		if t.IsZero() {
+			t = info.FirstSeen
+		}
+
+		for _, e := range info.Exporters {
+			// Stats of a SysID without exporter record can not be attributed
+			if e.Exporter.IPAddr == nil {
+				continue
+			}
+
+			var identity = e.Exporter.Identity()
+			var x, ok = index[identity]
+			if !ok {
+				x = len(report)
+				index[identity] = x
+				report = append(report, ExporterHealth{})
+			}
+
+			var health = &report[x]
+			health.Exporter = e.Exporter
+			health.SequenceFailures += uint64(e.Stats.SequenceFailures)
+			health.Packets += e.Stats.Packets
+			health.Flows += e.Stats.Flows
+			health.Intervals = append(health.Intervals, ExporterInterval{
+				Path:             file.Path,
+				Time:             t,
+				SequenceFailures: e.Stats.SequenceFailures,
+				Packets:          e.Stats.Packets,
+				Flows:            e.Stats.Flows,
+			})
+		}
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].SequenceFailures > report[j].SequenceFailures
+	})
+	return report, nil
+}
+
+// fileInfo open file and read its FileInfo
+func fileInfo(path string) (info *FileInfo, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Info(bufio.NewReader(f))
+}
@@ -0,0 +1,163 @@
+package nfdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// statTestFile return the small test file uncompressed as one block with an exporter stat record
+// for SysID 1224 after the first 5 flows and a second one after the last flow
+func statTestFile(t *testing.T, failures uint32) []byte {
+	var split = splitTestFile(t)
+
+	var r = bytes.NewReader(split)
+	var header, stat, err = readFileHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []byte
+	var numRecords uint32
+	for x := uint32(0); x < header.NumBlocks; x++ {
+		var blockHeader NFBlockHeader
+		if err = binary.Read(r, binary.LittleEndian, &blockHeader); err != nil {
+			t.Fatal(err)
+		}
+		var data = make([]byte, blockHeader.Size)
+		if _, err = io.ReadFull(r, data); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, data...)
+		numRecords += blockHeader.NumRecords
+
+		// meta block and the first 5 flow blocks
+		if x == 5 {
+			records = append(records, statRecord(1224, failures, 100, 10)...)
+			numRecords++
+		}
+	}
+	records = append(records, statRecord(1224, 2*failures, 200, 20)...)
+	numRecords++
+
+	var buf bytes.Buffer
+	header.NumBlocks = 1
+	binary.Write(&buf, binary.LittleEndian, header)
+	binary.Write(&buf, binary.LittleEndian, stat)
+	binary.Write(&buf, binary.LittleEndian, NFBlockHeader{NumRecords: numRecords, Size: uint32(len(records)), ID: dataBlockID})
+	buf.Write(records)
+	return buf.Bytes()
+}
+
+// statRecord encode exporter stat record with one stat
+func statRecord(sysID uint32, failures uint32, packets uint64, flows uint64) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint16{ExporterStatRecordHeadType, 32})
+	binary.Write(&buf, binary.LittleEndian, []uint32{1, sysID, failures})
+	binary.Write(&buf, binary.LittleEndian, []uint64{packets, flows})
+	return buf.Bytes()
+}
+
+func TestExporterStatsAccumulate(t *testing.T) {
+	var data = statTestFile(t, 2)
+	var expected = NFExporterStatRecord{SysID: 1224, SequenceFailures: 6, Packets: 300, Flows: 30}
+
+	var nff, err = ParseReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nff.Records) != 10 || nff.ExporterStats[1224] != expected {
+		t.Errorf("Unexpected file records:%d stats:%+v", len(nff.Records), nff.ExporterStats)
+	}
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	var records int
+	for ; ; records++ {
+		if _, err = nfs.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if records != 10 || nfs.ExporterStats[1224] != expected {
+		t.Errorf("Unexpected stream records:%d stats:%+v", records, nfs.ExporterStats)
+	}
+
+	var info *FileInfo
+	if info, err = Info(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	var stats NFExporterStatRecord
+	for _, e := range info.Exporters {
+		if e.Exporter.SysID == 1224 {
+			stats = e.Stats
+		}
+	}
+	if info.RecordCount != 10 || stats != expected {
+		t.Errorf("Unexpected info records:%d stats:%+v", info.RecordCount, stats)
+	}
+}
+
+func TestExporterHealthReport(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var start = time.Date(2019, 8, 12, 18, 50, 0, 0, time.UTC)
+	var files []CaptureFile
+	for x, name := range []string{"nfcapd.201908121850", "nfcapd.201908121855"} {
+		var file = CaptureFile{
+			Path: filepath.Join(dir, name),
+			Time: start.Add(time.Duration(x) * 5 * time.Minute),
+		}
+		if err = ioutil.WriteFile(file.Path, statTestFile(t, uint32(3*x)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	var report []ExporterHealth
+	if report, err = ExporterHealthReport(files); err != nil {
+		t.Fatal(err)
+	}
+	var info *FileInfo
+	if info, err = fileInfo(files[0].Path); err != nil {
+		t.Fatal(err)
+	}
+	// Only SysID 1224 has stats
+	if len(report) == 0 || len(report) != len(info.Exporters) {
+		t.Fatalf("Unexpected exporters:%d expected %d", len(report), len(info.Exporters))
+	}
+
+	var health = report[0]
+	if health.Exporter.SysID != 1224 || health.SequenceFailures != 9 || health.Packets != 600 || health.Flows != 60 {
+		t.Errorf("Unexpected health:%+v", health)
+	}
+	if len(health.Intervals) != 2 {
+		t.Fatalf("Unexpected intervals:%+v", health.Intervals)
+	}
+	for x, interval := range health.Intervals {
+		if interval.Path != files[x].Path || !interval.Time.Equal(files[x].Time) || interval.SequenceFailures != uint32(3*3*x) || interval.Flows != 30 {
+			t.Errorf("Unexpected interval %d:%+v", x, interval)
+		}
+	}
+	for _, other := range report[1:] {
+		if other.SequenceFailures != 0 || len(other.Intervals) != 2 {
+			t.Errorf("Unexpected health:%+v", other)
+		}
+	}
+
+	if _, err = ExporterHealthReport([]CaptureFile{{Path: filepath.Join(dir, "missing")}}); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
@@ -0,0 +1,147 @@
+package nfdump
+
+import (
+	"io"
+	"sort"
+	"time"
+)
+
+// FileInfo summary of an nfdump file that can be collected without decoding flow records
+type FileInfo struct {
+	Header NFHeader
+
+	// Ident file ident string
+	Ident string
+	// LayoutVersion file layout version
+	LayoutVersion uint16
+	// Compression "none", "lzo", "bz2" or "lz4"
+	Compression string
+	Anonymized  bool
+	Catalog     bool
+	NumBlocks   uint32
+
+	StatRecord NFStatRecord
+	// FirstSeen LastSeen time range of all flows in the file, taken from StatRecord
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// Exporters all exporters of the file ordered by SysID
+	Exporters []ExporterInfo
+	// ExtensionMaps extension IDs of every extension map by map ID
+	ExtensionMaps map[uint16][]uint16
+	// RecordCount number of flow records in all data blocks
+	RecordCount uint64
+}
+
+// ExporterInfo exporter with its samplers and statistics
+type ExporterInfo struct {
+	Exporter NFExporterInfoRecord
+	Samplers []NFSamplerInfoRecord
+	Stats    NFExporterStatRecord
+}
+
+// Info read nfdump file header, stat record and the meta data records (exporters, samplers,
+// exporter stats and extension maps) of every block. Flow records are counted but not decoded.
+func Info(r io.Reader) (info *FileInfo, err error) {
+	var (
+		header    NFHeader
+		stat      NFStatRecord
+		data      []byte
+		exporters = make(map[uint16]*ExporterInfo)
+	)
+
+	if header, stat, err = readFileHeader(r); err != nil {
+		return nil, err
+	}
+
+	info = &FileInfo{
+		Header:        header,
+		Ident:         header.IdentString(),
+		LayoutVersion: header.Version,
+		Compression:   header.Compression(),
+		Anonymized:    header.Anonymized(),
+		Catalog:       header.Catalog(),
+		NumBlocks:     header.NumBlocks,
+		StatRecord:    stat,
+		FirstSeen:     time.Unix(int64(stat.FirstSeen), int64(stat.MSecFirst)*int64(time.Millisecond)),
+		LastSeen:      time.Unix(int64(stat.LastSeen), int64(stat.MSecLast)*int64(time.Millisecond)),
+		ExtensionMaps: make(map[uint16][]uint16),
+	}
+
+	var exporter = func(sysID uint16) *ExporterInfo {
+		if e, ok := exporters[sysID]; ok {
+			return e
+		}
+		var e = &ExporterInfo{}
+		e.Exporter.SysID = sysID
+		exporters[sysID] = e
+		return e
+	}
+
+	var blocks = blockReader{r: r, flags: header.Flags}
+	for {
+		if err = blocks.next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if blocks.header.ID != dataBlockID {
+			continue
+		}
+
+		if data, err = blocks.data(); err != nil {
+			return nil, err
+		}
+
+		var records = newRecordIter(data)
+		for count := uint32(0); count < blocks.header.NumRecords; count++ {
+			var ok bool
+			if ok, err = records.next(); err != nil {
+				return nil, err
+			} else if !ok {
+				break
+			}
+
+			switch records.recordType {
+			case ExtensionMapRecordHeadType:
+				var mapID uint16
+				var exts []uint16
+				if mapID, exts, err = decodeExtensionMap(records.record()); err != nil {
+					return nil, err
+				}
+				info.ExtensionMaps[mapID] = exts
+			case ExporterInfoRecordHeadType:
+				var e NFExporterInfoRecord
+				if e, err = decodeExporterInfo(records.record()); err != nil {
+					return nil, err
+				}
+				exporter(e.SysID).Exporter = e
+			case SamplerInfoRecordHeadType:
+				var s NFSamplerInfoRecord
+				if s, err = decodeSamplerInfo(records.record()); err != nil {
+					return nil, err
+				}
+				var e = exporter(s.ExporterSysID)
+				e.Samplers = append(e.Samplers, s)
+			case ExporterStatRecordHeadType:
+				for _, s := range decodeExporterStats(records.record()) {
+					var e = exporter(uint16(s.SysID))
+					e.Stats.SysID = s.SysID
+					e.Stats.add(s)
+				}
+			case 10:
+				info.RecordCount++
+			}
+		}
+	}
+
+	for _, e := range exporters {
+		info.Exporters = append(info.Exporters, *e)
+	}
+	sort.Slice(info.Exporters, func(i, j int) bool {
+		return info.Exporters[i].Exporter.SysID < info.Exporters[j].Exporter.SysID
+	})
+
+	return info, nil
+}
@@ -0,0 +1,107 @@
+package nfdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	var tests = []struct {
+		fileName    string
+		compression string
+		numBlocks   uint32
+		records     uint64
+	}{
+		{fileName: "testdata/nfcapd-small-lzo", compression: "lzo", numBlocks: 1, records: 10},
+		{fileName: "testdata/nfcapd-empty", compression: "none", numBlocks: 2, records: 0},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.fileName, func(t *testing.T) {
+			var data []byte
+			var err error
+			if data, err = ioutil.ReadFile(tc.fileName); err != nil {
+				t.Fatal(err)
+			}
+
+			var info *FileInfo
+			if info, err = Info(bytes.NewReader(data)); err != nil {
+				t.Fatalf("Info error:%v", err)
+			}
+
+			var nff *NFFile
+			if nff, err = ParseReader(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Ident != "none" || info.LayoutVersion != 1 || info.Compression != tc.compression || info.NumBlocks != tc.numBlocks {
+				t.Errorf("Unexpected header info:%+v", info)
+			}
+			if info.RecordCount != tc.records {
+				t.Errorf("Unexpected record count:%d expected %d", info.RecordCount, tc.records)
+			}
+			if info.FirstSeen.Unix() != int64(nff.StatRecord.FirstSeen) || info.LastSeen.Unix() != int64(nff.StatRecord.LastSeen) {
+				t.Errorf("Unexpected time range first:%s last:%s", info.FirstSeen, info.LastSeen)
+			}
+			if len(info.Exporters) != len(nff.Exporters) {
+				t.Errorf("Unexpected exporter count:%d expected %d", len(info.Exporters), len(nff.Exporters))
+			}
+			for x, exporter := range info.Exporters {
+				if x > 0 && info.Exporters[x-1].Exporter.SysID >= exporter.Exporter.SysID {
+					t.Errorf("Exporters not ordered by SysID")
+				}
+				if !exporter.Exporter.IPAddr.Equal(nff.Exporters[exporter.Exporter.SysID].IPAddr) {
+					t.Errorf("Unexpected exporter:%+v", exporter)
+				}
+				if len(exporter.Samplers) > 0 && exporter.Samplers[0].Interval != nff.SamplerInfo[exporter.Exporter.SysID].Interval {
+					t.Errorf("Unexpected sampler:%+v", exporter.Samplers[0])
+				}
+			}
+			if tc.records > 0 && len(info.ExtensionMaps) == 0 {
+				t.Errorf("Expected extension maps")
+			}
+		})
+	}
+}
+
+func TestInfoShortRecords(t *testing.T) {
+	var empty, err = ioutil.ReadFile("testdata/nfcapd-empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header NFHeader
+	var stat NFStatRecord
+	if header, stat, err = readFileHeader(bytes.NewReader(empty)); err != nil {
+		t.Fatal(err)
+	}
+	header.Flags &^= compressionMask
+	header.NumBlocks = 1
+
+	for _, recordType := range []uint16{ExtensionMapRecordHeadType, ExporterInfoRecordHeadType, SamplerInfoRecordHeadType} {
+		// Records with a valid record header too short for their contents
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, header)
+		binary.Write(&buf, binary.LittleEndian, stat)
+		binary.Write(&buf, binary.LittleEndian, NFBlockHeader{NumRecords: 1, Size: 4, ID: dataBlockID})
+		binary.Write(&buf, binary.LittleEndian, []uint16{recordType, 4})
+		var data = buf.Bytes()
+
+		if _, err = Info(bytes.NewReader(data)); err == nil {
+			t.Errorf("type %d: Expected Info error", recordType)
+		}
+		if _, err = ParseReader(bytes.NewReader(data)); err == nil {
+			t.Errorf("type %d: Expected ParseReader error", recordType)
+		}
+		var nfs *NFStream
+		if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = nfs.Row(); err == nil || err == io.EOF {
+			t.Errorf("type %d: Expected Row error got:%v", recordType, err)
+		}
+	}
+}
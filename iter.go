@@ -0,0 +1,80 @@
+//go:build go1.23
+// +build go1.23
+
+package nfdump
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// All return an iterator over the remaining records of the stream. The iteration ends at the end
+// of the file, an error is yielded once with an empty record and ends the iteration as well.
+//
+//	for record, err := range nfs.All() {
+//		if err != nil {
+//			return err
+//		}
+//	}
+func (nfs *NFStream) All() iter.Seq2[NFRecord, error] {
+	return nfs.AllContext(context.Background())
+}
+
+// AllContext like All, the iteration ends with the error of ctx when ctx is done before the next
+// block is read
+func (nfs *NFStream) AllContext(ctx context.Context) iter.Seq2[NFRecord, error] {
+	return allRecords(ctx, nfs.RowContext)
+}
+
+// All return an iterator over the remaining records of all files, see NFStream.All
+func (nfm *NFMultiStream) All() iter.Seq2[NFRecord, error] {
+	return nfm.AllContext(context.Background())
+}
+
+// AllContext like All, the iteration ends with the error of ctx when ctx is done before the next
+// block or file is read
+func (nfm *NFMultiStream) AllContext(ctx context.Context) iter.Seq2[NFRecord, error] {
+	return allRecords(ctx, nfm.RowContext)
+}
+
+// All return an iterator over the remaining merged records, see NFStream.All
+func (nfm *NFMergeStream) All() iter.Seq2[NFRecord, error] {
+	return nfm.AllContext(context.Background())
+}
+
+// AllContext like All, the iteration ends with the error of ctx when ctx is done before the next
+// block of any stream is read
+func (nfm *NFMergeStream) AllContext(ctx context.Context) iter.Seq2[NFRecord, error] {
+	return allRecords(ctx, nfm.RowContext)
+}
+
+// All return an iterator over the followed records, the iteration only ends after Close or with an
+// error. Use AllContext to stop waiting for new records.
+func (nff *NFFollowStream) All() iter.Seq2[NFRecord, error] {
+	return nff.AllContext(context.Background())
+}
+
+// AllContext like All, the iteration ends with the error of ctx when ctx is done while waiting for
+// new data or before the next block is read
+func (nff *NFFollowStream) AllContext(ctx context.Context) iter.Seq2[NFRecord, error] {
+	return allRecords(ctx, nff.RowContext)
+}
+
+// allRecords iterator over the records of rowContext until io.EOF, an error is yielded once
+func allRecords(ctx context.Context, rowContext func(ctx context.Context) (NFRecord, error)) iter.Seq2[NFRecord, error] {
+	return func(yield func(NFRecord, error) bool) {
+		for {
+			var record, err = rowContext(ctx)
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(NFRecord{}, err)
+				return
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+//go:build go1.23
+// +build go1.23
+
+package nfdump
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamAll(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected *NFFile
+	if expected, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	var records []NFRecord
+	for record, err := range nfs.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if !sameRecords(records, expected.Records) {
+		t.Errorf("Unexpected records:%d", len(records))
+	}
+
+	// Breaking out of the loop leaves the remaining records to the stream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for range nfs.All() {
+		break
+	}
+	records = records[:0]
+	for record, err := range nfs.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if !sameRecords(records, expected.Records[1:]) {
+		t.Errorf("Unexpected remaining records:%d", len(records))
+	}
+}
+
+func TestStreamAllContext(t *testing.T) {
+	var data = splitTestFile(t)
+
+	var nfs, err = StreamReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every flow is in its own block, the second record needs the next block
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var records int
+	for _, err := range nfs.AllContext(ctx) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) || records != 1 {
+				t.Errorf("Unexpected error:%v after records:%d", err, records)
+			}
+			break
+		}
+		records++
+		cancel()
+	}
+	if records != 1 {
+		t.Errorf("Unexpected records:%d", records)
+	}
+
+	// Blocks skipped by a filter are checked as well
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	nfs.SetFilter(RecordFilterFunc(func(record *NFRecord) bool { return false }))
+	var record NFRecord
+	if record, err = nfs.RowContext(ctx); !errors.Is(err, context.Canceled) || record.Flags != 0 {
+		t.Errorf("Unexpected error:%v", err)
+	}
+	if _, err = nfs.Row(); err != io.EOF {
+		t.Errorf("Context not reset, error:%v", err)
+	}
+}
+
+func TestMultiStreamAll(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected *NFFile
+	if expected, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var nfm = OpenFiles([]CaptureFile{{Path: "testdata/nfcapd-small-lzo"}, {Path: "testdata/nfcapd-small-lzo"}})
+	defer nfm.Close()
+	var records []NFRecord
+	for record, err := range nfm.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if !sameRecords(records, append(append([]NFRecord{}, expected.Records...), expected.Records...)) {
+		t.Errorf("Unexpected records:%d", len(records))
+	}
+}
+
+func TestMergeStreamAllContext(t *testing.T) {
+	var data = splitTestFile(t)
+	var expected, err = ParseReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nfm *NFMergeStream
+	if nfm, err = MergeReader(bytes.NewReader(data), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var records int
+	for _, err := range nfm.AllContext(ctx) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Unexpected error:%v", err)
+			}
+			break
+		}
+		records++
+		cancel()
+	}
+
+	// The merge continues where it was canceled without losing records
+	for _, err := range nfm.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		records++
+	}
+	if records != 2*len(expected.Records) {
+		t.Errorf("Unexpected records:%d expected %d", records, 2*len(expected.Records))
+	}
+}
+
+func TestFollowStreamAllContext(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var data = splitTestFile(t)
+	var expected *NFFile
+	if expected, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var nff = FollowReader(dir, "")
+	nff.SetPollInterval(5 * time.Millisecond)
+	defer nff.Close()
+
+	// all read records until ctx times out, Row of a follow stream never returns io.EOF
+	var all = func() (records []NFRecord) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		for record, err := range nff.AllContext(ctx) {
+			if err != nil {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("Unexpected error:%v", err)
+				}
+				break
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+
+	// Waiting for the current file to appear
+	if records := all(); len(records) != 0 {
+		t.Errorf("Unexpected records without a file:%d", len(records))
+	}
+
+	// Header, meta block and the first flow block followed by half of the next block
+	var current = filepath.Join(dir, "nfcapd.current.1234")
+	var firstFlow = int(fileHeaderSize+blockHeaderSize) + int(binary.LittleEndian.Uint32(data[fileHeaderSize+4:]))
+	var secondFlow = firstFlow + int(blockHeaderSize) + int(binary.LittleEndian.Uint32(data[firstFlow+4:]))
+	var split = secondFlow + 20
+	if err = ioutil.WriteFile(current, data[:split], 0644); err != nil {
+		t.Fatal(err)
+	}
+	var records = all()
+	if !sameRecords(records, expected.Records[:1]) {
+		t.Errorf("Unexpected records:%d", len(records))
+	}
+
+	var f *os.File
+	if f, err = os.OpenFile(current, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Write(data[split:])
+	f.Close()
+	if records = all(); !sameRecords(records, expected.Records[1:]) {
+		t.Errorf("Unexpected records after cancel:%d", len(records))
+	}
+}
@@ -0,0 +1,293 @@
+package nfdump
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+)
+
+// RecordJSON JSON representation of an NFRecord.
+//
+// Times are RFC 3339 strings in UTC with millisecond precision, addresses are dotted IPv4 or
+// IPv6 strings and protocol and TCP flags are given both as number and nfdump style string.
+// Optional addresses and the received time are omitted when not present in the record. ExporterIP
+// is only set when the record was encoded with the exporters of its file, e.g. by
+// NDJSONWriter.WriteStream.
+type RecordJSON struct {
+	First      time.Time  `json:"first"`
+	Last       time.Time  `json:"last"`
+	Received   *time.Time `json:"received,omitempty"`
+	DurationMS int64      `json:"duration_ms"`
+
+	Proto     uint8  `json:"proto"`
+	ProtoName string `json:"proto_name"`
+
+	SrcIP    string `json:"src_ip"`
+	DstIP    string `json:"dst_ip"`
+	SrcPort  uint16 `json:"src_port"`
+	DstPort  uint16 `json:"dst_port"`
+	ICMPType uint8  `json:"icmp_type"`
+	ICMPCode uint8  `json:"icmp_code"`
+
+	TCPFlags    uint8  `json:"tcp_flags"`
+	TCPFlagsStr string `json:"tcp_flags_str"`
+	FwdStatus   uint8  `json:"fwd_status"`
+	Tos         uint8  `json:"tos"`
+	DstTos      uint8  `json:"dst_tos"`
+	Dir         uint8  `json:"dir"`
+
+	Packets    uint64 `json:"packets"`
+	Bytes      uint64 `json:"bytes"`
+	OutPackets uint64 `json:"out_packets"`
+	OutBytes   uint64 `json:"out_bytes"`
+	Flows      uint64 `json:"flows"`
+
+	Input   uint32 `json:"input"`
+	Output  uint32 `json:"output"`
+	SrcAS   uint32 `json:"src_as"`
+	DstAS   uint32 `json:"dst_as"`
+	SrcMask uint8  `json:"src_mask"`
+	DstMask uint8  `json:"dst_mask"`
+	SrcVlan uint16 `json:"src_vlan"`
+	DstVlan uint16 `json:"dst_vlan"`
+
+	NextHopIP string `json:"next_hop_ip,omitempty"`
+	BGPNextIP string `json:"bgp_next_ip,omitempty"`
+	RouterIP  string `json:"router_ip,omitempty"`
+
+	ExporterSysID uint16 `json:"exporter_sysid"`
+	ExporterIP    string `json:"exporter_ip,omitempty"`
+}
+
+// msTime convert milliseconds since epoch to UTC time
+func msTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
+
+// ipString return address as string, empty string for a missing address
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// NewRecordJSON return JSON representation of record, exporters is used to resolve the exporter IP and may be nil
+func NewRecordJSON(record *NFRecord, exporters map[uint16]NFExporterInfoRecord) RecordJSON {
+	var rj = RecordJSON{
+		First:         msTime(record.StartTimeMS()),
+		Last:          msTime(record.EndTimeMS()),
+		DurationMS:    record.DurationMilliseconds(),
+		Proto:         record.Proto,
+		ProtoName:     ProtocolName(record.Proto),
+		SrcIP:         ipString(record.SrcIP),
+		DstIP:         ipString(record.DstIP),
+		SrcPort:       record.SrcPort,
+		DstPort:       record.DstPort,
+		ICMPType:      record.ICMPType,
+		ICMPCode:      record.ICMPCode,
+		TCPFlags:      record.TCPFlags,
+		TCPFlagsStr:   TCPFlagString(record.TCPFlags),
+		FwdStatus:     record.FwdStatus,
+		Tos:           record.Tos,
+		DstTos:        record.DstTos,
+		Dir:           record.Dir,
+		Packets:       record.PacketCount,
+		Bytes:         record.ByteCount,
+		OutPackets:    record.OutPkts,
+		OutBytes:      record.OutBytes,
+		Flows:         recordFlows(record),
+		Input:         record.Input,
+		Output:        record.Output,
+		SrcAS:         record.SrcAS,
+		DstAS:         record.DstAS,
+		SrcMask:       record.SrcMask,
+		DstMask:       record.DstMask,
+		SrcVlan:       record.SrcVlan,
+		DstVlan:       record.DstVLan,
+		NextHopIP:     ipString(record.NextHopIP),
+		BGPNextIP:     ipString(record.BGPNextIP),
+		RouterIP:      ipString(record.RouterIP),
+		ExporterSysID: record.ExporterSysID,
+	}
+
+	if record.Received != 0 {
+		var received = msTime(int64(record.Received))
+		rj.Received = &received
+	}
+	if exporter, ok := exporters[record.ExporterSysID]; ok {
+		rj.ExporterIP = ipString(exporter.IPAddr)
+	}
+
+	return rj
+}
+
+// HeaderJSON JSON representation of an NFHeader with decoded flags and ident string
+type HeaderJSON struct {
+	Magic       uint16 `json:"magic"`
+	Version     uint16 `json:"version"`
+	Flags       uint32 `json:"flags"`
+	Compression string `json:"compression"`
+	Anonymized  bool   `json:"anonymized"`
+	Catalog     bool   `json:"catalog"`
+	NumBlocks   uint32 `json:"num_blocks"`
+	Ident       string `json:"ident"`
+}
+
+// NewHeaderJSON return JSON representation of header
+func NewHeaderJSON(h NFHeader) HeaderJSON {
+	return HeaderJSON{
+		Magic:       h.Magic,
+		Version:     h.Version,
+		Flags:       h.Flags,
+		Compression: h.Compression(),
+		Anonymized:  h.Anonymized(),
+		Catalog:     h.Catalog(),
+		NumBlocks:   h.NumBlocks,
+		Ident:       h.IdentString(),
+	}
+}
+
+// StatRecordJSON JSON representation of an NFStatRecord, first and last seen are RFC 3339 times
+type StatRecordJSON struct {
+	NumFlows        uint64    `json:"flows"`
+	NumBytes        uint64    `json:"bytes"`
+	NumPackets      uint64    `json:"packets"`
+	NumFlowsTCP     uint64    `json:"flows_tcp"`
+	NumFlowsUDP     uint64    `json:"flows_udp"`
+	NumFlowsICMP    uint64    `json:"flows_icmp"`
+	NumFlowsOther   uint64    `json:"flows_other"`
+	NumBytesTCP     uint64    `json:"bytes_tcp"`
+	NumBytesUDP     uint64    `json:"bytes_udp"`
+	NumBytesICMP    uint64    `json:"bytes_icmp"`
+	NumBytesOther   uint64    `json:"bytes_other"`
+	NumPacketsTCP   uint64    `json:"packets_tcp"`
+	NumPacketsUDP   uint64    `json:"packets_udp"`
+	NumPacketsICMP  uint64    `json:"packets_icmp"`
+	NumPacketsOther uint64    `json:"packets_other"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+	SequenceFailure uint32    `json:"sequence_failures"`
+}
+
+// NewStatRecordJSON return JSON representation of stat record
+func NewStatRecordJSON(s NFStatRecord) StatRecordJSON {
+	return StatRecordJSON{
+		NumFlows:        s.NumFlows,
+		NumBytes:        s.NumBytes,
+		NumPackets:      s.NumPackets,
+		NumFlowsTCP:     s.NumFlowsTCP,
+		NumFlowsUDP:     s.NumFlowsUDP,
+		NumFlowsICMP:    s.NumFlowsICMP,
+		NumFlowsOther:   s.NumFlowsOther,
+		NumBytesTCP:     s.NumBytesTCP,
+		NumBytesUDP:     s.NumBytesUDP,
+		NumBytesICMP:    s.NumBytesICMP,
+		NumBytesOther:   s.NumBytesOther,
+		NumPacketsTCP:   s.NumPacketsTCP,
+		NumPacketsUDP:   s.NumPacketsUDP,
+		NumPacketsICMP:  s.NumPacketsICMP,
+		NumPacketsOther: s.NumPacketsOther,
+		FirstSeen:       msTime(int64(s.FirstSeen)*1000 + int64(s.MSecFirst)),
+		LastSeen:        msTime(int64(s.LastSeen)*1000 + int64(s.MSecLast)),
+		SequenceFailure: s.SequenceFailure,
+	}
+}
+
+// ExporterJSON JSON representation of an NFExporterInfoRecord
+type ExporterJSON struct {
+	Version  uint32 `json:"version"`
+	IPAddr   string `json:"ip"`
+	SAFamily uint16 `json:"sa_family"`
+	SysID    uint16 `json:"sysid"`
+	ID       uint32 `json:"id"`
+}
+
+// NewExporterJSON return JSON representation of exporter
+func NewExporterJSON(e NFExporterInfoRecord) ExporterJSON {
+	return ExporterJSON{
+		Version:  e.Version,
+		IPAddr:   ipString(e.IPAddr),
+		SAFamily: e.SAFamily,
+		SysID:    e.SysID,
+		ID:       e.ID,
+	}
+}
+
+// ExporterStatJSON JSON representation of an NFExporterStatRecord
+type ExporterStatJSON struct {
+	SysID            uint32 `json:"sysid"`
+	SequenceFailures uint32 `json:"sequence_failures"`
+	Packets          uint64 `json:"packets"`
+	Flows            uint64 `json:"flows"`
+}
+
+// NewExporterStatJSON return JSON representation of exporter stat record
+func NewExporterStatJSON(e NFExporterStatRecord) ExporterStatJSON {
+	return ExporterStatJSON{
+		SysID:            e.SysID,
+		SequenceFailures: e.SequenceFailures,
+		Packets:          e.Packets,
+		Flows:            e.Flows,
+	}
+}
+
+// SamplerJSON JSON representation of an NFSamplerInfoRecord, the sampler id is signed like in nfdump
+// where -1 is the exporter default sampler
+type SamplerJSON struct {
+	ID            int32  `json:"id"`
+	Interval      uint32 `json:"interval"`
+	Mode          uint16 `json:"mode"`
+	ExporterSysID uint16 `json:"exporter_sysid"`
+}
+
+// NewSamplerJSON return JSON representation of sampler
+func NewSamplerJSON(s NFSamplerInfoRecord) SamplerJSON {
+	return SamplerJSON{
+		ID:            int32(s.ID),
+		Interval:      s.Interval,
+		Mode:          s.Mode,
+		ExporterSysID: s.ExporterSysID,
+	}
+}
+
+// NDJSONWriter writes records as newline delimited JSON, one RecordJSON object per line
+type NDJSONWriter struct {
+	enc       *json.Encoder
+	exporters map[uint16]NFExporterInfoRecord
+}
+
+// NewNDJSONWriter create NDJSONWriter writing to w
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// SetExporters set exporters used to resolve the exporter IP of records
+func (nw *NDJSONWriter) SetExporters(exporters map[uint16]NFExporterInfoRecord) {
+	nw.exporters = exporters
+}
+
+// Write write a single record line
+func (nw *NDJSONWriter) Write(record *NFRecord) error {
+	return nw.enc.Encode(NewRecordJSON(record, nw.exporters))
+}
+
+// WriteStream write every remaining record of nfs, exporter IPs are resolved from nfs.Exporters
+func (nw *NDJSONWriter) WriteStream(nfs *NFStream) (err error) {
+	nw.exporters = nfs.Exporters
+
+	var record NFRecord
+	for {
+		if record, err = nfs.Row(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = nw.Write(&record); err != nil {
+			return err
+		}
+	}
+}
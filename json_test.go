@@ -0,0 +1,118 @@
+package nfdump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRecordJSON(t *testing.T) {
+	var data []byte
+	var err error
+	if data, err = json.Marshal(NewRecordJSON(&testData[0], nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = `{"first":"2019-08-12T18:50:47.958Z","last":"2019-08-12T18:50:47.958Z","received":"2019-08-12T18:51:57Z","duration_ms":0,` +
+		`"proto":6,"proto_name":"TCP","src_ip":"216.206.145.131","dst_ip":"209.148.205.55","src_port":443,"dst_port":41322,"icmp_type":0,"icmp_code":0,` +
+		`"tcp_flags":16,"tcp_flags_str":"...A....","fwd_status":0,"tos":0,"dst_tos":0,"dir":0,` +
+		`"packets":3000,"bytes":4500000,"out_packets":0,"out_bytes":0,"flows":1,` +
+		`"input":1170,"output":1264,"src_as":209,"dst_as":812,"src_mask":15,"dst_mask":20,"src_vlan":2,"dst_vlan":0,` +
+		`"next_hop_ip":"64.86.79.127","router_ip":"66.110.1.17","exporter_sysid":1224}`
+
+	if string(data) != expected {
+		t.Errorf("Unexpected JSON\n%s\n%s", data, expected)
+	}
+
+	var record = testData[0]
+	record.Received = 0
+	if data, err = json.Marshal(NewRecordJSON(&record, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"received"`) {
+		t.Errorf("Unexpected received time:%s", data)
+	}
+
+	// NFRecord keeps the default encoding and round trips
+	if data, err = json.Marshal(testData[0]); err != nil {
+		t.Fatal(err)
+	}
+	var decoded NFRecord
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.AddrRecord() != testData[0].AddrRecord() {
+		t.Errorf("Unexpected decoded record:%+v expected %+v", decoded, testData[0])
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo"); err != nil {
+		t.Fatal(err)
+	}
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = NewNDJSONWriter(&buf).WriteStream(nfs); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines int
+	var scanner = bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var record RecordJSON
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Line %d invalid JSON:%v", lines, err)
+		}
+		if record.ExporterIP != record.RouterIP {
+			t.Errorf("Unexpected exporter ip:%s expected %s", record.ExporterIP, record.RouterIP)
+		}
+		lines++
+	}
+
+	if lines != 10 {
+		t.Errorf("Unexpected line count:%d expected 10", lines)
+	}
+}
+
+func TestFileJSON(t *testing.T) {
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo"); err != nil {
+		t.Fatal(err)
+	}
+
+	var nff *NFFile
+	if nff, err = ParseReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		value    interface{}
+		contains string
+	}{
+		{value: NewHeaderJSON(nff.Header), contains: `"compression":"lzo","anonymized":false,"catalog":false,"num_blocks":1,"ident":"none"`},
+		{value: NewStatRecordJSON(nff.StatRecord), contains: `"first_seen":"2019-08-12T18:15:48.049Z","last_seen":"2019-08-12T18:51:43.101Z"`},
+		{value: NewExporterJSON(nff.Exporters[1224]), contains: `{"version":10,"ip":"66.110.1.17","sa_family":2,"sysid":1224,"id":525056}`},
+		{value: NewSamplerJSON(nff.SamplerInfo[1224]), contains: `{"id":-1,"interval":3000,"mode":0,"exporter_sysid":1224}`},
+		{value: NewExporterStatJSON(NFExporterStatRecord{SysID: 1, SequenceFailures: 2, Packets: 3, Flows: 4}), contains: `{"sysid":1,"sequence_failures":2,"packets":3,"flows":4}`},
+	}
+
+	for _, tc := range tests {
+		if data, err = json.Marshal(tc.value); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), tc.contains) {
+			t.Errorf("Unexpected JSON\n%s\nexpected to contain\n%s", data, tc.contains)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package nfdump
+
+import (
+	"container/heap"
+	"context"
+	"io"
+	"sort"
+)
+
+// NFMergeStream merges the records of several NFStreams into a single stream ordered by
+// StartTimeMS, like nfdump -M reading one file per exporter.
+//
+// Exporters, samplers and exporter stats of all streams are merged into one set of maps. When two
+// streams use the same SysID for different exporters the later one gets a new unused SysID and
+// ExporterSysID of its records is rewritten to match.
+type NFMergeStream struct {
+	// StatRecord sum of the stat records of all streams
+	StatRecord    NFStatRecord
+	Exporters     map[uint16]NFExporterInfoRecord
+	ExporterStats map[uint32]NFExporterStatRecord
+	SamplerInfo   map[uint16]NFSamplerInfoRecord
+	Samplers      map[SamplerKey]NFSamplerInfoRecord
+
+	sources    []*mergeSource
+	records    mergeHeap
+	bufferSize int
+	started    bool
+	filter     RecordFilter
+	merger     *exporterMerger
+	// ctx context of RowContext, checked before every block of every stream
+	ctx context.Context
+}
+
+// mergeSource a single stream of the merge
+type mergeSource struct {
+	index    int
+	nfs      *NFStream
+	sysIDMap map[uint16]uint16
+	// exporterRecords samplers number of stream exporter records and samplers already merged
+	exporterRecords int
+	samplers        int
+	eof             bool
+}
+
+// mergeRecord record waiting in the merge heap
+type mergeRecord struct {
+	record  NFRecord
+	startMS int64
+	source  *mergeSource
+}
+
+// mergeHeap min heap of records ordered by start time, ties keep stream order
+type mergeHeap []mergeRecord
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].startMS != h[j].startMS {
+		return h[i].startMS < h[j].startMS
+	}
+	return h[i].source.index < h[j].source.index
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeRecord)) }
+func (h *mergeHeap) Pop() interface{} {
+	var old = *h
+	var x = old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// MergeReader create StreamReader for every reader and merge them
+func MergeReader(readers ...io.Reader) (nfm *NFMergeStream, err error) {
+	var streams = make([]*NFStream, 0, len(readers))
+	for _, r := range readers {
+		var nfs *NFStream
+		if nfs, err = StreamReader(r); err != nil {
+			return nil, err
+		}
+		streams = append(streams, nfs)
+	}
+	return MergeStreams(streams...), nil
+}
+
+// MergeStreams merge records of streams in StartTimeMS order
+func MergeStreams(streams ...*NFStream) *NFMergeStream {
+	var merger = newExporterMerger()
+	var nfm = &NFMergeStream{
+		Exporters:     merger.exporters,
+		ExporterStats: merger.exporterStats,
+		SamplerInfo:   merger.samplerInfo,
+		Samplers:      merger.samplers,
+		bufferSize:    1,
+		merger:        merger,
+	}
+
+	for x, nfs := range streams {
+		nfm.sources = append(nfm.sources, newMergeSource(x, nfs))
+		mergeStatRecord(&nfm.StatRecord, nfs.StatRecord)
+	}
+
+	return nfm
+}
+
+// mergeStatRecord add counters of src to dst and widen the time range of dst
+func mergeStatRecord(dst *NFStatRecord, src NFStatRecord) {
+	var empty = dst.FirstSeen == 0 && dst.LastSeen == 0
+
+	dst.NumFlows += src.NumFlows
+	dst.NumBytes += src.NumBytes
+	dst.NumPackets += src.NumPackets
+	dst.NumFlowsTCP += src.NumFlowsTCP
+	dst.NumFlowsUDP += src.NumFlowsUDP
+	dst.NumFlowsICMP += src.NumFlowsICMP
+	dst.NumFlowsOther += src.NumFlowsOther
+	dst.NumBytesTCP += src.NumBytesTCP
+	dst.NumBytesUDP += src.NumBytesUDP
+	dst.NumBytesICMP += src.NumBytesICMP
+	dst.NumBytesOther += src.NumBytesOther
+	dst.NumPacketsTCP += src.NumPacketsTCP
+	dst.NumPacketsUDP += src.NumPacketsUDP
+	dst.NumPacketsICMP += src.NumPacketsICMP
+	dst.NumPacketsOther += src.NumPacketsOther
+	dst.SequenceFailure += src.SequenceFailure
+
+	if empty || src.FirstSeen < dst.FirstSeen || (src.FirstSeen == dst.FirstSeen && src.MSecFirst < dst.MSecFirst) {
+		dst.FirstSeen, dst.MSecFirst = src.FirstSeen, src.MSecFirst
+	}
+	if empty || src.LastSeen > dst.LastSeen || (src.LastSeen == dst.LastSeen && src.MSecLast > dst.MSecLast) {
+		dst.LastSeen, dst.MSecLast = src.LastSeen, src.MSecLast
+	}
+}
+
+// SetBufferSize number of records read ahead from every stream, must be called before the first Row.
+//
+// nfcapd writes records in the order flows are exported, not strictly by start time. With the
+// default of 1 the merge is only ordered as well as its input files, a larger buffer reorders
+// records within a window of n records per stream at the cost of n records of memory per stream.
+func (nfm *NFMergeStream) SetBufferSize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	nfm.bufferSize = n
+}
+
+// SetFilter only return records matching filter from Row. The filter sees the merged ExporterSysID.
+func (nfm *NFMergeStream) SetFilter(filter RecordFilter) {
+	nfm.filter = filter
+}
+
+// Row each call will return the NFRecord with the lowest StartTimeMS of all streams or an error.
+// io.EOF error means all streams are at end of file.
+func (nfm *NFMergeStream) Row() (record NFRecord, err error) {
+	if !nfm.started {
+		// Sources filled before an error get more records on the next call, the buffer only grows
+		for _, source := range nfm.sources {
+			for x := 0; x < nfm.bufferSize; x++ {
+				if err = nfm.fill(source); err != nil {
+					return record, err
+				}
+			}
+		}
+		nfm.started = true
+	}
+
+	for nfm.records.Len() > 0 {
+		var next = heap.Pop(&nfm.records).(mergeRecord)
+		if err = nfm.fill(next.source); err != nil {
+			// Keep the record for the next call
+			heap.Push(&nfm.records, next)
+			return record, err
+		}
+		if nfm.filter != nil && !nfm.filter.Match(&next.record) {
+			continue
+		}
+		return next.record, nil
+	}
+
+	return record, io.EOF
+}
+
+// fill read the next record of source into the heap
+func (nfm *NFMergeStream) fill(source *mergeSource) (err error) {
+	if source.eof {
+		return nil
+	}
+
+	var record NFRecord
+	if record, err = streamRow(source.nfs, nfm.ctx); err == io.EOF {
+		source.eof = true
+		nfm.merger.finish(source)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	nfm.merger.record(source, &record)
+	heap.Push(&nfm.records, mergeRecord{record: record, startMS: record.StartTimeMS(), source: source})
+	return nil
+}
+
+// exporterMerger merges exporters, samplers and exporter stats of several streams into one set
+// of maps. When two streams use the same SysID for different exporters the exporter merged later
+// gets the lowest unused SysID.
+type exporterMerger struct {
+	exporters     map[uint16]NFExporterInfoRecord
+	exporterStats map[uint32]NFExporterStatRecord
+	samplerInfo   map[uint16]NFSamplerInfoRecord
+	samplers      map[SamplerKey]NFSamplerInfoRecord
+	exporterIndex map[ExporterIdentity]uint16
+	nextSysID     uint16
+}
+
+// newExporterMerger create empty exporterMerger
+func newExporterMerger() *exporterMerger {
+	return &exporterMerger{
+		exporters:     make(map[uint16]NFExporterInfoRecord),
+		exporterStats: make(map[uint32]NFExporterStatRecord),
+		samplerInfo:   make(map[uint16]NFSamplerInfoRecord),
+		samplers:      make(map[SamplerKey]NFSamplerInfoRecord),
+		exporterIndex: make(map[ExporterIdentity]uint16),
+		nextSysID:     1,
+	}
+}
+
+// newMergeSource create mergeSource for nfs
+func newMergeSource(index int, nfs *NFStream) *mergeSource {
+	return &mergeSource{
+		index:    index,
+		nfs:      nfs,
+		sysIDMap: make(map[uint16]uint16),
+	}
+}
+
+// record rewrite ExporterSysID of a record read from source to the merged SysID
+func (em *exporterMerger) record(source *mergeSource, record *NFRecord) {
+	// Exporter records are read with the block, merge them before the first record of a new
+	// exporter so streams merged earlier keep their SysIDs
+	if source.nfs.exporterRecords != source.exporterRecords {
+		em.mergeExporters(source)
+	}
+	if len(source.nfs.Samplers) != source.samplers {
+		em.mergeSamplers(source)
+	}
+	record.ExporterSysID = em.sysID(source, record.ExporterSysID)
+}
+
+// finish merge remaining exporters and the exporter stats of a source at end of file, stats are
+// written at the end of a file
+func (em *exporterMerger) finish(source *mergeSource) {
+	em.mergeExporters(source)
+	em.mergeSamplers(source)
+
+	for sysID, stat := range source.nfs.ExporterStats {
+		stat.SysID = uint32(em.sysID(source, uint16(sysID)))
+		addExporterStat(em.exporterStats, stat)
+	}
+}
+
+// sysID return merged SysID of the source SysID, new exporters are added to the merged maps
+func (em *exporterMerger) sysID(source *mergeSource, sysID uint16) uint16 {
+	if merged, ok := source.sysIDMap[sysID]; ok {
+		return merged
+	}
+
+	var exporter, ok = source.nfs.Exporters[sysID]
+	if !ok {
+		// Exporter unknown to the stream, keep SysID as is
+		return sysID
+	}
+
+	var key = exporter.Identity()
+	var merged, known = em.exporterIndex[key]
+	if !known {
+		merged = sysID
+		if _, used := em.exporters[merged]; used {
+			merged = em.freeSysID()
+		}
+		em.exporterIndex[key] = merged
+	}
+
+	source.sysIDMap[sysID] = merged
+	exporter.SysID = merged
+	em.exporters[merged] = exporter
+
+	return merged
+}
+
+// freeSysID return lowest SysID not used by any merged exporter
+func (em *exporterMerger) freeSysID() uint16 {
+	for {
+		if _, ok := em.exporters[em.nextSysID]; !ok {
+			return em.nextSysID
+		}
+		em.nextSysID++
+	}
+}
+
+// mergeExporters merge all exporters of source in SysID order. A SysID reused by another exporter,
+// e.g. after nfcapd was restarted, is merged again.
+func (em *exporterMerger) mergeExporters(source *mergeSource) {
+	var sysIDs = make([]int, 0, len(source.nfs.Exporters))
+	for sysID, exporter := range source.nfs.Exporters {
+		if merged, ok := source.sysIDMap[sysID]; ok && em.exporters[merged].Identity() != exporter.Identity() {
+			delete(source.sysIDMap, sysID)
+		}
+		sysIDs = append(sysIDs, int(sysID))
+	}
+	sort.Ints(sysIDs)
+	for _, sysID := range sysIDs {
+		em.sysID(source, uint16(sysID))
+	}
+	source.exporterRecords = source.nfs.exporterRecords
+}
+
+// mergeSamplers merge all samplers of source with the merged SysID of their exporter
+func (em *exporterMerger) mergeSamplers(source *mergeSource) {
+	for key, sampler := range source.nfs.Samplers {
+		var merged = em.sysID(source, key.ExporterSysID)
+		sampler.ExporterSysID = merged
+		em.samplers[SamplerKey{ExporterSysID: merged, ID: key.ID}] = sampler
+
+		if sampler, ok := source.nfs.SamplerInfo[key.ExporterSysID]; ok {
+			sampler.ExporterSysID = merged
+			em.samplerInfo[merged] = sampler
+		}
+	}
+	source.samplers = len(source.nfs.Samplers)
+}
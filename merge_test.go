@@ -0,0 +1,141 @@
+package nfdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestMergeReader(t *testing.T) {
+	var small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nfm *NFMergeStream
+	if nfm, err = MergeReader(bytes.NewReader(small), bytes.NewReader(small)); err != nil {
+		t.Fatalf("MergeReader error:%v", err)
+	}
+	nfm.SetBufferSize(10)
+
+	var records []NFRecord
+	var record NFRecord
+	for {
+		if record, err = nfm.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Row error:%v", err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 20 {
+		t.Fatalf("Unexpected record count:%d", len(records))
+	}
+	for x := 1; x < len(records); x++ {
+		if records[x-1].StartTimeMS() > records[x].StartTimeMS() {
+			t.Errorf("Record %d out of order %d > %d", x, records[x-1].StartTimeMS(), records[x].StartTimeMS())
+		}
+	}
+	for _, record := range records {
+		if _, ok := nfm.Exporters[record.ExporterSysID]; !ok {
+			t.Errorf("Unknown exporter SysID:%d", record.ExporterSysID)
+		}
+	}
+
+	// Both files have identical exporters, no SysID is remapped
+	if len(nfm.Exporters) != 2407 || len(nfm.SamplerInfo) != 2405 {
+		t.Errorf("Unexpected exporters:%d samplers:%d", len(nfm.Exporters), len(nfm.SamplerInfo))
+	}
+	if nfm.StatRecord.NumFlows != 20 || nfm.StatRecord.NumBytes != 2*87993000 || nfm.StatRecord.FirstSeen != 1565633748 || nfm.StatRecord.LastSeen != 1565635903 {
+		t.Errorf("Unexpected stat record:%+v", nfm.StatRecord)
+	}
+}
+
+func TestMergeReaderSysIDCollision(t *testing.T) {
+	var small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var empty []byte
+	if empty, err = ioutil.ReadFile("testdata/nfcapd-empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	var nfm *NFMergeStream
+	if nfm, err = MergeReader(bytes.NewReader(small), bytes.NewReader(empty)); err != nil {
+		t.Fatalf("MergeReader error:%v", err)
+	}
+
+	var count int
+	for {
+		if _, err = nfm.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Row error:%v", err)
+		}
+		count++
+	}
+	if count != 10 {
+		t.Errorf("Unexpected record count:%d", count)
+	}
+
+	// SysID 1 is used by both files for different exporters
+	if len(nfm.Exporters) != 2408 {
+		t.Fatalf("Unexpected exporter count:%d", len(nfm.Exporters))
+	}
+	if !nfm.Exporters[1].IPAddr.Equal(net.ParseIP("66.110.1.81")) {
+		t.Errorf("Unexpected exporter SysID 1:%+v", nfm.Exporters[1])
+	}
+
+	var remapped = nfm.Exporters[2408]
+	if !remapped.IPAddr.Equal(net.ParseIP("127.0.0.1")) || remapped.SysID != 2408 {
+		t.Errorf("Unexpected remapped exporter:%+v", remapped)
+	}
+	if sampler := nfm.SamplerInfo[2408]; sampler.ExporterSysID != 2408 || sampler.Interval != 1 {
+		t.Errorf("Unexpected remapped sampler:%+v", sampler)
+	}
+	if nfm.SamplerInfo[1].Interval != 3000 {
+		t.Errorf("Unexpected sampler SysID 1:%+v", nfm.SamplerInfo[1])
+	}
+	if sampler, ok := nfm.Samplers[SamplerKey{ExporterSysID: 2408, ID: StandardSamplerID}]; !ok || sampler.ExporterSysID != 2408 {
+		t.Errorf("Unexpected remapped samplers:%+v", sampler)
+	}
+}
+
+func TestExporterMergerSysIDReused(t *testing.T) {
+	var em = newExporterMerger()
+	var nfs = &NFStream{Exporters: make(map[uint16]NFExporterInfoRecord)}
+	var source = newMergeSource(0, nfs)
+
+	nfs.Exporters[1] = NFExporterInfoRecord{SysID: 1, IPAddr: net.ParseIP("10.0.0.1"), Version: 9}
+	nfs.exporterRecords++
+	var record = NFRecord{ExporterSysID: 1}
+	em.record(source, &record)
+	if record.ExporterSysID != 1 {
+		t.Errorf("Unexpected SysID:%d", record.ExporterSysID)
+	}
+
+	// The stream reuses SysID 1 for another exporter
+	nfs.Exporters[1] = NFExporterInfoRecord{SysID: 1, IPAddr: net.ParseIP("10.0.0.2"), Version: 9}
+	nfs.exporterRecords++
+	record = NFRecord{ExporterSysID: 1}
+	em.record(source, &record)
+	if record.ExporterSysID != 2 {
+		t.Errorf("Unexpected SysID after reuse:%d", record.ExporterSysID)
+	}
+	if !em.exporters[1].IPAddr.Equal(net.ParseIP("10.0.0.1")) || !em.exporters[2].IPAddr.Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Unexpected exporters:%+v", em.exporters)
+	}
+
+	// The first exporter returns and gets its merged SysID back
+	nfs.Exporters[1] = NFExporterInfoRecord{SysID: 1, IPAddr: net.ParseIP("10.0.0.1"), Version: 9}
+	nfs.exporterRecords++
+	record = NFRecord{ExporterSysID: 1}
+	em.record(source, &record)
+	if record.ExporterSysID != 1 {
+		t.Errorf("Unexpected SysID after return:%d", record.ExporterSysID)
+	}
+}
@@ -0,0 +1,77 @@
+package nfdump
+
+import (
+	"bytes"
+	"os"
+)
+
+// NFFileStream NFStream decoding a memory mapped nfdump file, blocks are decoded in place and
+// uncompressed files are read without copying any block data. Must be closed to unmap the file.
+type NFFileStream struct {
+	*NFStream
+
+	file *os.File
+	data []byte
+}
+
+// OpenFile memory map the nfdump file at path and read its header. Records returned by Row do not
+// reference the mapping and stay valid after Close. On platforms without mmap support the whole
+// file is read into memory.
+//
+// The file must not be truncated while it is mapped, reading a truncated mapping crashes the
+// program. Use StreamReader for files that are still being written like nfcapd.current.
+func OpenFile(path string) (nffs *NFFileStream, err error) {
+	nffs = &NFFileStream{}
+	if nffs.file, err = os.Open(path); err != nil {
+		return nil, err
+	}
+
+	var stat os.FileInfo
+	if stat, err = nffs.file.Stat(); err != nil {
+		nffs.Close()
+		return nil, err
+	}
+	if nffs.data, err = mmapFile(nffs.file, stat.Size()); err != nil {
+		nffs.Close()
+		return nil, err
+	}
+
+	if nffs.NFStream, err = StreamReader(bytes.NewReader(nffs.data)); err != nil {
+		nffs.Close()
+		return nil, err
+	}
+	nffs.blocks.mem = nffs.data
+	nffs.blocks.memOffset = int(fileHeaderSize)
+	return nffs, nil
+}
+
+// Close unmap and close the file, Row returns os.ErrClosed afterwards
+func (nffs *NFFileStream) Close() (err error) {
+	if nffs.NFStream != nil {
+		// The current block may be a slice of the mapping, drop it before unmapping
+		nffs.blocks.mem = nil
+		nffs.blocks.r = closedReader{}
+		nffs.decompressedBlock = nil
+		nffs.records = recordIter{}
+		nffs.readNewBlock = true
+	}
+	if nffs.data != nil {
+		err = munmapFile(nffs.data)
+		nffs.data = nil
+	}
+	if nffs.file != nil {
+		if closeErr := nffs.file.Close(); err == nil {
+			err = closeErr
+		}
+		nffs.file = nil
+	}
+	return err
+}
+
+// closedReader io.Reader of a closed NFFileStream
+type closedReader struct{}
+
+// Read return os.ErrClosed
+func (closedReader) Read(p []byte) (int, error) {
+	return 0, os.ErrClosed
+}
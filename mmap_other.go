@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package nfdump
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile read size bytes of f into memory, used where mmap is not available
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	var data = make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// munmapFile nothing to release for data read into memory
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,148 @@
+package nfdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var split = filepath.Join(dir, "nfcapd.201908121850")
+	if err = ioutil.WriteFile(split, splitTestFile(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"testdata/nfcapd-small-lzo", split, "testdata/nfcapd-empty"} {
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+		var expected *NFFile
+		if expected, err = ParseReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		var nffs *NFFileStream
+		if nffs, err = OpenFile(path); err != nil {
+			t.Fatalf("%s: OpenFile error:%v", path, err)
+		}
+
+		var records []NFRecord
+		for {
+			var record NFRecord
+			if record, err = nffs.Row(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: Row error:%v", path, err)
+			}
+			records = append(records, record)
+		}
+		if !reflect.DeepEqual(nffs.Exporters, expected.Exporters) {
+			t.Errorf("%s: unexpected exporters:%d expected %d", path, len(nffs.Exporters), len(expected.Exporters))
+		}
+		if err = nffs.Close(); err != nil {
+			t.Errorf("%s: Close error:%v", path, err)
+		}
+
+		// Records must stay valid after the mapping is gone
+		if len(records) != len(expected.Records) || (len(records) > 0 && !reflect.DeepEqual(records, expected.Records)) {
+			t.Errorf("%s: unexpected records:%d expected %d", path, len(records), len(expected.Records))
+		}
+	}
+}
+
+func TestOpenFileZeroCopy(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "nfcapd.201908121850")
+	if err = ioutil.WriteFile(path, splitTestFile(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var nffs *NFFileStream
+	if nffs, err = OpenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	defer nffs.Close()
+
+	if _, err = nffs.Row(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The block of an uncompressed file is a slice of the mapping
+	var block = &nffs.decompressedBlock[0]
+	var inside = false
+	for x := range nffs.data {
+		if &nffs.data[x] == block {
+			inside = true
+			break
+		}
+	}
+	if !inside {
+		t.Errorf("Block data copied out of the file mapping")
+	}
+
+	if err = nffs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 2; x++ {
+		if _, err = nffs.Row(); err != os.ErrClosed {
+			t.Errorf("Expected os.ErrClosed after Close got:%v", err)
+		}
+	}
+}
+
+func TestOpenFileTruncated(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var data = splitTestFile(t)
+	var tests = []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "header", size: int(fileHeaderSize) - 1},
+		{name: "block header", size: int(fileHeaderSize) + 5},
+		{name: "block", size: len(data) - 1},
+	}
+
+	for _, tc := range tests {
+		var path = filepath.Join(dir, tc.name)
+		if err = ioutil.WriteFile(path, data[:tc.size], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var nffs *NFFileStream
+		if nffs, err = OpenFile(path); err != nil {
+			if tc.size >= int(fileHeaderSize) {
+				t.Errorf("%s: OpenFile error:%v", tc.name, err)
+			}
+			continue
+		}
+		for err == nil {
+			_, err = nffs.Row()
+		}
+		if err == io.EOF {
+			t.Errorf("%s: expected read error got io.EOF", tc.name)
+		}
+		nffs.Close()
+	}
+}
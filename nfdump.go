@@ -11,8 +11,6 @@ import (
 	"math"
 	"net"
 	"time"
-
-	"github.com/rasky/go-lzo"
 )
 
 const (
@@ -22,10 +20,15 @@ const (
 	// Compression types, currently only LZO is supported in this library
 	// notCompressed   = 0x0
 	lzoCompressed   = 0x1
+	anonymized      = 0x2
+	catalog         = 0x4
 	bz2Compressed   = 0x8
 	lz4Compressed   = 0x10
 	compressionMask = 0x19
 
+	// afInet exporter SAFamily of IPv4 exporters
+	afInet = 2
+
 	// Only 1 layout version is known/supported
 	layoutVersion = 1
 
@@ -53,7 +56,10 @@ type NFFile struct {
 	Meta          NFMeta
 	Exporters     map[uint16]NFExporterInfoRecord
 	ExporterStats map[uint32]NFExporterStatRecord
-	SamplerInfo   map[uint16]NFSamplerInfoRecord
+	// SamplerInfo sampler of each exporter, its standard sampler or else its last sampler. Records do
+	// not reference their sampler, see Samplers for all samplers.
+	SamplerInfo map[uint16]NFSamplerInfoRecord
+	Samplers    map[SamplerKey]NFSamplerInfoRecord
 }
 
 // NFSamplerInfoRecord store router sampling information
@@ -185,6 +191,10 @@ type NFRecord struct {
 	// Received Received Time Milliseconds
 	Received uint64
 
+	// SamplingInterval sampler interval the counters are scaled by, set by ScaleSampling. 0 when the
+	// exporter sampler is unknown or its samplers use different intervals.
+	SamplingInterval uint32
+
 	// Extensions 20-44 to be implemented later/as needed
 }
 
@@ -275,6 +285,40 @@ type NFHeader struct {
 	Ident     [128]byte
 }
 
+// Compression return name of the compression used by the file blocks, "none", "lzo", "bz2" or "lz4"
+func (h NFHeader) Compression() string {
+	switch {
+	case (h.Flags & compressionMask) == 0:
+		return "none"
+	case (h.Flags & lzoCompressed) > 0:
+		return "lzo"
+	case (h.Flags & bz2Compressed) > 0:
+		return "bz2"
+	case (h.Flags & lz4Compressed) > 0:
+		return "lz4"
+	}
+	return "unknown"
+}
+
+// Anonymized file flag set when addresses in the file were anonymized
+func (h NFHeader) Anonymized() bool {
+	return (h.Flags & anonymized) > 0
+}
+
+// Catalog file flag set when the file contains a catalog
+func (h NFHeader) Catalog() bool {
+	return (h.Flags & catalog) > 0
+}
+
+// IdentString return file ident as string without trailing zero bytes
+func (h NFHeader) IdentString() string {
+	var ident = h.Ident[:]
+	if i := bytes.IndexByte(ident, 0); i >= 0 {
+		ident = ident[:i]
+	}
+	return string(ident)
+}
+
 // NFBlockHeader NFDump Block Header
 type NFBlockHeader struct {
 	NumRecords uint32
@@ -290,6 +334,8 @@ var (
 	packetCount8Byte = uint16(math.Pow(2, 1))
 	// bytesCount8Byte used to determine if byte count is stored as 4 or 8 byte value
 	bytesCount8Byte = uint16(math.Pow(2, 2))
+	// flowSampled counters of the flow were scaled by the sampling interval
+	flowSampled = uint16(math.Pow(2, 7))
 )
 
 // reverseByteSlice reverse a slice of bytes, currently used for IP fields
@@ -303,31 +349,52 @@ func reverseByteSlice(a []byte) []byte {
 	return a
 }
 
+// decodeExporterIP decode the 16 byte exporter address of an exporter info record.
+// NFDump stores the address as 2 little endian uint64 integers, an IPv4 address is stored in the
+// low 4 bytes of the second integer.
+func decodeExporterIP(data []byte, family uint16) net.IP {
+	var ip = make(net.IP, 0, net.IPv6len)
+	if family == afInet {
+		return append(ip, reverseByteSlice(append([]byte(nil), data[8:12]...))...)
+	}
+	ip = append(ip, reverseByteSlice(append([]byte(nil), data[0:8]...))...)
+	return append(ip, reverseByteSlice(append([]byte(nil), data[8:16]...))...)
+}
+
 // ParseReader parse NFDump file content in io.Reader and return netflow records and stats
 func ParseReader(r io.Reader) (nff *NFFile, err error) {
+	return parseReader(r, nil)
+}
+
+// ParseReaderTimeRange parse NFDump file like ParseReader but only return records completely inside
+// [start, end] like nfdump -t, a zero start or end is unbounded. When the stat record of the file is
+// outside the range no block is read, with a BlockIndex of the file blocks without records in the
+// range are skipped without decompression. index may be nil.
+func ParseReaderTimeRange(r io.Reader, start time.Time, end time.Time, index *BlockIndex) (nff *NFFile, err error) {
+	return parseReader(r, newTimePruner(start, end, index))
+}
+
+// parseReader parse NFDump file, timeRange is optional
+func parseReader(r io.Reader, timeRange *timePruner) (nff *NFFile, err error) {
 
 	var (
-		blockData         []byte
 		decompressedBlock []byte
-		blockIndex        uint32
-		blockHeader       NFBlockHeader
 		blockRecordCount  int
 		ipSize            int
 		packetCountSize   int
 		byteCountSize     int
 		readOffset        int
-		start             int
 		extMap            = make(map[uint16][]uint16)
 		exts              []uint16
 		recordExtID       uint16
 		ok                bool
-		recordHeader      NFRecordHeader
 	)
 
 	nff = &NFFile{
 		Exporters:     make(map[uint16]NFExporterInfoRecord),
 		ExporterStats: make(map[uint32]NFExporterStatRecord),
 		SamplerInfo:   make(map[uint16]NFSamplerInfoRecord),
+		Samplers:      make(map[SamplerKey]NFSamplerInfoRecord),
 		Meta: NFMeta{
 			RecordIDCount: make(map[uint16]int),
 			BlockIDCount:  make(map[uint16]int),
@@ -356,244 +423,156 @@ func ParseReader(r io.Reader) (nff *NFFile, err error) {
 		return
 	}
 
+	if timeRange != nil && timeRange.skipFile(nff.StatRecord) {
+		return nff, nil
+	}
+
 	// This allows avoiding a bunch of slice grow events
 	nff.Records = make([]NFRecord, 0, nff.StatRecord.NumFlows)
+	var blocks = blockReader{r: r, flags: nff.Header.Flags}
 NextBlock:
-	for blockIndex = 1; blockIndex <= nff.Header.NumBlocks; blockIndex++ {
-		if err = binary.Read(r, binary.LittleEndian, &blockHeader); err != nil {
+	for blocks.index < int(nff.Header.NumBlocks) {
+		if err = blocks.readHeader(); err != nil {
 			err = ErrFailedReadBlockHeader
 			return
 		}
+		nff.Meta.BlockIDCount[blocks.header.ID]++
 
-		nff.Meta.BlockIDCount[blockHeader.ID]++
-		blockData = make([]byte, blockHeader.Size)
+		if timeRange != nil && timeRange.skipBlock(blocks.index, blocks.header) {
+			if err = blocks.skipData(); err != nil {
+				err = fmt.Errorf("Read Block Failed blockIndex:%d error:%w", blocks.index, err)
+				return
+			}
+			continue NextBlock
+		}
 
-		if err = binary.Read(r, binary.LittleEndian, &blockData); err != nil {
-			err = fmt.Errorf("Read Block Failed blockIndex:%d error:%w", blockIndex, err)
+		// Records reference the block data, every block is read into a new buffer
+		blocks.buf = nil
+		if _, err = blocks.readData(); err != nil {
+			err = fmt.Errorf("Read Block Failed blockIndex:%d error:%w", blocks.index, err)
 			return
 		}
 
 		// Only block type 2 is currently supported, any other types of data will be skipped
-		if blockHeader.ID != 2 {
-			goto NextBlock
+		if blocks.header.ID != dataBlockID {
+			continue NextBlock
 		}
 
-		if (nff.Header.Flags & compressionMask) == 0 {
-			decompressedBlock = blockData
-		} else if (nff.Header.Flags & lzoCompressed) > 0 {
-			if decompressedBlock, err = lzo.Decompress1X(bytes.NewReader(blockData), 0, 0); err != nil {
-				err = fmt.Errorf("lzo.Decompress1X() failed error:%w", err)
-				return
-			}
-		} else if (nff.Header.Flags & lz4Compressed) > 0 {
-			err = fmt.Errorf("LZ4 compression not supported")
-			return
-			// if _, err = lz4.Decode(decompressedBlock, blockData); err != nil {
-			// 	err = errors.Wrapf(err, "lz4.Decode() failed")
-			// 	return
-			// }
-		} else if (nff.Header.Flags & bz2Compressed) > 0 {
-			err = fmt.Errorf("BZ2 compression not supported")
-			return
-		} else {
-			err = fmt.Errorf("Unsupported File Flag Compression:%d", nff.Header.Flags)
+		if decompressedBlock, err = blocks.data(); err != nil {
 			return
 		}
 
 		blockRecordCount = 0
-		start = 0
+		var records = newRecordIter(decompressedBlock)
 	NextRecord:
 		for {
+			if ok, err = records.next(); err != nil {
+				return
+			} else if !ok {
+				continue NextBlock
+			}
 
 			// Keep count on records in block
 			blockRecordCount++
-			if len(decompressedBlock[start:]) > 0 {
-				recordHeader.Type = binary.LittleEndian.Uint16(decompressedBlock[start:][0:2])
-				recordHeader.Size = binary.LittleEndian.Uint16(decompressedBlock[start:][2:4])
-			} else {
-				recordHeader.Type = 0
-				recordHeader.Size = 0
-			}
 
 			// Keep count of how many of each record type
-			nff.Meta.RecordIDCount[recordHeader.Type]++
-			switch recordHeader.Type {
+			nff.Meta.RecordIDCount[records.recordType]++
+			switch records.recordType {
 			case ExtensionMapRecordHeadType:
-				var mapID = binary.LittleEndian.Uint16(decompressedBlock[start:][4:6])
-				var extSize = binary.LittleEndian.Uint16(decompressedBlock[start:][6:8])
-
-				// extSize == 0 extension map v2
-				// extSize > 0 extension map v1
-				if extSize == 0 {
-					err = fmt.Errorf("Unsupported extension map v2 file")
+				var mapID uint16
+				if mapID, exts, err = decodeExtensionMap(records.record()); err != nil {
 					return
 				}
-				var x uint16
-				var extStart uint16 = 6
-				var extEnd uint16 = 8
-				var newExtMapID uint16
-				/*
-					Subtract 8 for the size of the record header, mapID and extSize.
-					Type (2 byte) + Size (2 byte) + mapID (2 byte) + extSize (2 byte) = 8 bytes
-
-					Divide by 2 to get the total number of uint16 (2 byte) extension ID's
-
-					This is how to determine the total extensions in the record to read out and put in ext map.
-				*/
-
-				// If mapID already empty it before adding new extMapID's
-				if _, ok = extMap[mapID]; ok {
-					extMap[mapID] = nil
+				for _, extID := range exts {
+					nff.Meta.ExtUsage[extID]++
 				}
-
-				for x = 0; x < ((recordHeader.Size - 8) / 2); x++ {
-					extStart += 2
-					extEnd += 2
-					newExtMapID = binary.LittleEndian.Uint16(decompressedBlock[start:][extStart:extEnd])
-					if newExtMapID > 48 {
-						err = fmt.Errorf("Corrupt file, bad extMapID:%d mapID:%d", newExtMapID, mapID)
-						return
-					}
-					/*
-						v1 extension map aligns to 32bit so its possible there could be a 0 mapID at the end
-						When mapID is 0 just ignore it
-					*/
-					if newExtMapID != 0 {
-						nff.Meta.ExtUsage[newExtMapID]++
-						extMap[mapID] = append(extMap[mapID], newExtMapID)
-					}
-				}
-
-				start += int(recordHeader.Size)
-
+				extMap[mapID] = exts
 				continue NextRecord
 			case ExporterInfoRecordHeadType:
-				// Store Exporter in map 'exporters'
 				var exporter NFExporterInfoRecord
-				exporter.Version = binary.LittleEndian.Uint32(decompressedBlock[start:][4:8])
-				exporter.SAFamily = binary.LittleEndian.Uint16(decompressedBlock[start:][24:26])
-				exporter.SysID = binary.LittleEndian.Uint16(decompressedBlock[start:][26:28])
-				exporter.ID = binary.LittleEndian.Uint32(decompressedBlock[start:][28:32])
-
-				/*
-					NFDump stores the exporter IP as 2 uint64 integers. If the second uint64 [16:24]
-					is == 0 we assume its an IPv4 address and only need to use the [12:16] slice
-				*/
-				var ipNumber2 = binary.LittleEndian.Uint64(decompressedBlock[start:][16:24])
-				if ipNumber2 == 0 {
-					// IPv4
-					exporter.IPAddr = decompressedBlock[start:][12:16]
-				} else {
-					// IPv6
-					var tmpIP []byte
-					tmpIP = append(tmpIP, decompressedBlock[start:][16:24]...)
-					tmpIP = append(tmpIP, decompressedBlock[start:][8:16]...)
-					exporter.IPAddr = tmpIP
+				if exporter, err = decodeExporterInfo(records.record()); err != nil {
+					return
 				}
-
 				nff.Exporters[exporter.SysID] = exporter
-
-				start += int(recordHeader.Size)
 				continue NextRecord
 			case SamplerInfoRecordHeadType:
-				// Store Samplers in map 'Samplers'
-
 				var sampler NFSamplerInfoRecord
-				sampler.ID = binary.LittleEndian.Uint32(decompressedBlock[start:][4:8])
-				sampler.Interval = binary.LittleEndian.Uint32(decompressedBlock[start:][8:12])
-				sampler.Mode = binary.LittleEndian.Uint16(decompressedBlock[start:][12:14])
-				sampler.ExporterSysID = binary.LittleEndian.Uint16(decompressedBlock[start:][14:16])
-
-				nff.SamplerInfo[sampler.ExporterSysID] = sampler
-
-				start += int(recordHeader.Size)
+				if sampler, err = decodeSamplerInfo(records.record()); err != nil {
+					return
+				}
+				addSampler(nff.SamplerInfo, nff.Samplers, sampler)
 				continue NextRecord
 			case EmptyRecordHeadType:
 				continue NextBlock
 			case ExporterStatRecordHeadType:
-				// Exporter statistics records
-
-				var statCount uint32
-				var statPosition uint32
-				var statRecord NFExporterStatRecord
-
-				statCount = binary.LittleEndian.Uint32(decompressedBlock[start:][4:8])
-
-				for statPosition = 0; statPosition < statCount; statPosition++ {
-					j := (statPosition * 24) + 8 // each stat record is 24 bytes + 8 for header/stat count
-
-					statRecord.SysID = binary.LittleEndian.Uint32(decompressedBlock[start:][j : j+4])
-					statRecord.SequenceFailures = binary.LittleEndian.Uint32(decompressedBlock[start:][j+4 : j+8])
-					statRecord.Packets = binary.LittleEndian.Uint64(decompressedBlock[start:][j+8 : j+16])
-					statRecord.Flows = binary.LittleEndian.Uint64(decompressedBlock[start:][j+16 : j+24])
-
-					nff.ExporterStats[statRecord.SysID] = statRecord
+				// Exporter statistics records, a file can contain several for the same exporter
+				for _, stat := range decodeExporterStats(records.record()) {
+					addExporterStat(nff.ExporterStats, stat)
 				}
-
-				continue NextBlock
+				continue NextRecord
 			default:
-				if recordHeader.Type != 10 {
-					start += int(recordHeader.Size)
+				if records.recordType != 10 {
 					continue NextRecord
 				}
 			}
 
+			var data = decompressedBlock[records.start:]
 			var record NFRecord
-			record.Flags = binary.LittleEndian.Uint16(decompressedBlock[start:][4:6])
-			recordExtID = binary.LittleEndian.Uint16(decompressedBlock[start:][6:8])
-			record.MsecFirst = binary.LittleEndian.Uint16(decompressedBlock[start:][8:10])
-			record.MsecLast = binary.LittleEndian.Uint16(decompressedBlock[start:][10:12])
-			record.First = binary.LittleEndian.Uint32(decompressedBlock[start:][12:16])
-			record.Last = binary.LittleEndian.Uint32(decompressedBlock[start:][16:20])
-			record.FwdStatus = uint8(decompressedBlock[start:][20])
-			record.TCPFlags = uint8(decompressedBlock[start:][21])
-			record.Proto = uint8(decompressedBlock[start:][22])
-			record.Tos = uint8(decompressedBlock[start:][23])
+			record.Flags = binary.LittleEndian.Uint16(data[4:6])
+			recordExtID = binary.LittleEndian.Uint16(data[6:8])
+			record.MsecFirst = binary.LittleEndian.Uint16(data[8:10])
+			record.MsecLast = binary.LittleEndian.Uint16(data[10:12])
+			record.First = binary.LittleEndian.Uint32(data[12:16])
+			record.Last = binary.LittleEndian.Uint32(data[16:20])
+			record.FwdStatus = uint8(data[20])
+			record.TCPFlags = uint8(data[21])
+			record.Proto = uint8(data[22])
+			record.Tos = uint8(data[23])
 
 			if record.Proto == 1 || record.Proto == 58 {
-				record.ICMPType = uint8(decompressedBlock[start:][27])
-				record.ICMPCode = uint8(decompressedBlock[start:][26])
+				record.ICMPType = uint8(data[27])
+				record.ICMPCode = uint8(data[26])
 				record.SrcPort = 0
 				record.DstPort = (uint16(record.ICMPType) * 256) + uint16(record.ICMPCode)
 			} else {
-				record.SrcPort = binary.LittleEndian.Uint16(decompressedBlock[start:][24:26])
-				record.DstPort = binary.LittleEndian.Uint16(decompressedBlock[start:][26:28])
+				record.SrcPort = binary.LittleEndian.Uint16(data[24:26])
+				record.DstPort = binary.LittleEndian.Uint16(data[26:28])
 				record.ICMPType = 0
 				record.ICMPCode = 0
 			}
 
-			record.ExporterSysID = binary.LittleEndian.Uint16(decompressedBlock[start:][28:30])
-			record.Reserved = binary.LittleEndian.Uint16(decompressedBlock[start:][30:32])
+			record.ExporterSysID = binary.LittleEndian.Uint16(data[28:30])
+			record.Reserved = binary.LittleEndian.Uint16(data[30:32])
 
 			if (record.Flags & v6And) != 0 {
 				nff.Meta.IPv6Count++
-				record.SrcIP = append(record.SrcIP, reverseByteSlice(decompressedBlock[start:][32:40])...)
-				record.SrcIP = append(record.SrcIP, reverseByteSlice(decompressedBlock[start:][40:48])...)
+				record.SrcIP = append(record.SrcIP, reverseByteSlice(data[32:40])...)
+				record.SrcIP = append(record.SrcIP, reverseByteSlice(data[40:48])...)
 
-				record.DstIP = append(record.DstIP, reverseByteSlice(decompressedBlock[start:][48:56])...)
-				record.DstIP = append(record.DstIP, reverseByteSlice(decompressedBlock[start:][56:64])...)
+				record.DstIP = append(record.DstIP, reverseByteSlice(data[48:56])...)
+				record.DstIP = append(record.DstIP, reverseByteSlice(data[56:64])...)
 				ipSize = 32
 
 			} else {
 				nff.Meta.IPv4Count++
-				record.SrcIP = reverseByteSlice(decompressedBlock[start:][32:36])
-				record.DstIP = reverseByteSlice(decompressedBlock[start:][36:40])
+				record.SrcIP = reverseByteSlice(data[32:36])
+				record.DstIP = reverseByteSlice(data[36:40])
 				ipSize = 8
 			}
 
 			if (record.Flags & packetCount8Byte) != 0 {
-				record.PacketCount = binary.LittleEndian.Uint64(decompressedBlock[start:][(32 + ipSize):][0:8])
+				record.PacketCount = binary.LittleEndian.Uint64(data[(32 + ipSize):][0:8])
 				packetCountSize = 8
 			} else {
-				record.PacketCount = uint64(binary.LittleEndian.Uint32(decompressedBlock[start:][(32 + ipSize):][0:4]))
+				record.PacketCount = uint64(binary.LittleEndian.Uint32(data[(32 + ipSize):][0:4]))
 				packetCountSize = 4
 			}
 
 			if (record.Flags & bytesCount8Byte) != 0 {
-				record.ByteCount = binary.LittleEndian.Uint64(decompressedBlock[start:][(32 + packetCountSize + ipSize):][0:8])
+				record.ByteCount = binary.LittleEndian.Uint64(data[(32 + packetCountSize + ipSize):][0:8])
 				byteCountSize = 8
 			} else {
-				record.ByteCount = uint64(binary.LittleEndian.Uint32(decompressedBlock[start:][(32 + packetCountSize + ipSize):][0:4]))
+				record.ByteCount = uint64(binary.LittleEndian.Uint32(data[(32 + packetCountSize + ipSize):][0:4]))
 				byteCountSize = 4
 			}
 
@@ -607,68 +586,68 @@ NextBlock:
 			for _, extID := range exts {
 				switch extID {
 				case 4:
-					record.Input = uint32(binary.LittleEndian.Uint16(decompressedBlock[start:][readOffset:][0:2]))
+					record.Input = uint32(binary.LittleEndian.Uint16(data[readOffset:][0:2]))
 					readOffset += 2
-					record.Output = uint32(binary.LittleEndian.Uint16(decompressedBlock[start:][readOffset:][0:2]))
+					record.Output = uint32(binary.LittleEndian.Uint16(data[readOffset:][0:2]))
 					readOffset += 2
 				case 5:
-					record.Input = binary.LittleEndian.Uint32(decompressedBlock[start:][readOffset:][0:4])
+					record.Input = binary.LittleEndian.Uint32(data[readOffset:][0:4])
 					readOffset += 4
-					record.Output = binary.LittleEndian.Uint32(decompressedBlock[start:][readOffset:][0:4])
+					record.Output = binary.LittleEndian.Uint32(data[readOffset:][0:4])
 					readOffset += 4
 				case 6:
-					record.SrcAS = uint32(binary.LittleEndian.Uint16(decompressedBlock[start:][readOffset:][0:2]))
+					record.SrcAS = uint32(binary.LittleEndian.Uint16(data[readOffset:][0:2]))
 					readOffset += 2
-					record.DstAS = uint32(binary.LittleEndian.Uint16(decompressedBlock[start:][readOffset:][0:2]))
+					record.DstAS = uint32(binary.LittleEndian.Uint16(data[readOffset:][0:2]))
 					readOffset += 2
 				case 7:
-					record.SrcAS = binary.LittleEndian.Uint32(decompressedBlock[start:][readOffset:][0:4])
+					record.SrcAS = binary.LittleEndian.Uint32(data[readOffset:][0:4])
 					readOffset += 4
-					record.DstAS = binary.LittleEndian.Uint32(decompressedBlock[start:][readOffset:][0:4])
+					record.DstAS = binary.LittleEndian.Uint32(data[readOffset:][0:4])
 					readOffset += 4
 				case 8:
-					record.DstTos = decompressedBlock[start:][readOffset:][0]
+					record.DstTos = data[readOffset:][0]
 					readOffset++
-					record.Dir = decompressedBlock[start:][readOffset:][0]
+					record.Dir = data[readOffset:][0]
 					readOffset++
-					record.SrcMask = decompressedBlock[start:][readOffset:][0]
+					record.SrcMask = data[readOffset:][0]
 					readOffset++
-					record.DstMask = decompressedBlock[start:][readOffset:][0]
+					record.DstMask = data[readOffset:][0]
 					readOffset++
 				case 9:
-					record.NextHopIP = reverseByteSlice(decompressedBlock[start:][readOffset:][0:4])
+					record.NextHopIP = reverseByteSlice(data[readOffset:][0:4])
 					readOffset += 4
 				case 10:
-					record.NextHopIP = reverseByteSlice(decompressedBlock[start:][readOffset:][0:16])
+					record.NextHopIP = reverseByteSlice(data[readOffset:][0:16])
 					readOffset += 16
 				case 11:
-					record.BGPNextIP = reverseByteSlice(decompressedBlock[start:][readOffset:][0:4])
+					record.BGPNextIP = reverseByteSlice(data[readOffset:][0:4])
 					readOffset += 4
 				case 12:
-					record.BGPNextIP = reverseByteSlice(decompressedBlock[start:][readOffset:][0:16])
+					record.BGPNextIP = reverseByteSlice(data[readOffset:][0:16])
 					readOffset += 16
 				case 13:
-					record.SrcVlan = binary.LittleEndian.Uint16(decompressedBlock[start:][readOffset:][0:2])
+					record.SrcVlan = binary.LittleEndian.Uint16(data[readOffset:][0:2])
 					readOffset += 2
-					record.DstVLan = binary.LittleEndian.Uint16(decompressedBlock[start:][readOffset:][0:2])
+					record.DstVLan = binary.LittleEndian.Uint16(data[readOffset:][0:2])
 					readOffset += 2
 				case 14:
-					record.OutPkts = uint64(binary.LittleEndian.Uint32(decompressedBlock[start:][readOffset:][0:4]))
+					record.OutPkts = uint64(binary.LittleEndian.Uint32(data[readOffset:][0:4]))
 					readOffset += 4
 				case 15:
-					record.OutPkts = binary.LittleEndian.Uint64(decompressedBlock[start:][readOffset:][0:8])
+					record.OutPkts = binary.LittleEndian.Uint64(data[readOffset:][0:8])
 					readOffset += 8
 				case 16:
-					record.OutBytes = uint64(binary.LittleEndian.Uint32(decompressedBlock[start:][readOffset:][0:4]))
+					record.OutBytes = uint64(binary.LittleEndian.Uint32(data[readOffset:][0:4]))
 					readOffset += 4
 				case 17:
-					record.OutBytes = binary.LittleEndian.Uint64(decompressedBlock[start:][readOffset:][0:8])
+					record.OutBytes = binary.LittleEndian.Uint64(data[readOffset:][0:8])
 					readOffset += 8
 				case 18:
-					record.AggeFlows = uint64(binary.LittleEndian.Uint32(decompressedBlock[start:][readOffset:][0:4]))
+					record.AggeFlows = uint64(binary.LittleEndian.Uint32(data[readOffset:][0:4]))
 					readOffset += 4
 				case 19:
-					record.AggeFlows = binary.LittleEndian.Uint64(decompressedBlock[start:][readOffset:][0:8])
+					record.AggeFlows = binary.LittleEndian.Uint64(data[readOffset:][0:8])
 					readOffset += 8
 				case 20:
 					// To be added later or as needed
@@ -680,11 +659,11 @@ NextBlock:
 					// To be added later or as needed
 					readOffset += 40
 				case 23:
-					record.RouterIP = reverseByteSlice(decompressedBlock[start:][readOffset:][0:4])
+					record.RouterIP = reverseByteSlice(data[readOffset:][0:4])
 					readOffset += 4
 				case 24:
-					record.RouterIP = append(record.RouterIP, reverseByteSlice(decompressedBlock[start:][readOffset:][0:8])...)
-					record.RouterIP = append(record.RouterIP, reverseByteSlice(decompressedBlock[start:][readOffset:][8:16])...)
+					record.RouterIP = append(record.RouterIP, reverseByteSlice(data[readOffset:][0:8])...)
+					record.RouterIP = append(record.RouterIP, reverseByteSlice(data[readOffset:][8:16])...)
 					readOffset += 16
 				case 25:
 					// To be added later or as needed
@@ -693,7 +672,7 @@ NextBlock:
 					// To be added later or as needed
 					readOffset += 8
 				case 27:
-					record.Received = binary.LittleEndian.Uint64(decompressedBlock[start:][readOffset:][0:8])
+					record.Received = binary.LittleEndian.Uint64(data[readOffset:][0:8])
 					readOffset += 8
 				case 28:
 					// reserved
@@ -751,10 +730,11 @@ NextBlock:
 				}
 			}
 
-			start += int(recordHeader.Size)
-			nff.Records = append(nff.Records, record)
+			if timeRange == nil || timeRange.match(&record) {
+				nff.Records = append(nff.Records, record)
+			}
 
-			if blockHeader.NumRecords == uint32(blockRecordCount) {
+			if blocks.header.NumRecords == uint32(blockRecordCount) {
 				continue NextBlock
 			}
 
@@ -0,0 +1,127 @@
+package nfdump
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"sync"
+)
+
+// processBuffer records queued per worker before Process waits for the worker
+const processBuffer = 256
+
+// RecordReader reads records one at a time, implemented by NFStream and all other streams
+type RecordReader interface {
+	Row() (record NFRecord, err error)
+}
+
+// RecordHandler handles a record on worker, a worker handles one record at a time so per worker
+// state needs no locking
+type RecordHandler func(worker int, record *NFRecord) error
+
+// PartitionKey key of a record, records with the same key are handled by the same worker
+type PartitionKey func(record *NFRecord) uint64
+
+// SrcIPKey PartitionKey hashing the source IP
+func SrcIPKey(record *NFRecord) uint64 {
+	return ipHash(record.SrcIP)
+}
+
+// DstIPKey PartitionKey hashing the destination IP
+func DstIPKey(record *NFRecord) uint64 {
+	return ipHash(record.DstIP)
+}
+
+// ipHash FNV-1a hash of ip, IPv4 addresses in 16 byte form hash like 4 byte ones
+func ipHash(ip net.IP) uint64 {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	var h = fnv.New64a()
+	h.Write(ip)
+	return h.Sum64()
+}
+
+// Process read all records of r and handle them on workers goroutines. With a key records are
+// partitioned by key, without records are distributed round robin. Reading waits when the worker of
+// a record is busy and its queue is full. The first error of r, a handler or ctx stops reading,
+// records still queued are dropped and the error is returned after all workers are done.
+func Process(ctx context.Context, r RecordReader, workers int, key PartitionKey, handler RecordHandler) (err error) {
+	if workers < 1 {
+		return fmt.Errorf("Invalid worker count:%d", workers)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		queues   = make([]chan NFRecord, workers)
+	)
+	var fail = func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for worker := range queues {
+		queues[worker] = make(chan NFRecord, processBuffer)
+		wg.Add(1)
+		go func(worker int, queue <-chan NFRecord) {
+			defer wg.Done()
+			for record := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := handler(worker, &record); err != nil {
+					fail(fmt.Errorf("worker %d: %w", worker, err))
+				}
+			}
+		}(worker, queues[worker])
+	}
+
+	var done = ctx.Done()
+Read:
+	for n := uint64(0); ; n++ {
+		select {
+		case <-done:
+			break Read
+		default:
+		}
+
+		var record NFRecord
+		if record, err = r.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			fail(err)
+			break
+		}
+
+		var worker = n
+		if key != nil {
+			worker = key(&record)
+		}
+
+		select {
+		case queues[worker%uint64(workers)] <- record:
+		case <-done:
+			break Read
+		}
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	// Cancelled by the caller
+	return ctx.Err()
+}
@@ -0,0 +1,140 @@
+package nfdump
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+)
+
+// testRecordReader returns records with 16 source IPs, then err
+type testRecordReader struct {
+	records int
+	n       int
+	err     error
+}
+
+func (r *testRecordReader) Row() (record NFRecord, err error) {
+	if r.n == r.records {
+		if r.err != nil {
+			return record, r.err
+		}
+		return record, io.EOF
+	}
+	r.n++
+	record.SrcIP = net.IP{10, 0, 0, byte(r.n % 16)}
+	record.ByteCount = uint64(r.n)
+	return record, nil
+}
+
+func TestProcess(t *testing.T) {
+	var tests = []struct {
+		name    string
+		workers int
+		key     PartitionKey
+	}{
+		{name: "partitioned", workers: 4, key: SrcIPKey},
+		{name: "round robin", workers: 3, key: nil},
+		{name: "single worker", workers: 1, key: DstIPKey},
+	}
+
+	for _, tc := range tests {
+		var r = &testRecordReader{records: 10000}
+
+		// Per worker state needs no locking
+		var byteCounts = make([]uint64, tc.workers)
+		var sources = make([]map[string]bool, tc.workers)
+		for worker := range sources {
+			sources[worker] = make(map[string]bool)
+		}
+		var err = Process(context.Background(), r, tc.workers, tc.key, func(worker int, record *NFRecord) error {
+			byteCounts[worker] += record.ByteCount
+			sources[worker][record.SrcIP.String()] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: Process error:%v", tc.name, err)
+		}
+
+		var total uint64
+		var workers = make(map[string]int)
+		for worker := range byteCounts {
+			total += byteCounts[worker]
+			for source := range sources[worker] {
+				workers[source]++
+			}
+		}
+		if total != 10000*10001/2 {
+			t.Errorf("%s: unexpected bytes:%d", tc.name, total)
+		}
+		if tc.key == nil {
+			continue
+		}
+		for source, n := range workers {
+			if n != 1 {
+				t.Errorf("%s: source %s handled by %d workers", tc.name, source, n)
+			}
+		}
+	}
+}
+
+func TestProcessStream(t *testing.T) {
+	var f, err = os.Open("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(f); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var records int
+	if err = Process(context.Background(), nfs, 2, SrcIPKey, func(worker int, record *NFRecord) error {
+		mu.Lock()
+		defer mu.Unlock()
+		records++
+		return nil
+	}); err != nil || records != 10 {
+		t.Errorf("Unexpected error:%v records:%d", err, records)
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	var errHandler = errors.New("handler failed")
+	var errRead = errors.New("read failed")
+
+	var handled int
+	var err = Process(context.Background(), &testRecordReader{records: 100000}, 1, nil, func(worker int, record *NFRecord) error {
+		handled++
+		if handled == 10 {
+			return errHandler
+		}
+		return nil
+	})
+	if !errors.Is(err, errHandler) || handled != 10 {
+		t.Errorf("Unexpected error:%v handled:%d", err, handled)
+	}
+
+	var r = &testRecordReader{records: 10, err: errRead}
+	if err = Process(context.Background(), r, 2, nil, func(worker int, record *NFRecord) error { return nil }); !errors.Is(err, errRead) {
+		t.Errorf("Unexpected error:%v", err)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	r = &testRecordReader{records: 100000}
+	if err = Process(ctx, r, 2, nil, func(worker int, record *NFRecord) error {
+		cancel()
+		return nil
+	}); !errors.Is(err, context.Canceled) || r.n == r.records {
+		t.Errorf("Unexpected error:%v read:%d", err, r.n)
+	}
+
+	if err = Process(context.Background(), r, 0, nil, nil); err == nil {
+		t.Errorf("Expected error for no workers")
+	}
+}
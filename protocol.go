@@ -0,0 +1,75 @@
+package nfdump
+
+import (
+	"strconv"
+	"strings"
+)
+
+// protocolNames IANA protocol numbers with the short names nfdump uses when printing and filtering
+var protocolNames = map[uint8]string{
+	0:   "HOPOPT",
+	1:   "ICMP",
+	2:   "IGMP",
+	3:   "GGP",
+	4:   "IPv4",
+	6:   "TCP",
+	8:   "EGP",
+	9:   "IGP",
+	17:  "UDP",
+	27:  "RDP",
+	41:  "IPv6",
+	43:  "IPv6-Route",
+	44:  "IPv6-Frag",
+	46:  "RSVP",
+	47:  "GRE",
+	50:  "ESP",
+	51:  "AH",
+	58:  "ICMP6",
+	59:  "IPv6-NoNxt",
+	60:  "IPv6-Opts",
+	88:  "EIGRP",
+	89:  "OSPF",
+	94:  "IPIP",
+	103: "PIM",
+	108: "IPComp",
+	112: "VRRP",
+	115: "L2TP",
+	132: "SCTP",
+	136: "UDPLite",
+	137: "MPLS-in-IP",
+}
+
+// protocolAliases extra names accepted by ProtocolNumber
+var protocolAliases = map[string]uint8{
+	"icmpv6":    58,
+	"ipv6-icmp": 58,
+	"ospfigp":   89,
+}
+
+// ProtocolName return nfdump style protocol name, unknown protocols are returned as their number
+func ProtocolName(proto uint8) string {
+	if name, ok := protocolNames[proto]; ok {
+		return name
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// ProtocolNumber return protocol number for a protocol name or number string, lookup is case insensitive
+func ProtocolNumber(name string) (proto uint8, ok bool) {
+	var n uint64
+	var err error
+	if n, err = strconv.ParseUint(name, 10, 8); err == nil {
+		return uint8(n), true
+	}
+
+	name = strings.ToLower(name)
+	if proto, ok = protocolAliases[name]; ok {
+		return proto, ok
+	}
+	for number, protoName := range protocolNames {
+		if strings.ToLower(protoName) == name {
+			return number, true
+		}
+	}
+	return 0, false
+}
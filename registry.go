@@ -0,0 +1,205 @@
+package nfdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"sync"
+)
+
+// exporterRegistryVersion version of the registry format written by ExporterRegistry.Write
+const exporterRegistryVersion = 1
+
+// ExporterRegistry assigns stable global IDs to exporters by ExporterIdentity, so records of files
+// and collectors using different SysIDs for the same exporter can be grouped. Global IDs start at 1
+// and fit ExporterSysID. The registry can be saved with Write and loaded with ReadExporterRegistry to
+// keep IDs stable across runs.
+//
+// ExporterRegistry is safe for concurrent use, every stream uses its own ExporterRewriter.
+type ExporterRegistry struct {
+	mu        sync.RWMutex
+	ids       map[ExporterIdentity]uint16
+	exporters map[uint16]NFExporterInfoRecord
+}
+
+// exporterRegistryJSON JSON representation of an ExporterRegistry
+type exporterRegistryJSON struct {
+	Version   int            `json:"version"`
+	Exporters []ExporterJSON `json:"exporters"`
+}
+
+// NewExporterRegistry create empty ExporterRegistry
+func NewExporterRegistry() *ExporterRegistry {
+	return &ExporterRegistry{
+		ids:       make(map[ExporterIdentity]uint16),
+		exporters: make(map[uint16]NFExporterInfoRecord),
+	}
+}
+
+// Register return the global ID of exporter, an exporter seen for the first time gets the next free
+// ID. Fails when all IDs are used.
+func (reg *ExporterRegistry) Register(exporter NFExporterInfoRecord) (id uint16, err error) {
+	var identity = exporter.Identity()
+
+	reg.mu.RLock()
+	id, ok := reg.ids[identity]
+	reg.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	// Registered by another stream in the meantime
+	if id, ok = reg.ids[identity]; ok {
+		return id, nil
+	}
+	if len(reg.ids) >= math.MaxUint16 {
+		return 0, fmt.Errorf("Exporter registry full, exporters:%d", len(reg.ids))
+	}
+
+	id = uint16(len(reg.ids) + 1)
+	exporter.SysID = id
+	reg.ids[identity] = id
+	reg.exporters[id] = exporter
+	return id, nil
+}
+
+// Lookup return exporter of global ID id, SysID of the exporter is the global ID
+func (reg *ExporterRegistry) Lookup(id uint16) (exporter NFExporterInfoRecord, ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	exporter, ok = reg.exporters[id]
+	return exporter, ok
+}
+
+// Exporters return a copy of all registered exporters by global ID, e.g. to resolve rewritten
+// records with NewRecordJSON
+func (reg *ExporterRegistry) Exporters() map[uint16]NFExporterInfoRecord {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	var exporters = make(map[uint16]NFExporterInfoRecord, len(reg.exporters))
+	for id, exporter := range reg.exporters {
+		exporters[id] = exporter
+	}
+	return exporters
+}
+
+// Write write registry as JSON
+func (reg *ExporterRegistry) Write(w io.Writer) error {
+	reg.mu.RLock()
+	var rj = exporterRegistryJSON{Version: exporterRegistryVersion}
+	for _, exporter := range reg.exporters {
+		rj.Exporters = append(rj.Exporters, NewExporterJSON(exporter))
+	}
+	reg.mu.RUnlock()
+
+	sort.Slice(rj.Exporters, func(i, j int) bool {
+		return rj.Exporters[i].SysID < rj.Exporters[j].SysID
+	})
+	return json.NewEncoder(w).Encode(rj)
+}
+
+// ReadExporterRegistry read registry written by ExporterRegistry.Write
+func ReadExporterRegistry(r io.Reader) (reg *ExporterRegistry, err error) {
+	var rj exporterRegistryJSON
+	if err = json.NewDecoder(r).Decode(&rj); err != nil {
+		return nil, err
+	}
+	if rj.Version != exporterRegistryVersion {
+		return nil, fmt.Errorf("Unsupported exporter registry version:%d", rj.Version)
+	}
+
+	reg = NewExporterRegistry()
+	for _, e := range rj.Exporters {
+		var exporter = NFExporterInfoRecord{
+			Version:  e.Version,
+			IPAddr:   net.ParseIP(e.IPAddr),
+			SAFamily: e.SAFamily,
+			SysID:    e.SysID,
+			ID:       e.ID,
+		}
+		if exporter.IPAddr == nil || exporter.SysID == 0 {
+			return nil, fmt.Errorf("Bad exporter registry entry:%+v", e)
+		}
+		if exporter.SAFamily == afInet {
+			exporter.IPAddr = exporter.IPAddr.To4()
+		}
+		var identity = exporter.Identity()
+		if _, ok := reg.ids[identity]; ok {
+			return nil, fmt.Errorf("Duplicate exporter registry entry:%+v", e)
+		}
+		if _, ok := reg.exporters[exporter.SysID]; ok {
+			return nil, fmt.Errorf("Duplicate exporter registry ID:%d", exporter.SysID)
+		}
+		reg.ids[identity] = exporter.SysID
+		reg.exporters[exporter.SysID] = exporter
+	}
+	if len(reg.ids) > 0 && int(maxExporterID(reg.exporters)) != len(reg.ids) {
+		return nil, fmt.Errorf("Exporter registry IDs not contiguous, exporters:%d", len(reg.ids))
+	}
+	return reg, nil
+}
+
+// maxExporterID highest ID of exporters
+func maxExporterID(exporters map[uint16]NFExporterInfoRecord) (max uint16) {
+	for id := range exporters {
+		if id > max {
+			max = id
+		}
+	}
+	return max
+}
+
+// ExporterRewriter rewrites ExporterSysID of the records of one stream to the global IDs of an
+// ExporterRegistry. Not safe for concurrent use, create one per stream.
+type ExporterRewriter struct {
+	registry  *ExporterRegistry
+	exporters map[uint16]NFExporterInfoRecord
+	ids       map[uint16]rewriteID
+}
+
+// rewriteID global ID of a stream SysID and the exporter it was registered for
+type rewriteID struct {
+	id       uint16
+	exporter NFExporterInfoRecord
+}
+
+// Rewriter create ExporterRewriter for a stream, exporters is the Exporters map of the stream,
+// e.g. NFStream.Exporters, which is updated while the stream is read
+func (reg *ExporterRegistry) Rewriter(exporters map[uint16]NFExporterInfoRecord) *ExporterRewriter {
+	return &ExporterRewriter{
+		registry:  reg,
+		exporters: exporters,
+		ids:       make(map[uint16]rewriteID),
+	}
+}
+
+// Rewrite set ExporterSysID of record to the global ID of its exporter. Records of exporters unknown
+// to the stream get ExporterSysID 0, which is never a global ID, and ok false. Fails when the
+// registry is full.
+func (rw *ExporterRewriter) Rewrite(record *NFRecord) (ok bool, err error) {
+	var exporter, known = rw.exporters[record.ExporterSysID]
+	if !known {
+		record.ExporterSysID = 0
+		return false, nil
+	}
+
+	// A stream can reuse a SysID for another exporter, e.g. after nfcapd was restarted
+	var cached, found = rw.ids[record.ExporterSysID]
+	if !found || !cached.exporter.sameIdentity(exporter) {
+		var id uint16
+		if id, err = rw.registry.Register(exporter); err != nil {
+			record.ExporterSysID = 0
+			return false, err
+		}
+		cached = rewriteID{id: id, exporter: exporter}
+		rw.ids[record.ExporterSysID] = cached
+	}
+
+	record.ExporterSysID = cached.id
+	return true, nil
+}
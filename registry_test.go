@@ -0,0 +1,139 @@
+package nfdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestExporterRegistry(t *testing.T) {
+	var small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var empty []byte
+	if empty, err = ioutil.ReadFile("testdata/nfcapd-empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	var reg = NewExporterRegistry()
+
+	// Exporter 127.0.0.1 of the empty file uses SysID 1 like 66.110.1.81 of the small file
+	var id uint16
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(empty)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = nfs.Row(); err != io.EOF {
+		t.Fatal(err)
+	}
+	if id, err = reg.Register(nfs.Exporters[1]); err != nil || id != 1 {
+		t.Fatalf("Register id:%d error:%v", id, err)
+	}
+
+	var mu sync.Mutex
+	var ids = make(map[ExporterIdentity]uint16)
+	var wg sync.WaitGroup
+	for x := 0; x < 8; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var nfs, err = StreamReader(bytes.NewReader(small))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var rw = reg.Rewriter(nfs.Exporters)
+			for {
+				var record NFRecord
+				if record, err = nfs.Row(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				var identity = nfs.Exporter(&record).Identity()
+				if ok, err := rw.Rewrite(&record); !ok || err != nil {
+					t.Errorf("Rewrite ok:%t error:%v", ok, err)
+				}
+
+				mu.Lock()
+				if id, seen := ids[identity]; seen && id != record.ExporterSysID {
+					t.Errorf("Exporter %+v got IDs %d and %d", identity, id, record.ExporterSysID)
+				}
+				ids[identity] = record.ExporterSysID
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Records use 4 exporters, IDs follow the one registered first
+	var exporters = reg.Exporters()
+	if len(ids) != 4 || len(exporters) != 5 {
+		t.Fatalf("Unexpected ids:%+v exporters:%d", ids, len(exporters))
+	}
+	for identity, id := range ids {
+		if id < 2 || id > 5 || exporters[id].Identity() != identity || exporters[id].SysID != id {
+			t.Errorf("Unexpected ID %d of %+v:%+v", id, identity, exporters[id])
+		}
+	}
+	if exporter, ok := reg.Lookup(1); !ok || exporter.IPAddr.String() != "127.0.0.1" {
+		t.Errorf("Unexpected exporter 1:%+v", exporter)
+	}
+
+	var rw = reg.Rewriter(map[uint16]NFExporterInfoRecord{})
+	var record = NFRecord{ExporterSysID: 1}
+	if ok, err := rw.Rewrite(&record); ok || err != nil || record.ExporterSysID != 0 {
+		t.Errorf("Unexpected rewrite of unknown exporter ok:%t error:%v record:%d", ok, err, record.ExporterSysID)
+	}
+
+	var buf bytes.Buffer
+	if err = reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var loaded *ExporterRegistry
+	if loaded, err = ReadExporterRegistry(&buf); err != nil {
+		t.Fatalf("ReadExporterRegistry error:%v", err)
+	}
+	if !reflect.DeepEqual(loaded.Exporters(), exporters) {
+		t.Errorf("Unexpected loaded exporters:%+v expected %+v", loaded.Exporters(), exporters)
+	}
+	if id, err = loaded.Register(exporters[3]); err != nil || id != 3 {
+		t.Errorf("Loaded registry id:%d error:%v", id, err)
+	}
+}
+
+func TestExporterRewriterSysIDReused(t *testing.T) {
+	var reg = NewExporterRegistry()
+	var exporters = map[uint16]NFExporterInfoRecord{
+		1: {SysID: 1, IPAddr: net.ParseIP("10.0.0.1"), Version: 9},
+	}
+	var rw = reg.Rewriter(exporters)
+
+	var record = NFRecord{ExporterSysID: 1}
+	if ok, err := rw.Rewrite(&record); !ok || err != nil || record.ExporterSysID != 1 {
+		t.Fatalf("Rewrite ok:%t error:%v id:%d", ok, err, record.ExporterSysID)
+	}
+
+	// The stream reuses SysID 1 for another exporter
+	exporters[1] = NFExporterInfoRecord{SysID: 1, IPAddr: net.ParseIP("10.0.0.2"), Version: 9}
+	record = NFRecord{ExporterSysID: 1}
+	if ok, err := rw.Rewrite(&record); !ok || err != nil || record.ExporterSysID != 2 {
+		t.Errorf("Rewrite after reuse ok:%t error:%v id:%d", ok, err, record.ExporterSysID)
+	}
+	if exporter, ok := reg.Lookup(2); !ok || exporter.IPAddr.String() != "10.0.0.2" {
+		t.Errorf("Unexpected exporter 2:%+v", exporter)
+	}
+
+	// Same exporter written again with a 4 byte address keeps its ID
+	exporters[1] = NFExporterInfoRecord{SysID: 1, IPAddr: net.ParseIP("10.0.0.2").To4(), Version: 9}
+	record = NFRecord{ExporterSysID: 1}
+	if ok, err := rw.Rewrite(&record); !ok || err != nil || record.ExporterSysID != 2 || len(reg.Exporters()) != 2 {
+		t.Errorf("Rewrite of same exporter ok:%t error:%v id:%d", ok, err, record.ExporterSysID)
+	}
+}
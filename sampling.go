@@ -0,0 +1,109 @@
+package nfdump
+
+// StandardSamplerID ID of the exporter wide sampler, -1 in nfdump. It samples all flows of an
+// exporter that are not sampled by a flow sampler with its own ID.
+const StandardSamplerID = 0xffffffff
+
+// SamplerKey identifies a sampler, an exporter can define several samplers with different IDs
+type SamplerKey struct {
+	ExporterSysID uint16
+	// ID sampler ID assigned by the exporter, StandardSamplerID for the exporter wide sampler
+	ID uint32
+}
+
+// addSampler add sampler to samplers and update the sampler of its exporter in samplerInfo, the last
+// sampler of the exporter unless it has a standard sampler.
+//
+// Layout 1 flow records do not reference the sampler that sampled them, samplerInfo only describes
+// the exporter. Scaling uses samplingInterval, which refuses exporters with samplers of different
+// intervals.
+func addSampler(samplerInfo map[uint16]NFSamplerInfoRecord, samplers map[SamplerKey]NFSamplerInfoRecord, sampler NFSamplerInfoRecord) {
+	var sysID = sampler.ExporterSysID
+	samplers[SamplerKey{ExporterSysID: sysID, ID: sampler.ID}] = sampler
+
+	// The standard sampler keeps applying to flows without sampler reference
+	if current, ok := samplerInfo[sysID]; ok && current.ID == StandardSamplerID && sampler.ID != StandardSamplerID {
+		return
+	}
+	samplerInfo[sysID] = sampler
+}
+
+// samplingInterval interval the flows of exporter sysID are sampled with, 0 when it has no sampler.
+// Records do not reference their sampler, the interval is ambiguous when the samplers of the
+// exporter use different intervals.
+func samplingInterval(samplers map[SamplerKey]NFSamplerInfoRecord, sysID uint16) (interval uint32, ambiguous bool) {
+	for key, sampler := range samplers {
+		if key.ExporterSysID != sysID {
+			continue
+		}
+		var current = sampler.Interval
+		if current < 1 {
+			current = 1
+		}
+		if interval != 0 && interval != current {
+			return 0, true
+		}
+		interval = current
+	}
+	return interval, false
+}
+
+// ScaleSampling scale PacketCount, ByteCount, OutPkts and OutBytes of record to real units using the
+// sampler interval of the record exporter, samplers holds all samplers like Samplers.
+//
+// nfcapd already scales the counters of flows from exporters with a known sampling interval and
+// marks them as sampled, those counters are left as they are. All sampler modes (deterministic,
+// random and not announced) sample 1 of Interval packets. Records of exporters without sampler or
+// with an Interval of 0 or 1 are left unchanged.
+//
+// Records do not reference their sampler. When the samplers of the record exporter use different
+// intervals the right one is unknown, the record is left unchanged with a SamplingInterval of 0 and
+// ok is false.
+//
+// SamplingInterval of the record is set to the sampler interval, so the counters as sampled are
+// still available with RawCounts. ScaleSampling looks at every sampler, NFStream.SetSamplingScale
+// caches the interval of each exporter.
+func ScaleSampling(record *NFRecord, samplers map[SamplerKey]NFSamplerInfoRecord) (ok bool) {
+	var interval, ambiguous = samplingInterval(samplers, record.ExporterSysID)
+	if ambiguous {
+		record.SamplingInterval = 0
+		return false
+	}
+	scaleCounters(record, interval)
+	return true
+}
+
+// scaleCounters scale the counters of record by interval unless nfcapd scaled them already
+func scaleCounters(record *NFRecord, interval uint32) {
+	if interval <= 1 {
+		return
+	}
+
+	record.SamplingInterval = interval
+	if record.Sampled() {
+		return
+	}
+
+	var scale = uint64(interval)
+	record.PacketCount *= scale
+	record.ByteCount *= scale
+	record.OutPkts *= scale
+	record.OutBytes *= scale
+	record.Flags |= flowSampled
+}
+
+// Sampled true when the counters of the record are scaled by the sampling interval, either by
+// nfcapd or by ScaleSampling
+func (r NFRecord) Sampled() bool {
+	return (r.Flags & flowSampled) != 0
+}
+
+// RawCounts return the counters as counted by the sampler. The counters are returned unchanged
+// unless the record is sampled and its SamplingInterval is known.
+func (r NFRecord) RawCounts() (packets uint64, bytes uint64, outPackets uint64, outBytes uint64) {
+	if !r.Sampled() || r.SamplingInterval <= 1 {
+		return r.PacketCount, r.ByteCount, r.OutPkts, r.OutBytes
+	}
+	var interval = uint64(r.SamplingInterval)
+	return r.PacketCount / interval, r.ByteCount / interval, r.OutPkts / interval, r.OutBytes / interval
+}
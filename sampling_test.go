@@ -0,0 +1,154 @@
+package nfdump
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestScaleSampling(t *testing.T) {
+	var samplers = map[SamplerKey]NFSamplerInfoRecord{
+		{ExporterSysID: 1, ID: StandardSamplerID}: {ID: StandardSamplerID, Interval: 1000, Mode: 1, ExporterSysID: 1},
+		{ExporterSysID: 2, ID: StandardSamplerID}: {ID: StandardSamplerID, Interval: 100, Mode: 2, ExporterSysID: 2},
+		{ExporterSysID: 3, ID: StandardSamplerID}: {ID: StandardSamplerID, Interval: 10, Mode: 0, ExporterSysID: 3},
+		{ExporterSysID: 4, ID: StandardSamplerID}: {ID: StandardSamplerID, Interval: 1, Mode: 0, ExporterSysID: 4},
+		{ExporterSysID: 6, ID: 1}:                 {ID: 1, Interval: 100, ExporterSysID: 6},
+		{ExporterSysID: 6, ID: 2}:                 {ID: 2, Interval: 100, ExporterSysID: 6},
+		{ExporterSysID: 7, ID: 1}:                 {ID: 1, Interval: 100, ExporterSysID: 7},
+		{ExporterSysID: 7, ID: 2}:                 {ID: 2, Interval: 10, ExporterSysID: 7},
+		{ExporterSysID: 8, ID: StandardSamplerID}: {ID: StandardSamplerID, Interval: 1000, ExporterSysID: 8},
+		{ExporterSysID: 8, ID: 1}:                 {ID: 1, Interval: 10, ExporterSysID: 8},
+	}
+
+	var tests = []struct {
+		name     string
+		sysID    uint16
+		flags    uint16
+		packets  uint64
+		interval uint32
+		raw      uint64
+		ok       bool
+	}{
+		{name: "deterministic", sysID: 1, packets: 2000, interval: 1000, raw: 2, ok: true},
+		{name: "random", sysID: 2, packets: 200, interval: 100, raw: 2, ok: true},
+		{name: "mode not announced", sysID: 3, packets: 20, interval: 10, raw: 2, ok: true},
+		{name: "scaled by nfcapd", sysID: 1, flags: flowSampled, packets: 2, interval: 1000, raw: 0, ok: true},
+		{name: "unsampled", sysID: 4, packets: 2, interval: 0, raw: 2, ok: true},
+		{name: "no sampler", sysID: 5, packets: 2, interval: 0, raw: 2, ok: true},
+		{name: "flow samplers same interval", sysID: 6, packets: 200, interval: 100, raw: 2, ok: true},
+		{name: "flow samplers different intervals", sysID: 7, packets: 2, interval: 0, raw: 2, ok: false},
+		{name: "standard and flow sampler different intervals", sysID: 8, packets: 2, interval: 0, raw: 2, ok: false},
+	}
+
+	for _, tc := range tests {
+		var record = NFRecord{ExporterSysID: tc.sysID, Flags: tc.flags, PacketCount: 2, ByteCount: 3, OutPkts: 4, OutBytes: 5}
+		if ok := ScaleSampling(&record, samplers); ok != tc.ok {
+			t.Errorf("%s: unexpected ok:%t", tc.name, ok)
+		}
+
+		var factor = tc.packets / 2
+		if record.PacketCount != tc.packets || record.ByteCount != 3*factor || record.OutPkts != 4*factor || record.OutBytes != 5*factor {
+			t.Errorf("%s: unexpected counters:%+v", tc.name, record)
+		}
+		if record.SamplingInterval != tc.interval || record.Sampled() != (tc.interval > 1) {
+			t.Errorf("%s: unexpected interval:%d sampled:%t", tc.name, record.SamplingInterval, record.Sampled())
+		}
+		if packets, _, _, _ := record.RawCounts(); packets != tc.raw {
+			t.Errorf("%s: unexpected raw packets:%d expected %d", tc.name, packets, tc.raw)
+		}
+	}
+}
+
+func TestStreamSamplingScale(t *testing.T) {
+	var f, err = os.Open("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(f); err != nil {
+		t.Fatal(err)
+	}
+	nfs.SetSamplingScale(true)
+
+	// nfcapd scaled all flows of the test file by the 1:3000 samplers
+	var records int
+	for {
+		var record NFRecord
+		if record, err = nfs.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records++
+
+		var packets, bytes, _, _ = record.RawCounts()
+		if record.SamplingInterval != 3000 || packets*3000 != record.PacketCount || bytes*3000 != record.ByteCount {
+			t.Errorf("Unexpected sampling:%d packets:%d/%d bytes:%d/%d", record.SamplingInterval, packets, record.PacketCount, bytes, record.ByteCount)
+		}
+	}
+	if records != 10 {
+		t.Errorf("Unexpected records:%d", records)
+	}
+}
+
+func TestAddSampler(t *testing.T) {
+	var standard = NFSamplerInfoRecord{ID: StandardSamplerID, Interval: 1000, ExporterSysID: 1}
+	var first = NFSamplerInfoRecord{ID: 1, Interval: 100, ExporterSysID: 1}
+	var second = NFSamplerInfoRecord{ID: 2, Interval: 10, ExporterSysID: 1}
+	var updated = NFSamplerInfoRecord{ID: 1, Interval: 200, ExporterSysID: 1}
+
+	var tests = []struct {
+		name     string
+		samplers []NFSamplerInfoRecord
+		interval uint32
+	}{
+		{name: "standard", samplers: []NFSamplerInfoRecord{standard}, interval: 1000},
+		{name: "single flow sampler", samplers: []NFSamplerInfoRecord{first}, interval: 100},
+		{name: "updated flow sampler", samplers: []NFSamplerInfoRecord{first, updated}, interval: 200},
+		{name: "standard first", samplers: []NFSamplerInfoRecord{standard, first, second}, interval: 1000},
+		{name: "standard last", samplers: []NFSamplerInfoRecord{first, second, standard}, interval: 1000},
+		{name: "several flow samplers", samplers: []NFSamplerInfoRecord{first, second}, interval: 10},
+		{name: "several flow samplers updated", samplers: []NFSamplerInfoRecord{first, second, updated}, interval: 200},
+	}
+
+	for _, tc := range tests {
+		var samplerInfo = make(map[uint16]NFSamplerInfoRecord)
+		var samplers = make(map[SamplerKey]NFSamplerInfoRecord)
+		for _, sampler := range tc.samplers {
+			addSampler(samplerInfo, samplers, sampler)
+		}
+
+		if samplerInfo[1].Interval != tc.interval {
+			t.Errorf("%s: unexpected sampler:%+v", tc.name, samplerInfo[1])
+		}
+		for _, sampler := range tc.samplers {
+			if _, ok := samplers[SamplerKey{ExporterSysID: 1, ID: sampler.ID}]; !ok {
+				t.Errorf("%s: missing sampler:%+v", tc.name, sampler)
+			}
+		}
+	}
+}
+
+func TestStreamSamplingScaleAmbiguous(t *testing.T) {
+	var nfs = &NFStream{
+		SamplerInfo: make(map[uint16]NFSamplerInfoRecord),
+		Samplers:    make(map[SamplerKey]NFSamplerInfoRecord),
+	}
+	nfs.addSampler(NFSamplerInfoRecord{ID: 1, Interval: 100, ExporterSysID: 1})
+
+	var record = NFRecord{ExporterSysID: 1, PacketCount: 2}
+	nfs.scaleRecord(&record)
+	if record.SamplingInterval != 100 || record.PacketCount != 200 {
+		t.Errorf("Unexpected record with one sampler:%+v", record)
+	}
+
+	// A second sampler with another interval makes the sampler of the records unknown
+	nfs.addSampler(NFSamplerInfoRecord{ID: 2, Interval: 10, ExporterSysID: 1})
+	record = NFRecord{ExporterSysID: 1, PacketCount: 2}
+	nfs.scaleRecord(&record)
+	if record.SamplingInterval != 0 || record.PacketCount != 2 || record.Sampled() {
+		t.Errorf("Unexpected record with ambiguous samplers:%+v", record)
+	}
+}
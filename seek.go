@@ -0,0 +1,169 @@
+package nfdump
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// NFSeekStream NFStream over an io.ReaderAt that can seek to a block or a time using a BlockIndex.
+//
+// Extension maps, exporters, samplers and exporter stats of all blocks before the seek position are
+// loaded on seek, so records can be decoded from any block. After a seek ExporterStats holds the stat
+// records before the new position, records read again are not counted twice.
+type NFSeekStream struct {
+	*NFStream
+	Index *BlockIndex
+
+	ra io.ReaderAt
+}
+
+// SeekReader create NFSeekStream reading from ra, a nil index is built from ra which decompresses
+// every block once
+func SeekReader(ra io.ReaderAt, index *BlockIndex) (nfss *NFSeekStream, err error) {
+	if index == nil {
+		if index, err = BuildBlockIndex(io.NewSectionReader(ra, 0, math.MaxInt64)); err != nil {
+			return nil, err
+		}
+	}
+
+	nfss = &NFSeekStream{
+		Index: index,
+		ra:    ra,
+	}
+	if nfss.NFStream, err = StreamReader(io.NewSectionReader(ra, 0, math.MaxInt64)); err != nil {
+		return nil, err
+	}
+	return nfss, nil
+}
+
+// Block index of the next block read by Row, len(Index.Blocks) at end of file
+func (nfss *NFSeekStream) Block() int {
+	if nfss.readNewBlock {
+		return nfss.blocks.index
+	}
+	// Inside of a block, the next block is the current one
+	return nfss.blocks.index - 1
+}
+
+// SeekBlock continue reading at the first record of block n, 0 <= n <= len(Index.Blocks)
+func (nfss *NFSeekStream) SeekBlock(n int) (err error) {
+	if n < 0 || n > len(nfss.Index.Blocks) {
+		return fmt.Errorf("Seek block out of range:%d blocks:%d", n, len(nfss.Index.Blocks))
+	}
+
+	// Blocks before blocks.index have been read or loaded, a partially read block included
+	var loaded = nfss.blocks.index
+	if n < loaded {
+		// Extension map IDs can be redefined and stats of blocks read again must not be counted twice,
+		// start over to get the meta data valid at block n
+		nfss.extMap = make(map[uint16][]uint16)
+		nfss.Exporters = make(map[uint16]NFExporterInfoRecord)
+		nfss.ExporterStats = make(map[uint32]NFExporterStatRecord)
+		nfss.SamplerInfo = make(map[uint16]NFSamplerInfoRecord)
+		nfss.Samplers = make(map[SamplerKey]NFSamplerInfoRecord)
+		nfss.samplingIntervals = nil
+		loaded = 0
+	} else if !nfss.readNewBlock {
+		// Only the records after the position of the partially read block are left
+		if err = nfss.loadRecords(&nfss.records); err != nil {
+			return err
+		}
+	}
+	for x := loaded; x < n; x++ {
+		if err = nfss.loadMeta(x); err != nil {
+			return err
+		}
+	}
+
+	var offset = nfss.Index.FileSize
+	if n < len(nfss.Index.Blocks) {
+		offset = nfss.Index.Blocks[n].Offset
+	}
+	nfss.blocks.r = io.NewSectionReader(nfss.ra, offset, math.MaxInt64-offset)
+	nfss.blocks.index = n
+	nfss.readNewBlock = true
+	return nil
+}
+
+// SeekTime continue reading at the first block with a flow ending at or after t. Without such a
+// block the stream is positioned at end of file.
+func (nfss *NFSeekStream) SeekTime(t time.Time) error {
+	var ms = t.UnixNano() / int64(time.Millisecond)
+	for n, entry := range nfss.Index.Blocks {
+		if entry.Flows > 0 && entry.LastMS >= ms {
+			return nfss.SeekBlock(n)
+		}
+	}
+	return nfss.SeekBlock(len(nfss.Index.Blocks))
+}
+
+// loadMeta decode extension map, exporter, sampler and exporter stat records of block n
+func (nfss *NFSeekStream) loadMeta(n int) (err error) {
+	var entry = nfss.Index.Blocks[n]
+	if !entry.Meta || entry.ID != dataBlockID {
+		return nil
+	}
+
+	var blocks = blockReader{
+		r:     io.NewSectionReader(nfss.ra, entry.Offset, blockHeaderSize+int64(entry.Size)),
+		flags: nfss.Header.Flags,
+		index: n,
+	}
+	if err = blocks.next(); err == io.EOF {
+		return ErrFailedReadBlockHeader
+	} else if err != nil {
+		return err
+	}
+
+	var data []byte
+	if data, err = blocks.data(); err != nil {
+		return err
+	}
+
+	var records = newRecordIter(data)
+	return nfss.loadRecords(&records)
+}
+
+// loadRecords decode the extension map, exporter, sampler and exporter stat records of the remaining
+// records of records
+func (nfss *NFSeekStream) loadRecords(records *recordIter) (err error) {
+	for {
+		var ok bool
+		if ok, err = records.next(); err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+
+		switch records.recordType {
+		case ExtensionMapRecordHeadType:
+			var mapID uint16
+			var exts []uint16
+			if mapID, exts, err = decodeExtensionMap(records.record()); err != nil {
+				return err
+			}
+			nfss.extMap[mapID] = exts
+		case ExporterInfoRecordHeadType:
+			var exporter NFExporterInfoRecord
+			if exporter, err = decodeExporterInfo(records.record()); err != nil {
+				return err
+			}
+			nfss.Exporters[exporter.SysID] = exporter
+			nfss.exporterRecords++
+		case SamplerInfoRecordHeadType:
+			var sampler NFSamplerInfoRecord
+			if sampler, err = decodeSamplerInfo(records.record()); err != nil {
+				return err
+			}
+			nfss.addSampler(sampler)
+		case ExporterStatRecordHeadType:
+			for _, stat := range decodeExporterStats(records.record()) {
+				addExporterStat(nfss.ExporterStats, stat)
+			}
+		}
+	}
+
+	return nil
+}
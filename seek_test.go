@@ -0,0 +1,147 @@
+package nfdump
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestSeekReader(t *testing.T) {
+	var data = splitTestFile(t)
+
+	var all, err = ParseReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nfss *NFSeekStream
+	if nfss, err = SeekReader(bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("SeekReader error:%v", err)
+	}
+	if len(nfss.Index.Blocks) != 11 || nfss.Block() != 0 {
+		t.Fatalf("Unexpected blocks:%d position:%d", len(nfss.Index.Blocks), nfss.Block())
+	}
+
+	// Block 0 holds the extension maps and exporters, block n > 0 the flow all.Records[n-1]
+	var tests = []struct {
+		name   string
+		seek   func() error
+		record int
+	}{
+		{name: "block 5", seek: func() error { return nfss.SeekBlock(5) }, record: 4},
+		{name: "block 2", seek: func() error { return nfss.SeekBlock(2) }, record: 1},
+		{name: "block 0", seek: func() error { return nfss.SeekBlock(0) }, record: 0},
+		{name: "time", seek: func() error { return nfss.SeekTime(time.Unix(1565635903, 0)) }, record: 2},
+		{name: "time end", seek: func() error { return nfss.SeekTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) }, record: -1},
+		{name: "block end", seek: func() error { return nfss.SeekBlock(11) }, record: -1},
+		{name: "block 10", seek: func() error { return nfss.SeekBlock(10) }, record: 9},
+	}
+
+	for _, tc := range tests {
+		if err = tc.seek(); err != nil {
+			t.Fatalf("%s: seek error:%v", tc.name, err)
+		}
+		// Seeking to block 0 starts over, its exporters are read by Row
+		var record NFRecord
+		record, err = nfss.Row()
+		if len(nfss.Exporters) != 2407 {
+			t.Errorf("%s: exporters not loaded:%d", tc.name, len(nfss.Exporters))
+		}
+		if tc.record < 0 {
+			if err != io.EOF {
+				t.Errorf("%s: expected io.EOF got:%v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: Row error:%v", tc.name, err)
+		}
+		if !sameRecords([]NFRecord{record}, all.Records[tc.record:tc.record+1]) {
+			t.Errorf("%s: unexpected record:%+v", tc.name, record)
+		}
+		if nfss.Block() != tc.record+2 {
+			t.Errorf("%s: unexpected position:%d", tc.name, nfss.Block())
+		}
+	}
+
+	if err = nfss.SeekBlock(12); err == nil {
+		t.Errorf("Expected error for block out of range")
+	}
+}
+
+func TestSeekReaderCompressed(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nfss *NFSeekStream
+	if nfss, err = SeekReader(bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("SeekReader error:%v", err)
+	}
+
+	for pass := 0; pass < 2; pass++ {
+		if err = nfss.SeekBlock(0); err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		for {
+			if _, err = nfss.Row(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Row error:%v", err)
+			}
+			count++
+		}
+		if count != 10 {
+			t.Errorf("Unexpected record count pass %d:%d", pass, count)
+		}
+	}
+}
+
+func TestSeekReaderStats(t *testing.T) {
+	var data = statTestFile(t, 2)
+	var expected = NFExporterStatRecord{SysID: 1224, SequenceFailures: 6, Packets: 300, Flows: 30}
+
+	// Stat records follow flow 5 and flow 10 of the only block
+	var tests = []struct {
+		name  string
+		read  int
+		seek  int
+		flows int
+	}{
+		{name: "reread", read: 10, seek: 0, flows: 10},
+		{name: "reread partial block", read: 7, seek: 0, flows: 10},
+		{name: "skip partial block", read: 3, seek: 1, flows: 0},
+		{name: "skip partial block after stat", read: 7, seek: 1, flows: 0},
+	}
+
+	for _, tc := range tests {
+		var nfss, err = SeekReader(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < tc.read; x++ {
+			if _, err = nfss.Row(); err != nil {
+				t.Fatalf("%s: Row error:%v", tc.name, err)
+			}
+		}
+
+		if err = nfss.SeekBlock(tc.seek); err != nil {
+			t.Fatalf("%s: seek error:%v", tc.name, err)
+		}
+		var flows int
+		for ; ; flows++ {
+			if _, err = nfss.Row(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: Row error:%v", tc.name, err)
+			}
+		}
+		if flows != tc.flows || nfss.ExporterStats[1224] != expected {
+			t.Errorf("%s: unexpected flows:%d stats:%+v", tc.name, flows, nfss.ExporterStats[1224])
+		}
+	}
+}
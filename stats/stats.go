@@ -0,0 +1,340 @@
+/*
+Package stats builds nfdump -s style Top-N statistics from nfdump records.
+
+A Stat is created from a spec of the form element[/order], for example "dstip/bytes" or
+"port/flows". Supported elements are srcip, dstip, ip, srcport, dstport, port, proto, srcas,
+dstas, as, inif, outif, if, nexthop, router, tos, srcvlan, dstvlan and vlan. Supported orders are
+flows (default), packets, bytes, pps, bps and bpp. Elements without src/dst prefix count every
+record once for the source and once for the destination value, like nfdump does.
+*/
+package stats
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chrispassas/nfdump"
+)
+
+// statKey hash key of a single element value, ip is used for address elements and value for everything else
+type statKey struct {
+	ip    [16]byte
+	value uint64
+}
+
+// element how to get keys from a record and how to print a key
+type element struct {
+	keys   func(r *nfdump.NFRecord, keys []statKey) []statKey
+	format func(k statKey) string
+}
+
+// Entry aggregated counters of a single element value
+type Entry struct {
+	Key     string
+	Flows   uint64
+	Packets uint64
+	Bytes   uint64
+
+	// FirstMS LastMS time range of all flows in milliseconds since epoch
+	FirstMS int64
+	LastMS  int64
+
+	// Percentages of the table totals
+	FlowsPercent   float64
+	PacketsPercent float64
+	BytesPercent   float64
+}
+
+// DurationMilliseconds return time between first and last flow of entry
+func (e Entry) DurationMilliseconds() int64 {
+	return e.LastMS - e.FirstMS
+}
+
+// PPS packets per second over the entry duration, 0 when duration is 0
+func (e Entry) PPS() uint64 {
+	if d := e.DurationMilliseconds(); d > 0 {
+		return e.Packets * 1000 / uint64(d)
+	}
+	return 0
+}
+
+// BPS bits per second over the entry duration, 0 when duration is 0
+func (e Entry) BPS() uint64 {
+	if d := e.DurationMilliseconds(); d > 0 {
+		return e.Bytes * 8000 / uint64(d)
+	}
+	return 0
+}
+
+// BPP bytes per packet
+func (e Entry) BPP() uint64 {
+	if e.Packets > 0 {
+		return e.Bytes / e.Packets
+	}
+	return 0
+}
+
+// Table Top-N result of a Stat
+type Table struct {
+	Element string
+	Order   string
+
+	// Totals used to calculate entry percentages
+	Totals nfdump.NFStatRecord
+
+	// Distinct number of distinct element values seen
+	Distinct int
+	Entries  []Entry
+}
+
+// Stat collects counters per element value
+type Stat struct {
+	element     string
+	order       string
+	el          element
+	entries     map[statKey]*Entry
+	keys        []statKey
+	totals      nfdump.NFStatRecord
+	totalsSet   bool
+	totalsAdded nfdump.NFStatRecord
+}
+
+// New create Stat from an nfdump -s style spec, e.g. "dstip/bytes"
+func New(spec string) (s *Stat, err error) {
+	var parts = strings.SplitN(strings.ToLower(strings.TrimSpace(spec)), "/", 2)
+
+	s = &Stat{
+		element: parts[0],
+		order:   "flows",
+		entries: make(map[statKey]*Entry),
+	}
+	if len(parts) == 2 {
+		s.order = parts[1]
+	}
+
+	switch s.order {
+	case "flows", "packets", "bytes", "pps", "bps", "bpp":
+	default:
+		return nil, fmt.Errorf("Unsupported statistic order:%s", s.order)
+	}
+
+	var ok bool
+	if s.el, ok = elements[s.element]; !ok {
+		return nil, fmt.Errorf("Unsupported statistic element:%s", s.element)
+	}
+
+	return s, nil
+}
+
+// Add record to statistic
+func (s *Stat) Add(record *nfdump.NFRecord) {
+	var flows = record.AggeFlows
+	if flows == 0 {
+		flows = 1
+	}
+
+	s.totalsAdded.NumFlows += flows
+	s.totalsAdded.NumPackets += record.PacketCount
+	s.totalsAdded.NumBytes += record.ByteCount
+
+	s.keys = s.el.keys(record, s.keys[:0])
+	for _, key := range s.keys {
+		var entry, ok = s.entries[key]
+		if !ok {
+			entry = &Entry{
+				Key:     s.el.format(key),
+				FirstMS: record.StartTimeMS(),
+				LastMS:  record.EndTimeMS(),
+			}
+			s.entries[key] = entry
+		}
+
+		entry.Flows += flows
+		entry.Packets += record.PacketCount
+		entry.Bytes += record.ByteCount
+		if first := record.StartTimeMS(); first < entry.FirstMS {
+			entry.FirstMS = first
+		}
+		if last := record.EndTimeMS(); last > entry.LastMS {
+			entry.LastMS = last
+		}
+	}
+}
+
+// AddStream add every remaining record of nfs and use the file NFStatRecord as totals
+func (s *Stat) AddStream(nfs *nfdump.NFStream) (err error) {
+	var record nfdump.NFRecord
+	for {
+		if record, err = nfs.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		s.Add(&record)
+	}
+
+	s.SetTotals(nfs.StatRecord)
+	return nil
+}
+
+// SetTotals set totals used for percentages, by default the sum of all added records is used
+func (s *Stat) SetTotals(totals nfdump.NFStatRecord) {
+	s.totals = totals
+	s.totalsSet = true
+}
+
+// Top return the n entries with the highest value for the statistic order, n <= 0 returns all entries
+func (s *Stat) Top(n int) *Table {
+	var table = &Table{
+		Element:  s.element,
+		Order:    s.order,
+		Totals:   s.totalsAdded,
+		Distinct: len(s.entries),
+		Entries:  make([]Entry, 0, len(s.entries)),
+	}
+	if s.totalsSet {
+		table.Totals = s.totals
+	}
+
+	var value = orderValue(s.order)
+	for _, entry := range s.entries {
+		table.Entries = append(table.Entries, *entry)
+	}
+	sort.Slice(table.Entries, func(i, j int) bool {
+		var a, b = value(table.Entries[i]), value(table.Entries[j])
+		if a != b {
+			return a > b
+		}
+		return table.Entries[i].Key < table.Entries[j].Key
+	})
+
+	if n > 0 && len(table.Entries) > n {
+		table.Entries = table.Entries[:n]
+	}
+
+	for x := range table.Entries {
+		table.Entries[x].FlowsPercent = percent(table.Entries[x].Flows, table.Totals.NumFlows)
+		table.Entries[x].PacketsPercent = percent(table.Entries[x].Packets, table.Totals.NumPackets)
+		table.Entries[x].BytesPercent = percent(table.Entries[x].Bytes, table.Totals.NumBytes)
+	}
+
+	return table
+}
+
+// Reset remove all collected entries and totals
+func (s *Stat) Reset() {
+	s.entries = make(map[statKey]*Entry)
+	s.totals = nfdump.NFStatRecord{}
+	s.totalsSet = false
+	s.totalsAdded = nfdump.NFStatRecord{}
+}
+
+func percent(value uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) * 100 / float64(total)
+}
+
+// orderValue return function used to sort entries
+func orderValue(order string) func(e Entry) uint64 {
+	switch order {
+	case "packets":
+		return func(e Entry) uint64 { return e.Packets }
+	case "bytes":
+		return func(e Entry) uint64 { return e.Bytes }
+	case "pps":
+		return Entry.PPS
+	case "bps":
+		return Entry.BPS
+	case "bpp":
+		return Entry.BPP
+	}
+	return func(e Entry) uint64 { return e.Flows }
+}
+
+func ipKey(ip net.IP) (k statKey) {
+	copy(k.ip[:], ip.To16())
+	return k
+}
+
+func formatIP(k statKey) string {
+	return net.IP(k.ip[:]).String()
+}
+
+func formatNumber(k statKey) string {
+	return strconv.FormatUint(k.value, 10)
+}
+
+// ipElement element using a single address field
+func ipElement(get func(r *nfdump.NFRecord) net.IP) element {
+	return element{
+		keys: func(r *nfdump.NFRecord, keys []statKey) []statKey {
+			return append(keys, ipKey(get(r)))
+		},
+		format: formatIP,
+	}
+}
+
+// numberElement element using one or two (src and dst) numeric fields
+func numberElement(get ...func(r *nfdump.NFRecord) uint64) element {
+	return element{
+		keys: func(r *nfdump.NFRecord, keys []statKey) []statKey {
+			for _, g := range get {
+				keys = append(keys, statKey{value: g(r)})
+			}
+			return keys
+		},
+		format: formatNumber,
+	}
+}
+
+var (
+	srcIP   = func(r *nfdump.NFRecord) net.IP { return r.SrcIP }
+	dstIP   = func(r *nfdump.NFRecord) net.IP { return r.DstIP }
+	srcPort = func(r *nfdump.NFRecord) uint64 { return uint64(r.SrcPort) }
+	dstPort = func(r *nfdump.NFRecord) uint64 { return uint64(r.DstPort) }
+	srcAS   = func(r *nfdump.NFRecord) uint64 { return uint64(r.SrcAS) }
+	dstAS   = func(r *nfdump.NFRecord) uint64 { return uint64(r.DstAS) }
+	inIf    = func(r *nfdump.NFRecord) uint64 { return uint64(r.Input) }
+	outIf   = func(r *nfdump.NFRecord) uint64 { return uint64(r.Output) }
+	srcVlan = func(r *nfdump.NFRecord) uint64 { return uint64(r.SrcVlan) }
+	dstVlan = func(r *nfdump.NFRecord) uint64 { return uint64(r.DstVLan) }
+)
+
+// elements all supported statistic elements
+var elements = map[string]element{
+	"srcip": ipElement(srcIP),
+	"dstip": ipElement(dstIP),
+	"ip": {
+		keys: func(r *nfdump.NFRecord, keys []statKey) []statKey {
+			return append(keys, ipKey(r.SrcIP), ipKey(r.DstIP))
+		},
+		format: formatIP,
+	},
+	"nexthop": ipElement(func(r *nfdump.NFRecord) net.IP { return r.NextHopIP }),
+	"router":  ipElement(func(r *nfdump.NFRecord) net.IP { return r.RouterIP }),
+	"srcport": numberElement(srcPort),
+	"dstport": numberElement(dstPort),
+	"port":    numberElement(srcPort, dstPort),
+	"proto": {
+		keys: func(r *nfdump.NFRecord, keys []statKey) []statKey {
+			return append(keys, statKey{value: uint64(r.Proto)})
+		},
+		format: func(k statKey) string { return nfdump.ProtocolName(uint8(k.value)) },
+	},
+	"srcas":   numberElement(srcAS),
+	"dstas":   numberElement(dstAS),
+	"as":      numberElement(srcAS, dstAS),
+	"inif":    numberElement(inIf),
+	"outif":   numberElement(outIf),
+	"if":      numberElement(inIf, outIf),
+	"tos":     numberElement(func(r *nfdump.NFRecord) uint64 { return uint64(r.Tos) }),
+	"srcvlan": numberElement(srcVlan),
+	"dstvlan": numberElement(dstVlan),
+	"vlan":    numberElement(srcVlan, dstVlan),
+}
@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/chrispassas/nfdump"
+)
+
+var testFile = "../testdata/nfcapd-small-lzo"
+
+func TestStatTop(t *testing.T) {
+	var tests = []struct {
+		spec     string
+		n        int
+		distinct int
+		firstKey string
+		first    uint64
+	}{
+		{spec: "dstport", n: 3, distinct: 7, firstKey: "443", first: 4},
+		{spec: "dstport/bytes", n: 1, distinct: 7, firstKey: "443", first: 76020000},
+		{spec: "proto/packets", n: 0, distinct: 2, firstKey: "UDP", first: 93000},
+		{spec: "srcas/bytes", n: 5, distinct: 8, firstKey: "33363", first: 76941000},
+		{spec: "ip/flows", n: 10, distinct: 20, firstKey: "103.55.90.246", first: 1},
+		{spec: "dstip/bytes", n: 1, distinct: 10, firstKey: "209.197.26.66", first: 74868000},
+		{spec: "router", n: 1, distinct: 4, firstKey: "66.110.1.17", first: 5},
+		{spec: "if/flows", n: 1, distinct: 12, firstKey: "1170", first: 5},
+		{spec: "port/bpp", n: 1, distinct: 14, firstKey: "41322", first: 1500},
+	}
+
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile(testFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.spec, func(t *testing.T) {
+			var s *Stat
+			var nfs *nfdump.NFStream
+			var err error
+			if s, err = New(tc.spec); err != nil {
+				t.Fatal(err)
+			}
+			if nfs, err = nfdump.StreamReader(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.AddStream(nfs); err != nil {
+				t.Fatal(err)
+			}
+
+			var table = s.Top(tc.n)
+			if table.Distinct != tc.distinct {
+				t.Errorf("Unexpected distinct count:%d expected %d", table.Distinct, tc.distinct)
+			}
+			if tc.n > 0 && len(table.Entries) > tc.n {
+				t.Errorf("Unexpected entry count:%d expected %d", len(table.Entries), tc.n)
+			}
+
+			var entry = table.Entries[0]
+			var value = orderValue(table.Order)(entry)
+			if entry.Key != tc.firstKey || value != tc.first {
+				t.Errorf("Unexpected first entry key:%s value:%d expected key:%s value:%d", entry.Key, value, tc.firstKey, tc.first)
+			}
+
+			for x := 1; x < len(table.Entries); x++ {
+				if orderValue(table.Order)(table.Entries[x]) > orderValue(table.Order)(table.Entries[x-1]) {
+					t.Errorf("Entries not ordered by %s", table.Order)
+				}
+			}
+		})
+	}
+}
+
+func TestStatPercent(t *testing.T) {
+	var s *Stat
+	var err error
+	if s, err = New("proto/bytes"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Add(&nfdump.NFRecord{Proto: 6, PacketCount: 1, ByteCount: 250})
+	s.Add(&nfdump.NFRecord{Proto: 17, PacketCount: 3, ByteCount: 750})
+
+	var table = s.Top(0)
+	if table.Entries[0].Key != "UDP" || table.Entries[0].BytesPercent != 75 || table.Entries[0].FlowsPercent != 50 {
+		t.Errorf("Unexpected entry:%+v", table.Entries[0])
+	}
+
+	s.SetTotals(nfdump.NFStatRecord{NumFlows: 4, NumPackets: 8, NumBytes: 2000})
+	table = s.Top(1)
+	if table.Entries[0].BytesPercent != 37.5 || table.Entries[0].FlowsPercent != 25 || table.Entries[0].PacketsPercent != 37.5 {
+		t.Errorf("Unexpected entry:%+v", table.Entries[0])
+	}
+}
+
+func TestStatSpecError(t *testing.T) {
+	for _, spec := range []string{"foo", "dstip/foo", ""} {
+		if _, err := New(spec); err == nil {
+			t.Errorf("New(%q) expected error", spec)
+		}
+	}
+}
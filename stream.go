@@ -1,12 +1,13 @@
 package nfdump
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
-
-	"github.com/rasky/go-lzo"
+	"net"
+	"os"
+	"time"
 )
 
 // NFStream keeps track of non record fields while stream processing file
@@ -14,34 +15,60 @@ type NFStream struct {
 	Header     NFHeader
 	StatRecord NFStatRecord
 
-	r                 io.Reader
-	blockHeader       NFBlockHeader
-	blockIndex        int
+	blocks            blockReader
 	blockRecordCount  int
-	blockData         []byte
 	decompressedBlock []byte
 	readNewBlock      bool
-	recordHeader      NFRecordHeader
-	start             int
-	extMap            map[uint16][]uint16
-	Exporters         map[uint16]NFExporterInfoRecord
-	ExporterStats     map[uint32]NFExporterStatRecord
-	SamplerInfo       map[uint16]NFSamplerInfoRecord
+	records           recordIter
+	// ipArena IPs of the records of the current block, records returned by Row keep referencing it
+	// so a new arena is allocated instead of reusing the memory
+	ipArena       []byte
+	extMap        map[uint16][]uint16
+	Exporters     map[uint16]NFExporterInfoRecord
+	ExporterStats map[uint32]NFExporterStatRecord
+	SamplerInfo   map[uint16]NFSamplerInfoRecord
+	Samplers      map[SamplerKey]NFSamplerInfoRecord
+	filter        RecordFilter
+	timeRange     *timePruner
+	scaleSampling bool
+	fields        Field
+	// ctx context of RowContext, checked before every block
+	ctx context.Context
+	// samplingIntervals interval to scale the flows of each exporter with, 0 when ambiguous
+	samplingIntervals map[uint16]uint32
+	// exporterRecords number of exporter records read, an exporter record can reuse the SysID of
+	// another exporter without changing the size of Exporters
+	exporterRecords int
+}
+
+// RecordFilter decides if a record should be returned by NFStream.Row
+type RecordFilter interface {
+	Match(record *NFRecord) bool
+}
+
+// RecordFilterFunc allows an ordinary function to be used as a RecordFilter
+type RecordFilterFunc func(record *NFRecord) bool
+
+// Match calls f(record)
+func (f RecordFilterFunc) Match(record *NFRecord) bool {
+	return f(record)
 }
 
 // StreamReader read nfdump file record by record with minimal memory usage
 func StreamReader(r io.Reader) (nfs *NFStream, err error) {
 
 	nfs = &NFStream{
-		r:             r,
+		blocks:        blockReader{r: r},
 		readNewBlock:  true,
+		fields:        AllFields,
 		extMap:        make(map[uint16][]uint16),
 		Exporters:     make(map[uint16]NFExporterInfoRecord),
 		ExporterStats: make(map[uint32]NFExporterStatRecord),
 		SamplerInfo:   make(map[uint16]NFSamplerInfoRecord),
+		Samplers:      make(map[SamplerKey]NFSamplerInfoRecord),
 	}
 
-	if err = binary.Read(nfs.r, binary.LittleEndian, &nfs.Header); err != nil {
+	if err = binary.Read(r, binary.LittleEndian, &nfs.Header); err != nil {
 		err = ErrFailedReadFileHeader
 		return nfs, err
 	}
@@ -56,14 +83,50 @@ func StreamReader(r io.Reader) (nfs *NFStream, err error) {
 		return nfs, err
 	}
 
-	if err = binary.Read(nfs.r, binary.LittleEndian, &nfs.StatRecord); err != nil {
+	if err = binary.Read(r, binary.LittleEndian, &nfs.StatRecord); err != nil {
 		err = ErrFailedReadStatRecord
 		return nfs, err
 	}
+	nfs.blocks.flags = nfs.Header.Flags
 
 	return nfs, err
 }
 
+// SetFilter only return records matching filter from Row, records that do not match are dropped
+// while decoding the block and never returned. A nil filter returns all records.
+func (nfs *NFStream) SetFilter(filter RecordFilter) {
+	nfs.filter = filter
+}
+
+// SetTimeRange only return records completely inside [start, end] like nfdump -t, a zero start or
+// end is unbounded. When the stat record of the file is outside the range Row returns io.EOF right
+// away, with a BlockIndex of the file blocks without records in the range are skipped without
+// decompression. index may be nil.
+func (nfs *NFStream) SetTimeRange(start time.Time, end time.Time, index *BlockIndex) {
+	nfs.timeRange = newTimePruner(start, end, index)
+}
+
+// SetSamplingScale scale the counters of records from sampled exporters to real units with
+// ScaleSampling before filtering, the counters as sampled are available with NFRecord.RawCounts
+func (nfs *NFStream) SetSamplingScale(scale bool) {
+	nfs.scaleSampling = scale
+}
+
+// SetFields only decode fields of Row records, all other fields stay zero and their extensions are
+// skipped. The fields read by the filter are decoded as well, see FieldFilter. Times are always
+// decoded with a time range and the ExporterSysID with sampling scale. The default is AllFields.
+func (nfs *NFStream) SetFields(fields Field) {
+	nfs.fields = fields
+}
+
+// SkippedBlocks number of blocks skipped because of the time range
+func (nfs *NFStream) SkippedBlocks() int {
+	if nfs.timeRange == nil {
+		return 0
+	}
+	return nfs.timeRange.skipped
+}
+
 // Row each call will return an NFRecord struct or an error. io.EOF error means end of file.
 func (nfs *NFStream) Row() (record NFRecord, err error) {
 
@@ -75,251 +138,200 @@ func (nfs *NFStream) Row() (record NFRecord, err error) {
 		readOffset      int
 		byteCountSize   int
 		exts            []uint16
+		data            []byte
+		ipStart         int
+		fields          Field
 	)
 
+	if nfs.timeRange != nil && nfs.blocks.index == 0 && nfs.timeRange.skipFile(nfs.StatRecord) {
+		return record, io.EOF
+	}
+
 NextBlock:
 	if nfs.readNewBlock {
+		if nfs.ctx != nil {
+			if err = nfs.ctx.Err(); err != nil {
+				return record, err
+			}
+		}
 		nfs.readNewBlock = false
-		if err = binary.Read(nfs.r, binary.LittleEndian, &nfs.blockHeader); err == io.EOF {
+		if err = nfs.blocks.readHeader(); err == io.EOF {
 			return
+		} else if canceled(nfs.ctx, err) || err == os.ErrClosed {
+			// The reader stopped waiting for the block, e.g. NFFollowStream, or was closed, e.g.
+			// NFFileStream, read it on the next call
+			nfs.readNewBlock = true
+			return record, err
 		} else if err != nil {
 			err = ErrFailedReadBlockHeader
 			return record, err
 		}
 
-		nfs.blockIndex++
-
-		if len(nfs.blockData) < int(nfs.blockHeader.Size) {
-			nfs.blockData = make([]byte, nfs.blockHeader.Size)
+		if nfs.timeRange != nil && nfs.timeRange.skipBlock(nfs.blocks.index, nfs.blocks.header) {
+			if err = nfs.blocks.skipData(); err != nil {
+				err = fmt.Errorf("Read Block Failed blockIndex:%d error:%w", nfs.blocks.index, err)
+				return record, err
+			}
+			nfs.readNewBlock = true
+			goto NextBlock
 		}
 
-		if err = binary.Read(nfs.r, binary.LittleEndian, nfs.blockData[:nfs.blockHeader.Size]); err == io.EOF {
+		if _, err = nfs.blocks.readData(); err == io.EOF {
 			return record, err
 		} else if err != nil {
-			err = fmt.Errorf("Read Block Failed blockIndex:%d error:%w", nfs.blockIndex, err)
+			err = fmt.Errorf("Read Block Failed blockIndex:%d error:%w", nfs.blocks.index, err)
 			return record, err
 		}
 
 		// Only block type 2 is currently supported, any other types of data will be skipped
-		if nfs.blockHeader.ID != 2 {
+		if nfs.blocks.header.ID != dataBlockID {
 			nfs.readNewBlock = true
 			goto NextBlock
 		}
 
-		if (nfs.Header.Flags & compressionMask) == 0 {
-			nfs.decompressedBlock = nfs.blockData[:nfs.blockHeader.Size]
-		} else if (nfs.Header.Flags & lzoCompressed) > 0 {
-			if nfs.decompressedBlock, err = lzo.Decompress1X(bytes.NewReader(nfs.blockData[:nfs.blockHeader.Size]), 0, 0); err != nil {
-				err = fmt.Errorf("lzo.Decompress1X() failed error:%w", err)
-				return record, err
-			}
-		} else if (nfs.Header.Flags & lz4Compressed) > 0 {
-			err = fmt.Errorf("LZ4 compression not supported")
-			return record, err
-			// if _, err = lz4.Decode(nfs.decompressedBlock, blockData); err != nil {
-			// 	err = errors.Wrapf(err, "lz4.Decode() failed")
-			// 	return record, err
-			// }
-		} else if (nfs.Header.Flags & bz2Compressed) > 0 {
-			err = fmt.Errorf("BZ2 compression not supported")
-			return record, err
-		} else {
-			err = fmt.Errorf("Unsupported File Flag Compression:%d", nfs.Header.Flags)
+		if nfs.decompressedBlock, err = nfs.blocks.data(); err != nil {
 			return record, err
 		}
 		nfs.blockRecordCount = 0
-		nfs.start = 0
+		nfs.records = newRecordIter(nfs.decompressedBlock)
+		nfs.ipArena = nil
 	}
 
 	// START Record
 NextRecord:
-	nfs.blockRecordCount++
-	nfs.recordHeader.Type = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][0:2])
-	nfs.recordHeader.Size = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][2:4])
-
-	if nfs.recordHeader.Size == 0 {
-		err = fmt.Errorf("Corrupt file, bad record size:%d", nfs.recordHeader.Size)
+	if ok, err = nfs.records.next(); err != nil {
 		return record, err
+	} else if !ok {
+		// A block can end with a non flow record, e.g. the exporter records of a file without flows
+		nfs.readNewBlock = true
+		goto NextBlock
 	}
+	nfs.blockRecordCount++
 
-	// Keep count of how many of each record type
-	// nff.Meta.RecordIDCount[recordHeader.Type]++
-	switch nfs.recordHeader.Type {
+	switch nfs.records.recordType {
 	case ExtensionMapRecordHeadType:
-		var mapID = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][4:6])
-		var extSize = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][6:8])
-
-		// extSize == 0 extension map v2
-		// extSize > 0 extension map v1
-		if extSize == 0 {
-			err = fmt.Errorf("Unsupported extension map v2 file")
+		var mapID uint16
+		if mapID, exts, err = decodeExtensionMap(nfs.records.record()); err != nil {
 			return record, err
 		}
-		var x uint16
-		var extStart uint16 = 6
-		var extEnd uint16 = 8
-		var newExtMapID uint16
-		/*
-			Subtract 8 for the size of the record header, mapID and extSize.
-			Type (2 byte) + Size (2 byte) + mapID (2 byte) + extSize (2 byte) = 8 bytes
-
-			Divide by 2 to get the total number of uint16 (2 byte) extension ID's
-
-			This is how to determine the total extensions in the record to read out and put in ext map.
-		*/
-
-		// If mapID already empty it before adding new extMapID's
-		if _, ok = nfs.extMap[mapID]; ok {
-			nfs.extMap[mapID] = nil
-		}
-
-		for x = 0; x < ((nfs.recordHeader.Size - 8) / 2); x++ {
-			extStart += 2
-			extEnd += 2
-			newExtMapID = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][extStart:extEnd])
-			if newExtMapID > 48 {
-				err = fmt.Errorf("Corrupt file, bad extMapID:%d mapID:%d", newExtMapID, mapID)
-				return record, err
-			}
-			/*
-				v1 extension map aligns to 32bit so its possible there could be a 0 mapID at the end
-				When mapID is 0 just ignore it
-			*/
-			if newExtMapID != 0 {
-				nfs.extMap[mapID] = append(nfs.extMap[mapID], newExtMapID)
-			}
-		}
-
-		nfs.start += int(nfs.recordHeader.Size)
+		nfs.extMap[mapID] = exts
 		goto NextRecord
 	case ExporterInfoRecordHeadType:
-		// Store Exporter in map 'exporters'
 		var exporter NFExporterInfoRecord
-		exporter.Version = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][4:8])
-		exporter.SAFamily = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][24:26])
-		exporter.SysID = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][26:28])
-		exporter.ID = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][28:32])
-
-		/*
-			NFDump stores the exporter IP as 2 uint64 integers. If the second uint64 [16:24]
-			is == 0 we assume its an IPv4 address and only need to use the [12:16] slice
-		*/
-		var ipNumber2 = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][16:24])
-		if ipNumber2 == 0 {
-			// IPv4
-			exporter.IPAddr = nfs.decompressedBlock[nfs.start:][12:16]
-		} else {
-			// IPv6
-			var tmpIP []byte
-			tmpIP = append(tmpIP, nfs.decompressedBlock[nfs.start:][16:24]...)
-			tmpIP = append(tmpIP, nfs.decompressedBlock[nfs.start:][8:16]...)
-			exporter.IPAddr = tmpIP
+		if exporter, err = decodeExporterInfo(nfs.records.record()); err != nil {
+			return record, err
 		}
-
 		nfs.Exporters[exporter.SysID] = exporter
-
-		nfs.start += int(nfs.recordHeader.Size)
+		nfs.exporterRecords++
 		goto NextRecord
 	case SamplerInfoRecordHeadType:
-		// Store Samplers in map 'Samplers'
-
 		var sampler NFSamplerInfoRecord
-		sampler.ID = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][4:8])
-		sampler.Interval = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][8:12])
-		sampler.Mode = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][12:14])
-		sampler.ExporterSysID = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][14:16])
-
-		nfs.SamplerInfo[sampler.ExporterSysID] = sampler
-
-		nfs.start += int(nfs.recordHeader.Size)
+		if sampler, err = decodeSamplerInfo(nfs.records.record()); err != nil {
+			return record, err
+		}
+		nfs.addSampler(sampler)
 		goto NextRecord
 	case EmptyRecordHeadType:
 		nfs.readNewBlock = true
 		goto NextBlock
 	case ExporterStatRecordHeadType:
-		// Exporter statistics records
-
-		var statCount uint32
-		var statPosition uint32
-		var statRecord NFExporterStatRecord
-
-		statCount = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][4:8])
-
-		for statPosition = 0; statPosition < statCount; statPosition++ {
-			j := (statPosition * 24) + 8 // each stat record is 24 bytes + 8 for header/stat count
-
-			statRecord.SysID = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][j : j+4])
-			statRecord.SequenceFailures = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][j+4 : j+8])
-			statRecord.Packets = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][j+8 : j+16])
-			statRecord.Flows = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][j+16 : j+24])
-
-			nfs.ExporterStats[statRecord.SysID] = statRecord
+		// Exporter statistics records, a file can contain several for the same exporter
+		for _, stat := range decodeExporterStats(nfs.records.record()) {
+			addExporterStat(nfs.ExporterStats, stat)
 		}
-
-		nfs.readNewBlock = true
-		goto NextBlock
+		goto NextRecord
 	default:
-		if nfs.recordHeader.Type != 10 {
-			nfs.start += int(nfs.recordHeader.Size)
+		if nfs.records.recordType != 10 {
 			goto NextRecord
 		}
 	}
 
-	record.Flags = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][4:6])
-	recordExtID = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][6:8])
-	record.MsecFirst = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][8:10])
-	record.MsecLast = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][10:12])
-	record.First = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][12:16])
-	record.Last = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][16:20])
-	record.FwdStatus = uint8(nfs.decompressedBlock[nfs.start:][20])
-	record.TCPFlags = uint8(nfs.decompressedBlock[nfs.start:][21])
-	record.Proto = uint8(nfs.decompressedBlock[nfs.start:][22])
-	record.Tos = uint8(nfs.decompressedBlock[nfs.start:][23])
-
-	if record.Proto == 1 || record.Proto == 58 {
-		record.ICMPType = nfs.decompressedBlock[nfs.start:][27]
-		record.ICMPCode = nfs.decompressedBlock[nfs.start:][26]
-		record.SrcPort = 0
-		record.DstPort = (uint16(record.ICMPType) * 256) + uint16(record.ICMPCode)
-	} else {
-		record.SrcPort = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][24:26])
-		record.DstPort = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][26:28])
-		record.ICMPType = 0
-		record.ICMPCode = 0
+	data = nfs.decompressedBlock[nfs.records.start:]
+	fields = nfs.recordFields()
+
+	// IPs of the records of a block share the arena, records never alias the block data
+	if fields&ipFields != 0 && cap(nfs.ipArena)-len(nfs.ipArena) < maxRecordIPSize {
+		nfs.ipArena = make([]byte, 0, ipArenaSize)
+	}
+	ipStart = len(nfs.ipArena)
+
+	record.Flags = binary.LittleEndian.Uint16(data[4:6])
+	recordExtID = binary.LittleEndian.Uint16(data[6:8])
+	if fields&FieldTime != 0 {
+		record.MsecFirst = binary.LittleEndian.Uint16(data[8:10])
+		record.MsecLast = binary.LittleEndian.Uint16(data[10:12])
+		record.First = binary.LittleEndian.Uint32(data[12:16])
+		record.Last = binary.LittleEndian.Uint32(data[16:20])
+	}
+	if fields&FieldProto != 0 {
+		record.FwdStatus = uint8(data[20])
+		record.TCPFlags = uint8(data[21])
+		record.Proto = uint8(data[22])
+		record.Tos = uint8(data[23])
 	}
 
-	record.ExporterSysID = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][28:30])
-	record.Reserved = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][30:32])
+	if fields&FieldPort != 0 {
+		// Proto is not decoded without FieldProto
+		if proto := data[22]; proto == 1 || proto == 58 {
+			record.ICMPType = data[27]
+			record.ICMPCode = data[26]
+			record.SrcPort = 0
+			record.DstPort = (uint16(record.ICMPType) * 256) + uint16(record.ICMPCode)
+		} else {
+			record.SrcPort = binary.LittleEndian.Uint16(data[24:26])
+			record.DstPort = binary.LittleEndian.Uint16(data[26:28])
+			record.ICMPType = 0
+			record.ICMPCode = 0
+		}
+	}
+
+	if fields&FieldExporter != 0 {
+		record.ExporterSysID = binary.LittleEndian.Uint16(data[28:30])
+		record.Reserved = binary.LittleEndian.Uint16(data[30:32])
+	}
 
 	if (record.Flags & v6And) != 0 {
 		// nff.Meta.IPv6Count++
-		record.SrcIP = append(record.SrcIP, reverseByteSlice(nfs.decompressedBlock[nfs.start:][32:40])...)
-		record.SrcIP = append(record.SrcIP, reverseByteSlice(nfs.decompressedBlock[nfs.start:][40:48])...)
-
-		record.DstIP = append(record.DstIP, reverseByteSlice(nfs.decompressedBlock[nfs.start:][48:56])...)
-		record.DstIP = append(record.DstIP, reverseByteSlice(nfs.decompressedBlock[nfs.start:][56:64])...)
+		if fields&FieldSrcIP != 0 {
+			record.SrcIP = reversedIP(&nfs.ipArena, data[32:40], data[40:48])
+		}
+		if fields&FieldDstIP != 0 {
+			record.DstIP = reversedIP(&nfs.ipArena, data[48:56], data[56:64])
+		}
 		ipSize = 32
 
 	} else {
 		// nff.Meta.IPv4Count++
-		record.SrcIP = reverseByteSlice(nfs.decompressedBlock[nfs.start:][32:36])
-		record.DstIP = reverseByteSlice(nfs.decompressedBlock[nfs.start:][36:40])
+		if fields&FieldSrcIP != 0 {
+			record.SrcIP = reversedIP(&nfs.ipArena, data[32:36])
+		}
+		if fields&FieldDstIP != 0 {
+			record.DstIP = reversedIP(&nfs.ipArena, data[36:40])
+		}
 		ipSize = 8
 	}
 
 	if (record.Flags & packetCount8Byte) != 0 {
-		record.PacketCount = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][(32 + ipSize):][0:8])
+		if fields&FieldPackets != 0 {
+			record.PacketCount = binary.LittleEndian.Uint64(data[(32 + ipSize):][0:8])
+		}
 		packetCountSize = 8
 	} else {
-		record.PacketCount = uint64(binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][(32 + ipSize):][0:4]))
+		if fields&FieldPackets != 0 {
+			record.PacketCount = uint64(binary.LittleEndian.Uint32(data[(32 + ipSize):][0:4]))
+		}
 		packetCountSize = 4
 	}
 
 	if (record.Flags & bytesCount8Byte) != 0 {
-		record.ByteCount = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][(32 + packetCountSize + ipSize):][0:8])
+		if fields&FieldBytes != 0 {
+			record.ByteCount = binary.LittleEndian.Uint64(data[(32 + packetCountSize + ipSize):][0:8])
+		}
 		byteCountSize = 8
 	} else {
-		record.ByteCount = uint64(binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][(32 + packetCountSize + ipSize):][0:4]))
+		if fields&FieldBytes != 0 {
+			record.ByteCount = uint64(binary.LittleEndian.Uint32(data[(32 + packetCountSize + ipSize):][0:4]))
+		}
 		byteCountSize = 4
 	}
 
@@ -333,68 +345,92 @@ NextRecord:
 	for _, extID := range exts {
 		switch extID {
 		case 4:
-			record.Input = uint32(binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][readOffset:][0:2]))
-			readOffset += 2
-			record.Output = uint32(binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][readOffset:][0:2]))
-			readOffset += 2
-		case 5:
-			record.Input = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][readOffset:][0:4])
-			readOffset += 4
-			record.Output = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][readOffset:][0:4])
+			if fields&FieldInterface != 0 {
+				record.Input = uint32(binary.LittleEndian.Uint16(data[readOffset:][0:2]))
+				record.Output = uint32(binary.LittleEndian.Uint16(data[readOffset:][2:4]))
+			}
 			readOffset += 4
+		case 5:
+			if fields&FieldInterface != 0 {
+				record.Input = binary.LittleEndian.Uint32(data[readOffset:][0:4])
+				record.Output = binary.LittleEndian.Uint32(data[readOffset:][4:8])
+			}
+			readOffset += 8
 		case 6:
-			record.SrcAS = uint32(binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][readOffset:][0:2]))
-			readOffset += 2
-			record.DstAS = uint32(binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][readOffset:][0:2]))
-			readOffset += 2
-		case 7:
-			record.SrcAS = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][readOffset:][0:4])
-			readOffset += 4
-			record.DstAS = binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][readOffset:][0:4])
+			if fields&FieldAS != 0 {
+				record.SrcAS = uint32(binary.LittleEndian.Uint16(data[readOffset:][0:2]))
+				record.DstAS = uint32(binary.LittleEndian.Uint16(data[readOffset:][2:4]))
+			}
 			readOffset += 4
+		case 7:
+			if fields&FieldAS != 0 {
+				record.SrcAS = binary.LittleEndian.Uint32(data[readOffset:][0:4])
+				record.DstAS = binary.LittleEndian.Uint32(data[readOffset:][4:8])
+			}
+			readOffset += 8
 		case 8:
-			record.DstTos = nfs.decompressedBlock[nfs.start:][readOffset:][0]
-			readOffset++
-			record.Dir = nfs.decompressedBlock[nfs.start:][readOffset:][0]
-			readOffset++
-			record.SrcMask = nfs.decompressedBlock[nfs.start:][readOffset:][0]
-			readOffset++
-			record.DstMask = nfs.decompressedBlock[nfs.start:][readOffset:][0]
-			readOffset++
+			if fields&FieldMask != 0 {
+				record.DstTos = data[readOffset:][0]
+				record.Dir = data[readOffset:][1]
+				record.SrcMask = data[readOffset:][2]
+				record.DstMask = data[readOffset:][3]
+			}
+			readOffset += 4
 		case 9:
-			record.NextHopIP = reverseByteSlice(nfs.decompressedBlock[nfs.start:][readOffset:][0:4])
+			if fields&FieldNextHopIP != 0 {
+				record.NextHopIP = reversedIP(&nfs.ipArena, data[readOffset:][0:4])
+			}
 			readOffset += 4
 		case 10:
-			record.NextHopIP = reverseByteSlice(nfs.decompressedBlock[nfs.start:][readOffset:][0:16])
+			if fields&FieldNextHopIP != 0 {
+				record.NextHopIP = reversedIP(&nfs.ipArena, data[readOffset:][0:16])
+			}
 			readOffset += 16
 		case 11:
-			record.BGPNextIP = reverseByteSlice(nfs.decompressedBlock[nfs.start:][readOffset:][0:4])
+			if fields&FieldBGPNextIP != 0 {
+				record.BGPNextIP = reversedIP(&nfs.ipArena, data[readOffset:][0:4])
+			}
 			readOffset += 4
 		case 12:
-			record.BGPNextIP = reverseByteSlice(nfs.decompressedBlock[nfs.start:][readOffset:][0:16])
+			if fields&FieldBGPNextIP != 0 {
+				record.BGPNextIP = reversedIP(&nfs.ipArena, data[readOffset:][0:16])
+			}
 			readOffset += 16
 		case 13:
-			record.SrcVlan = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][readOffset:][0:2])
-			readOffset += 2
-			record.DstVLan = binary.LittleEndian.Uint16(nfs.decompressedBlock[nfs.start:][readOffset:][0:2])
-			readOffset += 2
+			if fields&FieldVlan != 0 {
+				record.SrcVlan = binary.LittleEndian.Uint16(data[readOffset:][0:2])
+				record.DstVLan = binary.LittleEndian.Uint16(data[readOffset:][2:4])
+			}
+			readOffset += 4
 		case 14:
-			record.OutPkts = uint64(binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][readOffset:][0:4]))
+			if fields&FieldOutPkts != 0 {
+				record.OutPkts = uint64(binary.LittleEndian.Uint32(data[readOffset:][0:4]))
+			}
 			readOffset += 4
 		case 15:
-			record.OutPkts = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][readOffset:][0:8])
+			if fields&FieldOutPkts != 0 {
+				record.OutPkts = binary.LittleEndian.Uint64(data[readOffset:][0:8])
+			}
 			readOffset += 8
 		case 16:
-			record.OutBytes = uint64(binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][readOffset:][0:4]))
+			if fields&FieldOutBytes != 0 {
+				record.OutBytes = uint64(binary.LittleEndian.Uint32(data[readOffset:][0:4]))
+			}
 			readOffset += 4
 		case 17:
-			record.OutBytes = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][readOffset:][0:8])
+			if fields&FieldOutBytes != 0 {
+				record.OutBytes = binary.LittleEndian.Uint64(data[readOffset:][0:8])
+			}
 			readOffset += 8
 		case 18:
-			record.AggeFlows = uint64(binary.LittleEndian.Uint32(nfs.decompressedBlock[nfs.start:][readOffset:][0:4]))
+			if fields&FieldAggeFlows != 0 {
+				record.AggeFlows = uint64(binary.LittleEndian.Uint32(data[readOffset:][0:4]))
+			}
 			readOffset += 4
 		case 19:
-			record.AggeFlows = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][readOffset:][0:8])
+			if fields&FieldAggeFlows != 0 {
+				record.AggeFlows = binary.LittleEndian.Uint64(data[readOffset:][0:8])
+			}
 			readOffset += 8
 		case 20:
 			// To be added later or as needed
@@ -406,11 +442,14 @@ NextRecord:
 			// To be added later or as needed
 			readOffset += 40
 		case 23:
-			record.RouterIP = reverseByteSlice(nfs.decompressedBlock[nfs.start:][readOffset:][0:4])
+			if fields&FieldRouterIP != 0 {
+				record.RouterIP = reversedIP(&nfs.ipArena, data[readOffset:][0:4])
+			}
 			readOffset += 4
 		case 24:
-			record.RouterIP = append(record.RouterIP, reverseByteSlice(nfs.decompressedBlock[nfs.start:][readOffset:][0:8])...)
-			record.RouterIP = append(record.RouterIP, reverseByteSlice(nfs.decompressedBlock[nfs.start:][readOffset:][8:16])...)
+			if fields&FieldRouterIP != 0 {
+				record.RouterIP = reversedIP(&nfs.ipArena, data[readOffset:][0:8], data[readOffset:][8:16])
+			}
 			readOffset += 16
 		case 25:
 			// To be added later or as needed
@@ -419,7 +458,9 @@ NextRecord:
 			// To be added later or as needed
 			readOffset += 8
 		case 27:
-			record.Received = binary.LittleEndian.Uint64(nfs.decompressedBlock[nfs.start:][readOffset:][0:8])
+			if fields&FieldReceived != 0 {
+				record.Received = binary.LittleEndian.Uint64(data[readOffset:][0:8])
+			}
 			readOffset += 8
 		case 28:
 			// reserved
@@ -477,11 +518,73 @@ NextRecord:
 		}
 	}
 
-	nfs.start += int(nfs.recordHeader.Size)
-
-	if nfs.blockHeader.NumRecords == uint32(nfs.blockRecordCount) {
+	if nfs.blocks.header.NumRecords == uint32(nfs.blockRecordCount) {
 		nfs.readNewBlock = true
 	}
 
+	if nfs.scaleSampling {
+		nfs.scaleRecord(&record)
+	}
+
+	if (nfs.timeRange != nil && !nfs.timeRange.match(&record)) || (nfs.filter != nil && !nfs.filter.Match(&record)) {
+		record = NFRecord{}
+		// IPs of dropped records are never referenced
+		nfs.ipArena = nfs.ipArena[:ipStart]
+		goto NextBlock
+	}
+
 	return record, err
 }
+
+// addSampler add sampler to SamplerInfo and Samplers, the interval of its exporter is looked up again
+func (nfs *NFStream) addSampler(sampler NFSamplerInfoRecord) {
+	addSampler(nfs.SamplerInfo, nfs.Samplers, sampler)
+	delete(nfs.samplingIntervals, sampler.ExporterSysID)
+}
+
+// scaleRecord scale record like ScaleSampling with the cached interval of its exporter
+func (nfs *NFStream) scaleRecord(record *NFRecord) {
+	var interval, ok = nfs.samplingIntervals[record.ExporterSysID]
+	if !ok {
+		var ambiguous bool
+		if interval, ambiguous = samplingInterval(nfs.Samplers, record.ExporterSysID); ambiguous {
+			interval = 0
+		}
+		if nfs.samplingIntervals == nil {
+			nfs.samplingIntervals = make(map[uint16]uint32)
+		}
+		nfs.samplingIntervals[record.ExporterSysID] = interval
+	}
+	scaleCounters(record, interval)
+}
+
+// recordFields fields to decode, fields needed by filter, time range and sampling scale are always
+// decoded
+func (nfs *NFStream) recordFields() Field {
+	var fields = nfs.fields | filterFields(nfs.filter)
+	if nfs.timeRange != nil {
+		fields |= FieldTime
+	}
+	if nfs.scaleSampling {
+		fields |= FieldExporter
+	}
+	return fields
+}
+
+// maxRecordIPSize bytes needed for source, destination, next hop, BGP next hop and router IPv6
+const maxRecordIPSize = 5 * net.IPv6len
+
+// ipArenaSize size of the IP arena chunks of a block, fits the IPs of at least 64 records
+const ipArenaSize = 64 * maxRecordIPSize
+
+// reversedIP append the bytes of every part in reverse order to buf and return them as net.IP.
+// Record data is never modified, so blocks can be decoded from read only memory.
+func reversedIP(buf *[]byte, parts ...[]byte) net.IP {
+	var start = len(*buf)
+	for _, part := range parts {
+		for i := len(part) - 1; i >= 0; i-- {
+			*buf = append(*buf, part[i])
+		}
+	}
+	return net.IP((*buf)[start:len(*buf):len(*buf)])
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"reflect"
 	"testing"
 )
 
@@ -78,3 +79,53 @@ func TestStreamReader(t *testing.T) {
 	}
 Stop:
 }
+
+func TestEmptyStreamReader(t *testing.T) {
+	var data []byte
+	var err error
+	if data, err = ioutil.ReadFile("testdata/nfcapd-empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatalf("StreamReader error:%v", err)
+	}
+
+	if _, err = nfs.Row(); err != io.EOF {
+		t.Errorf("Expected io.EOF got:%v", err)
+	}
+	if len(nfs.Exporters) != 1 || nfs.SamplerInfo[1].Interval != 1 {
+		t.Errorf("Unexpected exporters:%+v samplers:%+v", nfs.Exporters, nfs.SamplerInfo)
+	}
+}
+
+func TestStreamReaderRetainedRecords(t *testing.T) {
+	// Uncompressed blocks are read into the same buffer, records must not alias it
+	var data = splitTestFile(t)
+
+	var expected, err = ParseReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(bytes.NewReader(data)); err != nil {
+		t.Fatalf("StreamReader error:%v", err)
+	}
+
+	var records []NFRecord
+	for {
+		var record NFRecord
+		if record, err = nfs.Row(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Row error:%v", err)
+		}
+		records = append(records, record)
+	}
+
+	if !reflect.DeepEqual(records, expected.Records) {
+		t.Errorf("Retained records changed by later blocks")
+	}
+}
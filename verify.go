@@ -0,0 +1,255 @@
+package nfdump
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// VerifyReport result of Verify, lists every place where the file header, block headers or stat
+// record do not match the actual contents of the file
+type VerifyReport struct {
+	Header NFHeader
+	// StatRecord stat record as stored in the file
+	StatRecord NFStatRecord
+	// Computed stat record computed from the flow records of all readable blocks
+	Computed NFStatRecord
+	// NumBlocks number of blocks actually present
+	NumBlocks uint32
+	// NumRecords number of records in all readable data blocks
+	NumRecords uint64
+	// Truncated file ended in the middle of a block
+	Truncated bool
+
+	Discrepancies []Discrepancy
+}
+
+// Discrepancy a single mismatch between stored and actual file contents
+type Discrepancy struct {
+	// Block 1 based block index, 0 for file header and stat record
+	Block int
+	// Field name of the header or stat record field, e.g. "NumBlocks" or "NumBytesTCP"
+	Field string
+	// Expected value stored in the file, times are milliseconds since epoch
+	Expected uint64
+	// Actual value found in the file contents
+	Actual uint64
+	// Message optional description for discrepancies that are not a simple value mismatch
+	Message string
+}
+
+// String human readable discrepancy
+func (d Discrepancy) String() string {
+	var location = "file"
+	if d.Block > 0 {
+		location = fmt.Sprintf("block %d", d.Block)
+	}
+	if d.Message != "" {
+		return fmt.Sprintf("%s: %s %s", location, d.Field, d.Message)
+	}
+	return fmt.Sprintf("%s: %s expected %d actual %d", location, d.Field, d.Expected, d.Actual)
+}
+
+// OK true when no discrepancy was found
+func (vr *VerifyReport) OK() bool {
+	return len(vr.Discrepancies) == 0
+}
+
+// addf add discrepancy with a message
+func (vr *VerifyReport) addf(block int, field string, format string, args ...interface{}) {
+	vr.Discrepancies = append(vr.Discrepancies, Discrepancy{Block: block, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// compare add discrepancy when expected and actual differ
+func (vr *VerifyReport) compare(block int, field string, expected uint64, actual uint64) {
+	if expected != actual {
+		vr.Discrepancies = append(vr.Discrepancies, Discrepancy{Block: block, Field: field, Expected: expected, Actual: actual})
+	}
+}
+
+// Verify read the whole file and check NFHeader.NumBlocks, NFBlockHeader.NumRecords and the
+// NFStatRecord totals and time range against the actual file contents.
+//
+// Corrupt blocks, bad record sizes and truncation are reported as discrepancies, an error is only
+// returned when the file header can not be read or the reader fails.
+func Verify(r io.Reader) (report *VerifyReport, err error) {
+	var (
+		header  NFHeader
+		stat    NFStatRecord
+		data    []byte
+		firstMS uint64
+		lastMS  uint64
+	)
+
+	if header, stat, err = readFileHeader(r); err != nil {
+		return nil, err
+	}
+
+	report = &VerifyReport{
+		Header:     header,
+		StatRecord: stat,
+	}
+
+	var blocks = blockReader{r: r, flags: header.Flags}
+	for {
+		var blockIndex = blocks.index + 1
+		if err = blocks.readHeader(); err == io.EOF {
+			break
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			report.Truncated = true
+			report.addf(blockIndex, "NFBlockHeader", "truncated block header")
+			break
+		} else if err != nil {
+			return report, err
+		}
+		report.NumBlocks++
+
+		var n int
+		if n, err = blocks.readData(); err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			report.Truncated = true
+			report.addf(blockIndex, "Size", "truncated block, expected %d bytes read %d", blocks.header.Size, n)
+			break
+		} else if err != nil {
+			return report, err
+		}
+
+		if blocks.header.ID != dataBlockID {
+			continue
+		}
+
+		if data, err = blocks.data(); err != nil {
+			report.addf(blockIndex, "Data", "%v", err)
+			continue
+		}
+
+		var records uint32
+		var it = newRecordIter(data)
+		for {
+			var ok bool
+			if ok, err = it.next(); err != nil {
+				report.addf(blockIndex, "Data", "bad record size:%d at offset:%d", it.size, it.start)
+				break
+			} else if !ok {
+				if it.trailing() > 0 {
+					report.addf(blockIndex, "Data", "%d trailing bytes", it.trailing())
+				}
+				break
+			}
+			records++
+
+			if it.recordType == 10 {
+				var first, last, ok = report.countFlow(it.record())
+				if !ok {
+					report.addf(blockIndex, "Data", "bad flow record at offset:%d", it.start)
+				} else {
+					if firstMS == 0 || first < firstMS {
+						firstMS = first
+					}
+					if last > lastMS {
+						lastMS = last
+					}
+				}
+			}
+		}
+
+		report.NumRecords += uint64(records)
+		report.compare(blockIndex, "NumRecords", uint64(blocks.header.NumRecords), uint64(records))
+	}
+
+	report.Computed.FirstSeen = uint32(firstMS / 1000)
+	report.Computed.MSecFirst = uint16(firstMS % 1000)
+	report.Computed.LastSeen = uint32(lastMS / 1000)
+	report.Computed.MSecLast = uint16(lastMS % 1000)
+
+	report.compare(0, "NumBlocks", uint64(header.NumBlocks), uint64(report.NumBlocks))
+
+	var computed = report.Computed
+	report.compare(0, "NumFlows", stat.NumFlows, computed.NumFlows)
+	report.compare(0, "NumBytes", stat.NumBytes, computed.NumBytes)
+	report.compare(0, "NumPackets", stat.NumPackets, computed.NumPackets)
+	report.compare(0, "NumFlowsTCP", stat.NumFlowsTCP, computed.NumFlowsTCP)
+	report.compare(0, "NumFlowsUDP", stat.NumFlowsUDP, computed.NumFlowsUDP)
+	report.compare(0, "NumFlowsICMP", stat.NumFlowsICMP, computed.NumFlowsICMP)
+	report.compare(0, "NumFlowsOther", stat.NumFlowsOther, computed.NumFlowsOther)
+	report.compare(0, "NumBytesTCP", stat.NumBytesTCP, computed.NumBytesTCP)
+	report.compare(0, "NumBytesUDP", stat.NumBytesUDP, computed.NumBytesUDP)
+	report.compare(0, "NumBytesICMP", stat.NumBytesICMP, computed.NumBytesICMP)
+	report.compare(0, "NumBytesOther", stat.NumBytesOther, computed.NumBytesOther)
+	report.compare(0, "NumPacketsTCP", stat.NumPacketsTCP, computed.NumPacketsTCP)
+	report.compare(0, "NumPacketsUDP", stat.NumPacketsUDP, computed.NumPacketsUDP)
+	report.compare(0, "NumPacketsICMP", stat.NumPacketsICMP, computed.NumPacketsICMP)
+	report.compare(0, "NumPacketsOther", stat.NumPacketsOther, computed.NumPacketsOther)
+
+	// Files without flows only carry the capture interval as time range
+	if computed.NumFlows > 0 {
+		report.compare(0, "FirstSeen", uint64(stat.FirstSeen)*1000+uint64(stat.MSecFirst), firstMS)
+		report.compare(0, "LastSeen", uint64(stat.LastSeen)*1000+uint64(stat.MSecLast), lastMS)
+	}
+
+	return report, nil
+}
+
+// countFlow add flow record counters to the computed stat record and return its time range in
+// milliseconds, data is the complete record starting at the record header
+func (vr *VerifyReport) countFlow(data []byte) (firstMS uint64, lastMS uint64, ok bool) {
+	var ipSize, packetCountSize, byteCountSize = 8, 4, 4
+
+	if len(data) < 32 {
+		return 0, 0, false
+	}
+	var flags = binary.LittleEndian.Uint16(data[4:6])
+	if (flags & v6And) != 0 {
+		ipSize = 32
+	}
+	if (flags & packetCount8Byte) != 0 {
+		packetCountSize = 8
+	}
+	if (flags & bytesCount8Byte) != 0 {
+		byteCountSize = 8
+	}
+	if len(data) < 32+ipSize+packetCountSize+byteCountSize {
+		return 0, 0, false
+	}
+
+	var packets, bytes uint64
+	var offset = 32 + ipSize
+	if packetCountSize == 8 {
+		packets = binary.LittleEndian.Uint64(data[offset:])
+	} else {
+		packets = uint64(binary.LittleEndian.Uint32(data[offset:]))
+	}
+	offset += packetCountSize
+	if byteCountSize == 8 {
+		bytes = binary.LittleEndian.Uint64(data[offset:])
+	} else {
+		bytes = uint64(binary.LittleEndian.Uint32(data[offset:]))
+	}
+
+	var s = &vr.Computed
+	s.NumFlows++
+	s.NumPackets += packets
+	s.NumBytes += bytes
+
+	switch data[22] {
+	case 6:
+		s.NumFlowsTCP++
+		s.NumPacketsTCP += packets
+		s.NumBytesTCP += bytes
+	case 17:
+		s.NumFlowsUDP++
+		s.NumPacketsUDP += packets
+		s.NumBytesUDP += bytes
+	case 1, 58:
+		s.NumFlowsICMP++
+		s.NumPacketsICMP += packets
+		s.NumBytesICMP += bytes
+	default:
+		s.NumFlowsOther++
+		s.NumPacketsOther += packets
+		s.NumBytesOther += bytes
+	}
+
+	var first, last, _ = flowTimeRange(data)
+	return uint64(first), uint64(last), true
+}
@@ -0,0 +1,99 @@
+package nfdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	var small, err = ioutil.ReadFile("testdata/nfcapd-small-lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NumBlocks is at offset 8 of the file header, NumBytesTCP at offset 56 of the stat record
+	var tampered = append([]byte{}, small...)
+	binary.LittleEndian.PutUint32(tampered[8:12], 2)
+	binary.LittleEndian.PutUint64(tampered[140+56:], 1)
+
+	var tests = []struct {
+		name          string
+		fileName      string
+		data          []byte
+		truncated     bool
+		discrepancies []Discrepancy
+	}{
+		{name: "small", fileName: "testdata/nfcapd-small-lzo"},
+		{name: "empty", fileName: "testdata/nfcapd-empty"},
+		{name: "tampered", data: tampered, discrepancies: []Discrepancy{
+			{Field: "NumBlocks", Expected: 2, Actual: 1},
+			{Field: "NumBytesTCP", Expected: 1, Actual: 10308000},
+		}},
+		{name: "truncated", data: small[:len(small)/2], truncated: true, discrepancies: []Discrepancy{
+			{Block: 1, Field: "Size", Message: "truncated block, expected 38635 bytes read 19173"},
+		}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var data = tc.data
+			if tc.fileName != "" {
+				if data, err = ioutil.ReadFile(tc.fileName); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var report *VerifyReport
+			if report, err = Verify(bytes.NewReader(data)); err != nil {
+				t.Fatalf("Verify error:%v", err)
+			}
+
+			if report.Truncated != tc.truncated {
+				t.Errorf("Unexpected truncated:%t", report.Truncated)
+			}
+			if report.OK() != (len(tc.discrepancies) == 0) {
+				t.Errorf("Unexpected OK:%t discrepancies:%v", report.OK(), report.Discrepancies)
+			}
+
+			// a truncated file also fails all stat record checks, only compare the leading entries
+			if len(report.Discrepancies) < len(tc.discrepancies) || (!tc.truncated && len(report.Discrepancies) != len(tc.discrepancies)) {
+				t.Fatalf("Unexpected discrepancies:%v expected %v", report.Discrepancies, tc.discrepancies)
+			}
+			for x, d := range tc.discrepancies {
+				if report.Discrepancies[x] != d {
+					t.Errorf("Unexpected discrepancy:%v expected %v", report.Discrepancies[x], d)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	var data, err = ioutil.ReadFile("testdata/nfcapd-corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report *VerifyReport
+	if report, err = Verify(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Verify error:%v", err)
+	}
+	if report.OK() || report.NumBlocks != 5 {
+		t.Fatalf("Unexpected report OK:%t blocks:%d", report.OK(), report.NumBlocks)
+	}
+
+	var expected = Discrepancy{Block: 1, Field: "NumRecords", Expected: 39181, Actual: 0}
+	if report.Discrepancies[1] != expected {
+		t.Errorf("Unexpected discrepancy:%v expected %v", report.Discrepancies[1], expected)
+	}
+	if report.Discrepancies[1].String() != "block 1: NumRecords expected 39181 actual 0" {
+		t.Errorf("Unexpected discrepancy string:%s", report.Discrepancies[1])
+	}
+
+	if _, err = Verify(bytes.NewReader(data[:100])); err != ErrFailedReadFileHeader {
+		t.Errorf("Unexpected error:%v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package nfdump
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultWatchLookback how long a Watcher remembers processed files
+const DefaultWatchLookback = 24 * time.Hour
+
+// watchCheckpointVersion version of the watcher checkpoint format
+const watchCheckpointVersion = 1
+
+// WatchHandler processes a single file found by a Watcher, nfs is positioned after the file header
+type WatchHandler func(file CaptureFile, nfs *NFStream) error
+
+// Watcher polls a collector directory for completed nfcapd.YYYYMMDDhhmm[ss] files and calls Handler
+// once for every new file in capture time order. Files still written by nfcapd are named
+// nfcapd.current.<pid> and only picked up after rotation.
+//
+// Processed files are recorded in the Checkpoint file after Handler returns, so a restarted Watcher
+// continues where the last one stopped. A file whose Handler failed or was interrupted by a crash is
+// processed again.
+type Watcher struct {
+	// Selection directory, prefix and time zone of the files. Without a checkpoint all files of the
+	// selection are processed, set Start to skip older files.
+	Selection FileSelection
+	// Checkpoint path of the state file, written atomically after every file. Empty keeps state in
+	// memory only.
+	Checkpoint string
+	// Handler called for every new file
+	Handler WatchHandler
+	// PollInterval interval of Run, DefaultPollInterval when zero
+	PollInterval time.Duration
+	// Lookback files older than the newest processed file by more than Lookback are ignored, this
+	// bounds the checkpoint size and still catches files that show up late. DefaultWatchLookback
+	// when zero.
+	Lookback time.Duration
+
+	state *watchCheckpoint
+}
+
+// watchCheckpoint processed files of a Watcher
+type watchCheckpoint struct {
+	Version int `json:"version"`
+	// Newest capture time of the newest processed file
+	Newest time.Time `json:"newest"`
+	// Processed capture time of processed files by slash separated path relative to the directory
+	Processed map[string]time.Time `json:"processed"`
+}
+
+// Poll process all new files once and return the number of files processed. Stops at the first
+// Handler error, the file is then processed again by the next Poll.
+func (w *Watcher) Poll() (processed int, err error) {
+	if w.Handler == nil {
+		return 0, fmt.Errorf("Watcher without Handler")
+	}
+	if w.state == nil {
+		if w.state, err = readWatchCheckpoint(w.Checkpoint); err != nil {
+			return 0, err
+		}
+	}
+
+	var cutoff = w.cutoff()
+	var sel = w.Selection
+	if !cutoff.IsZero() && cutoff.After(sel.Start) {
+		sel.Start = cutoff
+	}
+
+	var files []CaptureFile
+	if files, err = SelectFiles(sel); err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		if file.Time.Before(cutoff) {
+			continue
+		}
+		var key string
+		if key, err = w.key(file.Path); err != nil {
+			return processed, err
+		}
+		if _, ok := w.state.Processed[key]; ok {
+			continue
+		}
+
+		if err = w.process(file); err != nil {
+			return processed, fmt.Errorf("%s: %w", file.Path, err)
+		}
+		processed++
+
+		w.state.Processed[key] = file.Time
+		if file.Time.After(w.state.Newest) {
+			w.state.Newest = file.Time
+		}
+		if err = w.save(); err != nil {
+			return processed, err
+		}
+	}
+
+	return processed, nil
+}
+
+// Run Poll every PollInterval until stop is closed or Poll fails
+func (w *Watcher) Run(stop <-chan struct{}) error {
+	var interval = w.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Poll(); err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// cutoff capture time before which files are ignored, zero before the first file
+func (w *Watcher) cutoff() time.Time {
+	if w.state.Newest.IsZero() {
+		return time.Time{}
+	}
+	var lookback = w.Lookback
+	if lookback <= 0 {
+		lookback = DefaultWatchLookback
+	}
+	return w.state.Newest.Add(-lookback)
+}
+
+// key checkpoint key of path
+func (w *Watcher) key(path string) (string, error) {
+	var rel, err = filepath.Rel(w.Selection.Dir, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// process open file and call Handler
+func (w *Watcher) process(file CaptureFile) (err error) {
+	var f *os.File
+	if f, err = os.Open(file.Path); err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var nfs *NFStream
+	if nfs, err = StreamReader(bufio.NewReader(f)); err != nil {
+		return err
+	}
+	return w.Handler(file, nfs)
+}
+
+// save drop files outside of the lookback and write the checkpoint
+func (w *Watcher) save() error {
+	var cutoff = w.cutoff()
+	for key, t := range w.state.Processed {
+		if t.Before(cutoff) {
+			delete(w.state.Processed, key)
+		}
+	}
+
+	if w.Checkpoint == "" {
+		return nil
+	}
+	return writeFileAtomic(w.Checkpoint, func(out io.Writer) error {
+		return json.NewEncoder(out).Encode(w.state)
+	})
+}
+
+// readWatchCheckpoint read checkpoint at path, a missing file is an empty checkpoint
+func readWatchCheckpoint(path string) (state *watchCheckpoint, err error) {
+	state = &watchCheckpoint{
+		Version:   watchCheckpointVersion,
+		Processed: make(map[string]time.Time),
+	}
+	if path == "" {
+		return state, nil
+	}
+
+	var f *os.File
+	if f, err = os.Open(path); os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(state); err != nil {
+		return nil, fmt.Errorf("Read checkpoint %s failed error:%w", path, err)
+	}
+	if state.Version != watchCheckpointVersion {
+		return nil, fmt.Errorf("Unsupported checkpoint version:%d", state.Version)
+	}
+	if state.Processed == nil {
+		state.Processed = make(map[string]time.Time)
+	}
+	return state, nil
+}
@@ -0,0 +1,127 @@
+package nfdump
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "nfdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var data []byte
+	if data, err = ioutil.ReadFile("testdata/nfcapd-small-lzo"); err != nil {
+		t.Fatal(err)
+	}
+	var write = func(name string) {
+		var path = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("2019/08/12/nfcapd.201908121855")
+	write("2019/08/12/nfcapd.201908121850")
+	write("2019/08/12/nfcapd.current.1234")
+	write("nfcapd.201908110000")
+
+	var handled []string
+	var fail error
+	var newWatcher = func() *Watcher {
+		return &Watcher{
+			Selection: FileSelection{
+				Dir:      dir,
+				Start:    time.Date(2019, 8, 12, 0, 0, 0, 0, time.UTC),
+				Location: time.UTC,
+			},
+			Checkpoint: filepath.Join(dir, "checkpoint.json"),
+			Handler: func(file CaptureFile, nfs *NFStream) error {
+				if fail != nil {
+					return fail
+				}
+				var records int
+				for {
+					if _, err := nfs.Row(); err == io.EOF {
+						break
+					} else if err != nil {
+						return err
+					}
+					records++
+				}
+				if records != 10 {
+					t.Errorf("%s: unexpected records:%d", file.Path, records)
+				}
+				rel, _ := filepath.Rel(dir, file.Path)
+				handled = append(handled, filepath.ToSlash(rel))
+				return nil
+			},
+		}
+	}
+
+	var w = newWatcher()
+	var n int
+	if n, err = w.Poll(); err != nil || n != 2 {
+		t.Fatalf("Poll processed:%d error:%v", n, err)
+	}
+	var expected = []string{"2019/08/12/nfcapd.201908121850", "2019/08/12/nfcapd.201908121855"}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Errorf("Unexpected files:%v expected %v", handled, expected)
+	}
+	if n, err = w.Poll(); err != nil || n != 0 {
+		t.Errorf("Second Poll processed:%d error:%v", n, err)
+	}
+
+	// A restarted watcher continues from the checkpoint, a late file inside the lookback is processed
+	handled = nil
+	write("2019/08/12/nfcapd.201908121900")
+	write("2019/08/12/nfcapd.201908121845")
+	w = newWatcher()
+	if n, err = w.Poll(); err != nil || n != 2 {
+		t.Fatalf("Restarted Poll processed:%d error:%v", n, err)
+	}
+	expected = []string{"2019/08/12/nfcapd.201908121845", "2019/08/12/nfcapd.201908121900"}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Errorf("Unexpected files after restart:%v expected %v", handled, expected)
+	}
+
+	// A failed file is not recorded and processed by the next Poll
+	handled = nil
+	write("2019/08/12/nfcapd.201908121905")
+	fail = errors.New("handler failed")
+	if n, err = w.Poll(); !errors.Is(err, fail) || n != 0 {
+		t.Errorf("Failing Poll processed:%d error:%v", n, err)
+	}
+	fail = nil
+	w = newWatcher()
+	if n, err = w.Poll(); err != nil || n != 1 || len(handled) != 1 {
+		t.Errorf("Retry Poll processed:%d files:%v error:%v", n, handled, err)
+	}
+
+	// Files older than the lookback are ignored
+	handled = nil
+	write("2019/08/12/nfcapd.201908121000")
+	w = newWatcher()
+	w.Lookback = time.Hour
+	if n, err = w.Poll(); err != nil || n != 0 {
+		t.Errorf("Lookback Poll processed:%d files:%v error:%v", n, handled, err)
+	}
+	var state *watchCheckpoint
+	if state, err = readWatchCheckpoint(w.Checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Processed) != 5 || !state.Newest.Equal(time.Date(2019, 8, 12, 19, 5, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected checkpoint:%+v", state)
+	}
+}